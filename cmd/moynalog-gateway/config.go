@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/shoman4eg/go-moy-nalog/moynalog"
+)
+
+// config is the gateway configuration file.
+type config struct {
+	// Listen is the address the gateway listens on. Defaults to ":8080".
+	Listen string `json:"listen"`
+	// Endpoint overrides the upstream API root.
+	Endpoint string `json:"endpoint"`
+	// Taxpayers are the accounts the gateway registers receipts for.
+	Taxpayers []taxpayerConfig `json:"taxpayers"`
+}
+
+// taxpayerConfig describes a single taxpayer and the API keys acting for it.
+type taxpayerConfig struct {
+	Name string `json:"name"`
+	// APIKeys authenticate the callers acting on behalf of this taxpayer.
+	APIKeys []string `json:"apiKeys"`
+	// DeviceID pins the device identifier the token was issued for.
+	DeviceID string `json:"deviceId"`
+	// TokenFile holds the *moynalog.AccessToken as JSON. The gateway writes
+	// refreshed tokens back to it.
+	TokenFile string `json:"tokenFile"`
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, "read config")
+	}
+
+	cfg := &config{Listen: ":8080"}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, errors.Wrap(err, "decode config")
+	}
+
+	if len(cfg.Taxpayers) == 0 {
+		return nil, errors.New("config lists no taxpayers")
+	}
+
+	// A key shared by two taxpayers would issue receipts as whichever of them
+	// is looked up first.
+	owners := make(map[string]int)
+	for i, taxpayer := range cfg.Taxpayers {
+		if len(taxpayer.APIKeys) == 0 {
+			return nil, errors.Errorf("taxpayer[%d] has no API keys", i)
+		}
+		if taxpayer.TokenFile == "" {
+			return nil, errors.Errorf("taxpayer[%d] has no token file", i)
+		}
+		for _, key := range taxpayer.APIKeys {
+			if key == "" {
+				return nil, errors.Errorf("taxpayer[%d] has an empty API key", i)
+			}
+			if owner, ok := owners[key]; ok {
+				return nil, errors.Errorf("taxpayer[%d] reuses an API key of taxpayer[%d]", i, owner)
+			}
+			owners[key] = i
+		}
+	}
+
+	return cfg, nil
+}
+
+// tokenStore persists the access token of one taxpayer in a JSON file.
+type tokenStore struct {
+	mu    sync.Mutex
+	path  string
+	saved *moynalog.AccessToken
+}
+
+func newTokenStore(path string) *tokenStore {
+	return &tokenStore{path: path}
+}
+
+func (s *tokenStore) load() (*moynalog.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if err != nil {
+		return nil, errors.Wrap(err, "read token file")
+	}
+
+	token := new(moynalog.AccessToken)
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, errors.Wrapf(err, "decode token file %s", s.path)
+	}
+	s.saved = token
+
+	return token, nil
+}
+
+// save writes token back unless it is the one already on disk. The client
+// replaces its token on every refresh, so a pointer comparison is enough.
+func (s *tokenStore) save(token *moynalog.AccessToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token == nil || token == s.saved {
+		return nil
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "encode token")
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return err
+	}
+	s.saved = token
+
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary file
+// readable by the owner only, so a crash never loses the refresh token.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create token file")
+	}
+	//nolint:gosec // G104: removing a renamed temporary file fails harmlessly.
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return errors.Wrap(err, "write token file")
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+
+		return errors.Wrap(err, "write token file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "write token file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "replace token file")
+	}
+
+	return nil
+}
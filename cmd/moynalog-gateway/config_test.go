@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shoman4eg/go-moy-nalog/moynalog"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "gateway.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadConfigRejectsSharedKeys(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		taxpayers string
+		wantErr   string
+	}{
+		{
+			"across taxpayers",
+			`{"apiKeys":["a","b"],"tokenFile":"a.json"},{"apiKeys":["b"],"tokenFile":"b.json"}`,
+			"taxpayer[1] reuses an API key of taxpayer[0]",
+		},
+		{"within a taxpayer", `{"apiKeys":["a","a"],"tokenFile":"a.json"}`, "taxpayer[0] reuses"},
+		{"empty key", `{"apiKeys":[""],"tokenFile":"a.json"}`, "empty API key"},
+	}
+	for _, tt := range tests {
+		_, err := loadConfig(writeConfig(t, `{"taxpayers":[`+tt.taxpayers+`]}`))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	cfg, err := loadConfig(writeConfig(t, `{"taxpayers":[{"apiKeys":["a"],"tokenFile":"a.json"},{"apiKeys":["b"],"tokenFile":"b.json"}]}`))
+	if err != nil || len(cfg.Taxpayers) != 2 {
+		t.Errorf("loadConfig = %v, %v, want two taxpayers", cfg, err)
+	}
+}
+
+func TestTokenStoreSave(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.json")
+	if err := os.WriteFile(path, []byte(`{"token":"old","refreshToken":"old"}`), 0o600); err != nil {
+		t.Fatalf("write token file: %v", err)
+	}
+
+	store := newTokenStore(path)
+	if _, err := store.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := store.save(&moynalog.AccessToken{Token: "new", RefreshToken: "rotated"}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	token, err := newTokenStore(path).load()
+	if err != nil || token.RefreshToken != "rotated" {
+		t.Errorf("reloaded token = %+v, %v, want the rotated refresh token", token, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat token file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want no temporary file left", len(entries))
+	}
+}
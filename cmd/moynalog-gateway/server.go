@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/shoman4eg/go-moy-nalog/moynalog"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// maxRequestBody bounds the JSON bodies the gateway accepts.
+const maxRequestBody = 1 << 20
+
+// taxpayer is an upstream account together with the keys acting for it.
+type taxpayer struct {
+	name    string
+	apiKeys []string
+	client  *moynalog.Client
+	tokens  *tokenStore
+}
+
+// gateway exposes the income, invoice, receipt and tax services of every
+// configured taxpayer behind API key authentication.
+type gateway struct {
+	taxpayers []*taxpayer
+	logger    *slog.Logger
+	mux       *http.ServeMux
+}
+
+func newGateway(cfg *config, logger *slog.Logger, opts ...moynalog.Option) (*gateway, error) {
+	g := &gateway{logger: logger, mux: http.NewServeMux()}
+
+	for _, tc := range cfg.Taxpayers {
+		clientOpts := append([]moynalog.Option(nil), opts...)
+		if cfg.Endpoint != "" {
+			clientOpts = append(clientOpts, moynalog.WithEndpoint(cfg.Endpoint))
+		}
+		if tc.DeviceID != "" {
+			clientOpts = append(clientOpts, moynalog.WithDeviceID(tc.DeviceID))
+		}
+
+		tokens := newTokenStore(tc.TokenFile)
+		token, err := tokens.load()
+		if err != nil {
+			return nil, errors.Wrapf(err, "taxpayer %q", tc.Name)
+		}
+
+		g.taxpayers = append(g.taxpayers, &taxpayer{
+			name:    tc.Name,
+			apiKeys: tc.APIKeys,
+			client:  moynalog.NewClient(clientOpts...).WithToken(token),
+			tokens:  tokens,
+		})
+	}
+
+	g.mux.HandleFunc("GET /openapi.json", g.serveOpenAPI)
+	g.handle("POST /v1/incomes", g.createIncome)
+	g.handle("GET /v1/incomes", g.listIncomes)
+	g.handle("POST /v1/incomes/{uuid}/cancel", g.cancelIncome)
+	g.handle("POST /v1/invoices", g.createInvoice)
+	g.handle("GET /v1/receipts/{uuid}", g.getReceipt)
+	g.handle("GET /v1/receipts/{uuid}/print", g.printReceipt)
+	g.handle("GET /v1/taxes", g.getTaxes)
+
+	return g, nil
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// authedHandler serves a request on behalf of an authenticated taxpayer.
+type authedHandler func(w http.ResponseWriter, r *http.Request, tp *taxpayer)
+
+// handle registers h behind API key authentication. Tokens refreshed while
+// serving the request are persisted afterwards.
+func (g *gateway) handle(pattern string, h authedHandler) {
+	g.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		tp := g.authenticate(r)
+		if tp == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "missing or unknown API key")
+
+			return
+		}
+
+		h(w, r, tp)
+
+		if err := tp.tokens.save(tp.client.Token()); err != nil {
+			g.logger.Error("cannot persist refreshed token", "taxpayer", tp.name, "err", err)
+		}
+	})
+}
+
+// authenticate resolves the API key of r, sent either as a bearer token or in
+// the X-API-Key header, to its taxpayer.
+func (g *gateway) authenticate(r *http.Request) *taxpayer {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key == "" {
+		return nil
+	}
+
+	for _, tp := range g.taxpayers {
+		for _, candidate := range tp.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+				return tp
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *gateway) serveOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPIDocument); err != nil {
+		g.logger.Error("cannot write OpenAPI document", "err", err)
+	}
+}
+
+// serviceItem is a receipt or invoice line in a gateway request.
+type serviceItem struct {
+	Name     string          `json:"name"`
+	Amount   decimal.Decimal `json:"amount"`
+	Quantity decimal.Decimal `json:"quantity"`
+}
+
+// incomeRequest is the body of POST /v1/incomes and POST /v1/invoices.
+type incomeRequest struct {
+	Services                        []serviceItem          `json:"services"`
+	OperationTime                   time.Time              `json:"operationTime"`
+	Client                          *moynalog.IncomeClient `json:"client"`
+	PaymentType                     moynalog.PaymentType   `json:"paymentType"`
+	IgnoreMaxTotalIncomeRestriction bool                   `json:"ignoreMaxTotalIncomeRestriction"`
+}
+
+func (g *gateway) createIncome(w http.ResponseWriter, r *http.Request, tp *taxpayer) {
+	body := new(incomeRequest)
+	if !decodeBody(w, r, body) {
+		return
+	}
+
+	income := &moynalog.IncomeCreateRequest{
+		OperationTime:                   body.OperationTime,
+		Client:                          body.Client,
+		PaymentType:                     body.PaymentType,
+		IgnoreMaxTotalIncomeRestriction: body.IgnoreMaxTotalIncomeRestriction,
+	}
+	for _, item := range body.Services {
+		income.Services = append(income.Services, moynalog.IncomeServiceItem(item))
+	}
+
+	created, _, err := tp.client.Income.Create(r.Context(), income)
+	if err != nil {
+		g.writeUpstreamError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (g *gateway) createInvoice(w http.ResponseWriter, r *http.Request, tp *taxpayer) {
+	body := new(incomeRequest)
+	if !decodeBody(w, r, body) {
+		return
+	}
+
+	invoice := &moynalog.InvoiceCreateRequest{
+		OperationTime:                   body.OperationTime,
+		Client:                          body.Client,
+		IgnoreMaxTotalIncomeRestriction: body.IgnoreMaxTotalIncomeRestriction,
+	}
+	for i, item := range body.Services {
+		invoice.Services = append(invoice.Services, moynalog.InvoiceServiceItem{
+			Name:          item.Name,
+			Amount:        item.Amount,
+			Quantity:      item.Quantity,
+			ServiceNumber: i,
+		})
+	}
+
+	created, _, err := tp.client.Invoice.Create(r.Context(), invoice)
+	if err != nil {
+		g.writeUpstreamError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (g *gateway) listIncomes(w http.ResponseWriter, r *http.Request, tp *taxpayer) {
+	opts, err := listOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_query", err.Error())
+
+		return
+	}
+
+	list, _, err := tp.client.Income.List(r.Context(), opts)
+	if err != nil {
+		g.writeUpstreamError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func listOptions(query url.Values) (*moynalog.IncomeListOptions, error) {
+	opts := &moynalog.IncomeListOptions{
+		SortBy:      moynalog.SortBy(query.Get("sortBy")),
+		BuyerType:   moynalog.BuyerType(query.Get("buyerType")),
+		ReceiptType: moynalog.ReceiptType(query.Get("receiptType")),
+	}
+
+	for key, target := range map[string]*moynalog.Time{"from": &opts.From, "to": &opts.To} {
+		if raw := query.Get(key); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, errors.Errorf("%s must be an RFC 3339 timestamp", key)
+			}
+			*target = moynalog.NewTime(parsed)
+		}
+	}
+
+	for key, target := range map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset} {
+		if raw := query.Get(key); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 0 {
+				return nil, errors.Errorf("%s must be a non-negative integer", key)
+			}
+			*target = parsed
+		}
+	}
+
+	return opts, nil
+}
+
+// cancelRequest is the body of POST /v1/incomes/{uuid}/cancel.
+type cancelRequest struct {
+	// Reason is "mistake" or "refund".
+	Reason        string    `json:"reason"`
+	OperationTime time.Time `json:"operationTime"`
+}
+
+var cancelReasons = map[string]moynalog.CancelComment{
+	"mistake": moynalog.CancelCommentMistake,
+	"refund":  moynalog.CancelCommentRefund,
+}
+
+func (g *gateway) cancelIncome(w http.ResponseWriter, r *http.Request, tp *taxpayer) {
+	body := new(cancelRequest)
+	if !decodeBody(w, r, body) {
+		return
+	}
+
+	comment, ok := cancelReasons[body.Reason]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_reason", `reason must be "mistake" or "refund"`)
+
+		return
+	}
+
+	cancelled, _, err := tp.client.Income.Cancel(r.Context(), &moynalog.IncomeCancelRequest{
+		ReceiptUUID:   r.PathValue("uuid"),
+		Comment:       comment,
+		OperationTime: body.OperationTime,
+	})
+	if err != nil {
+		g.writeUpstreamError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cancelled)
+}
+
+func (g *gateway) getReceipt(w http.ResponseWriter, r *http.Request, tp *taxpayer) {
+	receipt, _, err := tp.client.Receipt.JSON(r.Context(), r.PathValue("uuid"))
+	if err != nil {
+		g.writeUpstreamError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, receipt)
+}
+
+func (g *gateway) printReceipt(w http.ResponseWriter, r *http.Request, tp *taxpayer) {
+	pdf, _, err := tp.client.Receipt.Print(r.Context(), r.PathValue("uuid"))
+	if err != nil {
+		g.writeUpstreamError(w, r, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	if _, err := w.Write(pdf); err != nil {
+		g.logger.Error("cannot write receipt", "err", err)
+	}
+}
+
+func (g *gateway) getTaxes(w http.ResponseWriter, r *http.Request, tp *taxpayer) {
+	tax, _, err := tp.client.Tax.Get(r.Context())
+	if err != nil {
+		g.writeUpstreamError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tax)
+}
+
+// writeUpstreamError translates a client error into a gateway response. Only
+// input the client rejected itself, moynalog.ErrInvalidArgument, is the
+// caller's fault; an open circuit is a temporary outage and anything else,
+// an unreadable response or a failed counterparty lookup included, is reported
+// as a bad gateway.
+func (g *gateway) writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		errResp *moynalog.ErrorResponse
+		urlErr  *url.Error
+		netErr  net.Error
+	)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "upstream_timeout", err.Error())
+	case errors.Is(err, moynalog.ErrCircuitOpen):
+		writeError(w, http.StatusServiceUnavailable, "upstream_unavailable", err.Error())
+	case errors.Is(err, moynalog.ErrNotImplemented):
+		writeError(w, http.StatusNotImplemented, "not_implemented", err.Error())
+	case errors.Is(err, moynalog.ErrInvalidArgument):
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+	case errors.As(err, &errResp):
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, moynalog.ErrValidation):
+			status = http.StatusUnprocessableEntity
+		case errors.Is(err, moynalog.ErrNotFound):
+			status = http.StatusNotFound
+		}
+		writeError(w, status, "upstream_error", errResp.Error())
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		writeError(w, http.StatusBadGateway, "upstream_unreachable", err.Error())
+	default:
+		writeError(w, http.StatusBadGateway, "upstream_error", err.Error())
+	}
+
+	g.logger.Warn("request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:gosec // G104: the status line is already out; nothing to report to.
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shoman4eg/go-moy-nalog/moynalog"
+)
+
+// setupGateway starts a fake upstream API and a gateway in front of it, with a
+// single taxpayer reachable through the "key" API key. opts configure the
+// upstream client.
+func setupGateway(t *testing.T, opts ...moynalog.Option) (*httptest.Server, *http.ServeMux, string) {
+	t.Helper()
+
+	upstreamMux := http.NewServeMux()
+	upstream := httptest.NewServer(upstreamMux)
+	t.Cleanup(upstream.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token.json")
+	token := `{"token":"access","refreshToken":"refresh","profile":{"inn":"770000000000"}}`
+	if err := os.WriteFile(tokenFile, []byte(token), 0o600); err != nil {
+		t.Fatalf("write token file: %v", err)
+	}
+
+	cfg := &config{
+		Endpoint: upstream.URL,
+		Taxpayers: []taxpayerConfig{
+			{Name: "ivanov", APIKeys: []string{"key"}, DeviceID: "device", TokenFile: tokenFile},
+		},
+	}
+	handler, err := newGateway(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), opts...)
+	if err != nil {
+		t.Fatalf("newGateway: %v", err)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server, upstreamMux, tokenFile
+}
+
+func do(t *testing.T, method, url, apiKey, body string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := new(http.Client).Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+
+	return resp, string(raw)
+}
+
+func TestGatewayRejectsUnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	server, _, _ := setupGateway(t)
+
+	for _, key := range []string{"", "wrong"} {
+		resp, _ := do(t, http.MethodGet, server.URL+"/v1/taxes", key, "")
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("key %q: status = %d, want %d", key, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestGatewayCreateIncome(t *testing.T) {
+	t.Parallel()
+
+	server, upstream, _ := setupGateway(t)
+	upstream.HandleFunc("/v1/income", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer access" {
+			t.Errorf("upstream Authorization = %q, want the taxpayer token", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"approvedReceiptUuid":"r1"}`)
+	})
+
+	resp, body := do(t, http.MethodPost, server.URL+"/v1/incomes", "key",
+		`{"services":[{"name":"Услуга","amount":100.5,"quantity":2}],"paymentType":"ACCOUNT"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusCreated, body)
+	}
+
+	created := new(moynalog.IncomeCreated)
+	if err := json.Unmarshal([]byte(body), created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if created.ApprovedReceiptUUID != "r1" {
+		t.Errorf("ApprovedReceiptUUID = %q, want %q", created.ApprovedReceiptUUID, "r1")
+	}
+}
+
+func TestGatewayErrors(t *testing.T) {
+	t.Parallel()
+
+	server, upstream, _ := setupGateway(t)
+	upstream.HandleFunc("/v1/receipt/770000000000/missing/json", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	upstream.HandleFunc("/v1/taxes", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"local validation", http.MethodPost, "/v1/incomes", `{"services":[]}`, http.StatusBadRequest},
+		{"malformed body", http.MethodPost, "/v1/incomes", `{"services":`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/v1/incomes", `{"service":[]}`, http.StatusBadRequest},
+		{"bad cancel reason", http.MethodPost, "/v1/incomes/r1/cancel", `{"reason":"oops"}`, http.StatusBadRequest},
+		{"bad query", http.MethodGet, "/v1/incomes?limit=x", "", http.StatusBadRequest},
+		{"upstream not found", http.MethodGet, "/v1/receipts/missing", "", http.StatusNotFound},
+		{"upstream failure", http.MethodGet, "/v1/taxes", "", http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, body := do(t, tt.method, server.URL+tt.path, "key", tt.body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if !strings.Contains(body, `"code"`) {
+				t.Errorf("body = %s, want an error object", body)
+			}
+		})
+	}
+}
+
+func TestGatewayUpstreamOutages(t *testing.T) {
+	t.Parallel()
+
+	breaker := moynalog.NewCircuitBreaker(moynalog.WithCircuitThreshold(1), moynalog.WithCircuitCooldown(time.Hour))
+	server, upstream, _ := setupGateway(t, moynalog.WithCircuitBreaker(breaker))
+	upstream.HandleFunc("/v1/taxes", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	for _, want := range []int{http.StatusBadGateway, http.StatusServiceUnavailable} {
+		resp, body := do(t, http.MethodGet, server.URL+"/v1/taxes", "key", "")
+		if resp.StatusCode != want {
+			t.Errorf("status = %d, want %d: %s", resp.StatusCode, want, body)
+		}
+	}
+}
+
+func TestGatewayUpstreamUnreachable(t *testing.T) {
+	t.Parallel()
+
+	server, upstream, _ := setupGateway(t)
+	upstream.HandleFunc("/v1/taxes", func(w http.ResponseWriter, _ *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+
+			return
+		}
+		_ = conn.Close()
+	})
+
+	resp, body := do(t, http.MethodGet, server.URL+"/v1/taxes", "key", "")
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(body, "upstream_unreachable") {
+		t.Errorf("status = %d, want %d upstream_unreachable: %s", resp.StatusCode, http.StatusBadGateway, body)
+	}
+}
+
+// A response the client cannot read is the upstream's fault, not the caller's.
+func TestGatewayUpstreamGarbage(t *testing.T) {
+	t.Parallel()
+
+	server, upstream, _ := setupGateway(t)
+	upstream.HandleFunc("/v1/taxes", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"taxPeriodId":`)
+	})
+
+	resp, body := do(t, http.MethodGet, server.URL+"/v1/taxes", "key", "")
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(body, "upstream_error") {
+		t.Errorf("status = %d, want %d upstream_error: %s", resp.StatusCode, http.StatusBadGateway, body)
+	}
+}
+
+// A token refreshed while serving a request must survive a restart.
+func TestGatewayPersistsRefreshedToken(t *testing.T) {
+	t.Parallel()
+
+	server, upstream, tokenFile := setupGateway(t)
+	upstream.HandleFunc("/v1/taxes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"taxPeriodId":202409}`)
+	})
+	upstream.HandleFunc("/v1/auth/token", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"token":"fresh"}`)
+	})
+
+	resp, body := do(t, http.MethodGet, server.URL+"/v1/taxes", "key", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusOK, body)
+	}
+
+	persisted, err := newTokenStore(tokenFile).load()
+	if err != nil {
+		t.Fatalf("load token: %v", err)
+	}
+	if persisted.Token != "fresh" || persisted.RefreshToken != "refresh" {
+		t.Errorf("persisted token = %+v, want the refreshed one", persisted)
+	}
+}
+
+func TestGatewayServesOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	server, _, _ := setupGateway(t)
+
+	resp, body := do(t, http.MethodGet, server.URL+"/openapi.json", "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	document := struct {
+		Paths map[string]any `json:"paths"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		t.Fatalf("decode OpenAPI document: %v", err)
+	}
+	for _, path := range []string{"/v1/incomes", "/v1/incomes/{uuid}/cancel", "/v1/invoices", "/v1/receipts/{uuid}", "/v1/receipts/{uuid}/print", "/v1/taxes"} {
+		if _, ok := document.Paths[path]; !ok {
+			t.Errorf("OpenAPI document does not describe %s", path)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package moynalog
+
+import (
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// RoundingMode is how an AmountPolicy brings amounts to kopecks.
+type RoundingMode int
+
+// Supported rounding modes.
+const (
+	// RoundingNone sends amounts as they are, leaving fractions of a kopeck
+	// to the API.
+	RoundingNone RoundingMode = iota
+	// RoundingReject refuses amounts with fractions of a kopeck.
+	RoundingReject
+	// RoundingHalfUp rounds half away from zero: 100.005 becomes 100.01.
+	RoundingHalfUp
+	// RoundingHalfEven rounds half to even (banker's rounding): 100.005
+	// becomes 100.00 and 100.015 becomes 100.02.
+	RoundingHalfEven
+)
+
+// AmountPolicy decides which receipt and invoice amounts are sent to the API
+// and how they are rounded. The API works in kopecks and either rejects finer
+// amounts or rounds them its own way, so they are dealt with before a request
+// is built.
+type AmountPolicy struct {
+	// Rounding applies to unit prices and line totals with fractions of a
+	// kopeck.
+	Rounding RoundingMode
+	// QuantityPlaces is the most decimal places a quantity may have. Zero
+	// means no limit. Quantities are never rounded.
+	QuantityPlaces int32
+	// MaxTotalAmount is the largest total a receipt or invoice may have.
+	// Zero means no limit.
+	MaxTotalAmount decimal.Decimal
+}
+
+// DefaultAmountPolicy checks nothing: amounts are sent as they are, as they
+// were before AmountPolicy existed. Set RoundingReject or a rounding mode
+// with WithAmountPolicy to deal with fractions of a kopeck locally.
+func DefaultAmountPolicy() AmountPolicy {
+	return AmountPolicy{Rounding: RoundingNone}
+}
+
+// WithAmountPolicy replaces DefaultAmountPolicy for IncomeService.Create and
+// InvoiceService.Create.
+func WithAmountPolicy(policy AmountPolicy) Option {
+	return func(c *Client) {
+		c.amountPolicy = policy
+	}
+}
+
+// line checks line i, with a unit price of amount, and returns the price and
+// the line total rounded to kopecks.
+func (p AmountPolicy) line(i int, amount, quantity decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	if !p.Rounding.valid() {
+		return decimal.Zero, decimal.Zero, errors.Errorf("moynalog: rounding mode %d is invalid", p.Rounding)
+	}
+	if p.QuantityPlaces > 0 && decimalPlaces(quantity) > p.QuantityPlaces {
+		return decimal.Zero, decimal.Zero, invalidArgument("moynalog: quantity of item[%d] %s has more than %d decimal places",
+			i, quantity, p.QuantityPlaces)
+	}
+
+	rounded, ok := p.round(amount)
+	if !ok {
+		return decimal.Zero, decimal.Zero, invalidArgument("moynalog: amount of item[%d] %s has fractions of a kopeck", i, amount)
+	}
+	if !rounded.IsPositive() {
+		return decimal.Zero, decimal.Zero, invalidArgument("moynalog: amount of item[%d] %s rounds to 0", i, amount)
+	}
+
+	total, ok := p.round(rounded.Mul(quantity))
+	if !ok {
+		return decimal.Zero, decimal.Zero, invalidArgument("moynalog: total of item[%d], %s × %s, has fractions of a kopeck",
+			i, rounded, quantity)
+	}
+
+	return rounded, total, nil
+}
+
+// checkTotal checks the total of a receipt or an invoice against the limit.
+func (p AmountPolicy) checkTotal(total decimal.Decimal) error {
+	if p.MaxTotalAmount.IsPositive() && total.GreaterThan(p.MaxTotalAmount) {
+		return invalidArgument("moynalog: total amount %s exceeds the limit of %s", total, p.MaxTotalAmount)
+	}
+
+	return nil
+}
+
+// round returns amount in kopecks, or false when the policy rejects it.
+func (p AmountPolicy) round(amount decimal.Decimal) (decimal.Decimal, bool) {
+	if p.Rounding == RoundingNone || decimalPlaces(amount) <= amountPlaces {
+		return amount, true
+	}
+
+	switch p.Rounding {
+	case RoundingHalfUp:
+		return amount.Round(amountPlaces), true
+	case RoundingHalfEven:
+		return amount.RoundBank(amountPlaces), true
+	default:
+		return amount, false
+	}
+}
+
+func (m RoundingMode) valid() bool {
+	return m >= RoundingNone && m <= RoundingHalfEven
+}
+
+// decimalPlaces returns the number of significant decimal places of d, so
+// 1.500 has one.
+func decimalPlaces(d decimal.Decimal) int32 {
+	for places := int32(0); ; places++ {
+		if d.Equal(d.Truncate(places)) {
+			return places
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestAmountPolicyLine(t *testing.T) {
+	t.Parallel()
+
+	rejecting := AmountPolicy{Rounding: RoundingReject, QuantityPlaces: 3}
+
+	tests := []struct {
+		name      string
+		policy    AmountPolicy
+		amount    string
+		quantity  string
+		wantPrice string
+		wantTotal string
+		wantErr   bool
+	}{
+		{"default passes fractions", DefaultAmountPolicy(), "100.005", "0.000001", "100.005", "0.000100005", false},
+		{"kopecks pass", rejecting, "100.50", "2", "100.5", "201", false},
+		{"trailing zeros are not places", rejecting, "100.5000", "1.500", "100.5", "150.75", false},
+		{"fraction of a kopeck rejected", rejecting, "100.005", "1", "", "", true},
+		{"fractional total rejected", rejecting, "0.33", "1.5", "", "", true},
+		{"too precise quantity", rejecting, "100", "0.000001", "", "", true},
+		{"half up", AmountPolicy{Rounding: RoundingHalfUp}, "100.005", "1", "100.01", "100.01", false},
+		{"half even down", AmountPolicy{Rounding: RoundingHalfEven}, "100.005", "1", "100", "100", false},
+		{"half even up", AmountPolicy{Rounding: RoundingHalfEven}, "100.015", "1", "100.02", "100.02", false},
+		{"rounded total", AmountPolicy{Rounding: RoundingHalfUp, QuantityPlaces: 1}, "0.33", "1.5", "0.33", "0.5", false},
+		{"rounds to nothing", AmountPolicy{Rounding: RoundingHalfUp}, "0.004", "1", "", "", true},
+		{"unknown mode", AmountPolicy{Rounding: RoundingMode(7)}, "1", "1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		price, total, err := tt.policy.line(0, decimal.RequireFromString(tt.amount), decimal.RequireFromString(tt.quantity))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: line = %s, %s, want an error", tt.name, price, total)
+			}
+
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: line: %v", tt.name, err)
+
+			continue
+		}
+		if price.String() != tt.wantPrice || total.String() != tt.wantTotal {
+			t.Errorf("%s: line = %s, %s, want %s, %s", tt.name, price, total, tt.wantPrice, tt.wantTotal)
+		}
+	}
+}
+
+func TestIncomeCreateRoundsAmounts(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	client.amountPolicy = AmountPolicy{Rounding: RoundingHalfUp, QuantityPlaces: 3}
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, r *http.Request) {
+		body := testBody(t, r)
+		if body["totalAmount"] != "201.02" {
+			t.Errorf("totalAmount = %v, want 201.02", body["totalAmount"])
+		}
+		services, _ := body["services"].([]any)
+		if line, _ := services[0].(map[string]any); line["amount"] != 100.51 {
+			t.Errorf("services = %v, want the amount rounded to 100.51", services)
+		}
+		writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"r1"}`)
+	})
+
+	services := []IncomeServiceItem{{Name: "Услуга", Amount: decimal.RequireFromString("100.505"), Quantity: decimal.NewFromInt(2)}}
+	if _, _, err := client.Income.Create(context.Background(), &IncomeCreateRequest{Services: services}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if services[0].Amount.String() != "100.505" {
+		t.Errorf("Amount = %s, the caller's lines must not be modified", services[0].Amount)
+	}
+}
+
+func TestCreateRejectsAmounts(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	client.amountPolicy = AmountPolicy{Rounding: RoundingReject, QuantityPlaces: 3}
+	mux.HandleFunc("/", func(_ http.ResponseWriter, r *http.Request) {
+		t.Errorf("no request should have been sent, got %s", r.URL)
+	})
+	ctx := context.Background()
+
+	_, _, err := client.Income.CreateItem(ctx, "Услуга", decimal.RequireFromString("100.005"), decimal.NewFromInt(1))
+	assertLocalError(t, err)
+	_, _, err = client.Invoice.CreateItem(ctx, "Услуга", decimal.NewFromInt(1), decimal.RequireFromString("0.0001"))
+	assertLocalError(t, err)
+
+	client.amountPolicy.MaxTotalAmount = decimal.NewFromInt(1000)
+	_, _, err = client.Income.CreateItem(ctx, "Услуга", decimal.NewFromInt(500), decimal.NewFromInt(3))
+	assertLocalError(t, err)
+	_, _, err = client.Invoice.CreateItem(ctx, "Услуга", decimal.NewFromInt(500), decimal.NewFromInt(3))
+	assertLocalError(t, err)
+}
+
+// By default amounts go out as the caller gave them, as before AmountPolicy.
+func TestIncomeCreateDefaultPolicy(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, r *http.Request) {
+		if body := testBody(t, r); body["totalAmount"] != "201.01" {
+			t.Errorf("totalAmount = %v, want 201.01", body["totalAmount"])
+		}
+		writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"r1"}`)
+	})
+
+	_, _, err := client.Income.CreateItem(context.Background(), "Услуга", decimal.RequireFromString("100.505"), decimal.NewFromInt(2))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
+// The policy must survive deriving an authenticated client.
+func TestWithAmountPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := AmountPolicy{Rounding: RoundingHalfEven, QuantityPlaces: 6}
+	client := NewClient(WithAmountPolicy(policy)).WithToken(&AccessToken{Token: "access"})
+	if client.amountPolicy.Rounding != RoundingHalfEven || client.amountPolicy.QuantityPlaces != 6 {
+		t.Errorf("amountPolicy = %+v, want %+v", client.amountPolicy, policy)
+	}
+}
@@ -232,13 +232,13 @@ func TestAuthRefreshRejectsUnusableTokens(t *testing.T) {
 
 	// A missing refresh token is reported as such, not as a generic 401.
 	_, _, err := client.Auth.Refresh(context.Background(), nil)
-	assertLocalError(t, err)
+	assertNotSent(t, err)
 	if !errors.Is(err, errNoAccessToken) {
 		t.Errorf("error = %v, want errNoAccessToken", err)
 	}
 
 	_, _, err = client.Auth.Refresh(context.Background(), &AccessToken{Token: "t"})
-	assertLocalError(t, err)
+	assertNotSent(t, err)
 	if !errors.Is(err, errNoAccessToken) {
 		t.Errorf("error = %v, want errNoAccessToken", err)
 	}
@@ -248,7 +248,7 @@ func TestAuthRefreshRejectsUnusableTokens(t *testing.T) {
 		RefreshTokenExpiresIn: NewTime(time.Now().Add(-time.Hour)),
 	}
 	_, _, err = client.Auth.Refresh(context.Background(), expired)
-	assertLocalError(t, err)
+	assertNotSent(t, err)
 	if !errors.Is(err, ErrUnauthorized) {
 		t.Errorf("error = %v, want ErrUnauthorized", err)
 	}
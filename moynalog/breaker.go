@@ -0,0 +1,255 @@
+package moynalog
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultCircuitThreshold = 5
+	defaultCircuitCooldown  = 30 * time.Second
+	defaultCircuitProbes    = 1
+)
+
+// CircuitState is the state of the circuit of one endpoint.
+type CircuitState int
+
+// Supported circuit states.
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every request with ErrCircuitOpen until the cooldown
+	// is over.
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through after the cooldown:
+	// the circuit closes when one succeeds and opens again when one fails.
+	CircuitHalfOpen
+)
+
+// String returns the state name.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops requests to an endpoint the API keeps failing on, such
+// as during the maintenance windows of lknpd.nalog.ru, instead of flooding it
+// with calls bound to fail. Endpoints are told apart by method and path, with
+// the path segments carrying identifiers folded, so every
+// GET /receipt/{inn}/{uuid}/json shares a circuit.
+//
+// Transport failures and 5xx responses count as failures; a cancelled context
+// counts as nothing. It is safe for concurrent use and may be shared by
+// several clients.
+type CircuitBreaker struct {
+	threshold     int
+	cooldown      time.Duration
+	probes        int
+	onStateChange func(endpoint string, from, to CircuitState)
+	now           func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of a single endpoint.
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  int
+}
+
+// CircuitBreakerOption customises a CircuitBreaker.
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// WithCircuitThreshold sets how many consecutive failures open the circuit.
+// Defaults to 5.
+func WithCircuitThreshold(failures int) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		if failures > 0 {
+			b.threshold = failures
+		}
+	}
+}
+
+// WithCircuitCooldown sets how long an open circuit fails fast before probe
+// requests are let through. Defaults to 30 seconds.
+func WithCircuitCooldown(cooldown time.Duration) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		if cooldown > 0 {
+			b.cooldown = cooldown
+		}
+	}
+}
+
+// WithCircuitProbes sets how many probe requests a half-open circuit lets
+// through at once. Defaults to 1.
+func WithCircuitProbes(probes int) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		if probes > 0 {
+			b.probes = probes
+		}
+	}
+}
+
+// WithCircuitStateChange calls fn whenever the circuit of an endpoint changes
+// state, for logging or metrics. fn runs with the breaker locked and must not
+// call back into it.
+func WithCircuitStateChange(fn func(endpoint string, from, to CircuitState)) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		b.onStateChange = fn
+	}
+}
+
+// NewCircuitBreaker returns a breaker with every circuit closed.
+func NewCircuitBreaker(opts ...CircuitBreakerOption) *CircuitBreaker {
+	b := &CircuitBreaker{
+		threshold: defaultCircuitThreshold,
+		cooldown:  defaultCircuitCooldown,
+		probes:    defaultCircuitProbes,
+		now:       time.Now,
+		circuits:  make(map[string]*circuit),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// WithCircuitBreaker guards every request of the client with breaker. A
+// request to an endpoint whose circuit is open fails with ErrCircuitOpen
+// without reaching the API. Receipts can be queued meanwhile, see
+// WithReceiptQueue.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(c *Client) {
+		c.breaker = breaker
+	}
+}
+
+// State returns the state of the circuit of endpoint, written as in
+// ErrCircuitOpen errors, such as "POST /income".
+func (b *CircuitBreaker) State(endpoint string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuit, ok := b.circuits[endpoint]
+	if !ok {
+		return CircuitClosed
+	}
+	if circuit.state == CircuitOpen && !b.now().Before(circuit.openedAt.Add(b.cooldown)) {
+		return CircuitHalfOpen
+	}
+
+	return circuit.state
+}
+
+// allow reports whether a request to endpoint may go out. A nil error must be
+// followed by a call to done.
+func (b *CircuitBreaker) allow(endpoint string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(endpoint)
+	if c.state == CircuitOpen {
+		if b.now().Before(c.openedAt.Add(b.cooldown)) {
+			return errors.Wrap(ErrCircuitOpen, endpoint)
+		}
+		b.transition(endpoint, c, CircuitHalfOpen)
+	}
+	if c.state == CircuitHalfOpen {
+		if c.probing >= b.probes {
+			return errors.Wrap(ErrCircuitOpen, endpoint)
+		}
+		c.probing++
+	}
+
+	return nil
+}
+
+// circuitOutcome is how a request let through by allow ended.
+type circuitOutcome int
+
+const (
+	circuitSuccess circuitOutcome = iota
+	circuitFailure
+	// circuitIgnored releases a probe without judging the endpoint, for
+	// requests cancelled by the caller.
+	circuitIgnored
+)
+
+// done records the outcome of a request let through by allow.
+func (b *CircuitBreaker) done(endpoint string, outcome circuitOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(endpoint)
+	if c.state == CircuitHalfOpen && c.probing > 0 {
+		c.probing--
+	}
+
+	switch outcome {
+	case circuitSuccess:
+		c.failures = 0
+		if c.state != CircuitClosed {
+			b.transition(endpoint, c, CircuitClosed)
+		}
+	case circuitFailure:
+		c.failures++
+		if c.state == CircuitHalfOpen || (c.state == CircuitClosed && c.failures >= b.threshold) {
+			c.openedAt = b.now()
+			b.transition(endpoint, c, CircuitOpen)
+		}
+	case circuitIgnored:
+	}
+}
+
+func (b *CircuitBreaker) circuit(endpoint string) *circuit {
+	c, ok := b.circuits[endpoint]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[endpoint] = c
+	}
+
+	return c
+}
+
+func (b *CircuitBreaker) transition(endpoint string, c *circuit, to CircuitState) {
+	from := c.state
+	c.state = to
+	if to != CircuitHalfOpen {
+		c.probing = 0
+	}
+	if b.onStateChange != nil {
+		b.onStateChange(endpoint, from, to)
+	}
+}
+
+// circuitEndpoint returns the circuit key of req: its method and its path
+// relative to the API root, with every segment carrying a digit, an INN or a
+// receipt UUID for instance, replaced by "*".
+func (c *Client) circuitEndpoint(req *http.Request) string {
+	segments := strings.Split(strings.TrimPrefix(req.URL.Path, c.BaseURL.Path), "/")
+	for i, segment := range segments {
+		if strings.IndexFunc(segment, unicode.IsDigit) >= 0 {
+			segments[i] = "*"
+		}
+	}
+
+	return req.Method + " /" + strings.Join(segments, "/")
+}
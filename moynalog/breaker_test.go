@@ -0,0 +1,229 @@
+package moynalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fakeClock is a settable now function.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(opts ...CircuitBreakerOption) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, time.October, 19, 12, 0, 0, 0, moscow)}
+	breaker := NewCircuitBreaker(opts...)
+	breaker.now = clock.Now
+
+	return breaker, clock
+}
+
+// setupBreaker returns an authenticated client guarded by breaker, together
+// with the mux and the server behind it.
+func setupBreaker(t *testing.T, breaker *CircuitBreaker) (*Client, *http.ServeMux, *httptest.Server) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := NewClient(WithEndpoint(server.URL), WithDeviceID("testdeviceid"), WithCircuitBreaker(breaker))
+
+	return client.WithToken(&AccessToken{Token: "access-token"}), mux, server
+}
+
+func get(client *Client, path string) error {
+	req, err := client.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(context.Background(), req, nil)
+
+	return err
+}
+
+func TestCircuitBreakerOpensAndHalfOpens(t *testing.T) {
+	t.Parallel()
+
+	var transitions []string
+	breaker, clock := newTestBreaker(WithCircuitThreshold(3), WithCircuitCooldown(time.Minute),
+		WithCircuitStateChange(func(endpoint string, from, to CircuitState) {
+			transitions = append(transitions, fmt.Sprintf("%s %s->%s", endpoint, from, to))
+		}))
+	client, mux, _ := setupBreaker(t, breaker)
+
+	var hits, healthy atomic.Int32
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		if healthy.Load() == 0 {
+			writeJSON(t, w, http.StatusServiceUnavailable, `{"message":"maintenance"}`)
+
+			return
+		}
+		writeJSON(t, w, http.StatusOK, `{}`)
+	})
+	mux.HandleFunc("/v1/user", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{}`)
+	})
+
+	for range 3 {
+		if err := get(client, "income"); errors.Is(err, ErrCircuitOpen) || err == nil {
+			t.Fatalf("get = %v, want the server error", err)
+		}
+	}
+	if state := breaker.State("GET /income"); state != CircuitOpen {
+		t.Fatalf("State = %s, want open", state)
+	}
+
+	if err := get(client, "income"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("get while open = %v, want ErrCircuitOpen", err)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("hits = %d, an open circuit must not reach the API", hits.Load())
+	}
+	if err := get(client, "user"); err != nil {
+		t.Errorf("other endpoint = %v, want its circuit closed", err)
+	}
+
+	// A failed probe opens the circuit again for another cooldown.
+	clock.Advance(time.Minute)
+	if state := breaker.State("GET /income"); state != CircuitHalfOpen {
+		t.Errorf("State after cooldown = %s, want half-open", state)
+	}
+	if err := get(client, "income"); errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("probe = %v, want it sent", err)
+	}
+	if err := get(client, "income"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("get after a failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// A successful probe closes it.
+	clock.Advance(time.Minute)
+	healthy.Store(1)
+	if err := get(client, "income"); err != nil {
+		t.Fatalf("probe = %v, want success", err)
+	}
+	if state := breaker.State("GET /income"); state != CircuitClosed {
+		t.Errorf("State after a successful probe = %s, want closed", state)
+	}
+
+	want := []string{
+		"GET /income closed->open",
+		"GET /income open->half-open", "GET /income half-open->open",
+		"GET /income open->half-open", "GET /income half-open->closed",
+	}
+	if fmt.Sprint(transitions) != fmt.Sprint(want) {
+		t.Errorf("transitions = %q, want %q", transitions, want)
+	}
+}
+
+func TestCircuitBreakerCountsConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+
+	breaker, _ := newTestBreaker(WithCircuitThreshold(2))
+	client, mux, _ := setupBreaker(t, breaker)
+
+	var calls atomic.Int32
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, _ *http.Request) {
+		switch calls.Add(1) {
+		case 2:
+			writeJSON(t, w, http.StatusOK, `{}`)
+		case 4:
+			// Client errors say nothing about the health of the API.
+			writeJSON(t, w, http.StatusBadRequest, `{}`)
+		default:
+			writeJSON(t, w, http.StatusInternalServerError, `{}`)
+		}
+	})
+
+	for range 4 {
+		_ = get(client, "income")
+	}
+	if state := breaker.State("GET /income"); state != CircuitClosed {
+		t.Errorf("State = %s, want closed while failures are not consecutive", state)
+	}
+	_ = get(client, "income")
+	_ = get(client, "income")
+	if state := breaker.State("GET /income"); state != CircuitOpen {
+		t.Errorf("State = %s, want open after two consecutive failures", state)
+	}
+}
+
+func TestCircuitBreakerTransportFailures(t *testing.T) {
+	t.Parallel()
+
+	breaker, _ := newTestBreaker(WithCircuitThreshold(2))
+	client, _, server := setupBreaker(t, breaker)
+	server.Close()
+
+	for range 2 {
+		if err := get(client, "income"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("get = %v, want the transport error", err)
+		}
+	}
+	if err := get(client, "income"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("get = %v, want ErrCircuitOpen after transport failures", err)
+	}
+}
+
+func TestCircuitBreakerLimitsProbes(t *testing.T) {
+	t.Parallel()
+
+	breaker, clock := newTestBreaker(WithCircuitThreshold(1), WithCircuitCooldown(time.Second))
+	const endpoint = "POST /income"
+
+	if err := breaker.allow(endpoint); err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	breaker.done(endpoint, circuitFailure)
+
+	clock.Advance(time.Second)
+	if err := breaker.allow(endpoint); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := breaker.allow(endpoint); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// A cancelled probe frees its slot without judging the endpoint.
+	breaker.done(endpoint, circuitIgnored)
+	if err := breaker.allow(endpoint); err != nil {
+		t.Errorf("probe after a cancelled one = %v, want it allowed", err)
+	}
+}
+
+func TestCircuitEndpoint(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient()
+	req, err := client.NewRequest(http.MethodGet, "receipt/500100732259/200abc12/json", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if got := client.circuitEndpoint(req); got != "GET /receipt/*/*/json" {
+		t.Errorf("circuitEndpoint = %q, want identifiers folded", got)
+	}
+}
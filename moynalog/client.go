@@ -12,6 +12,7 @@
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/go-querystring/query"
 	"github.com/pkg/errors"
@@ -74,6 +75,16 @@ type Client struct {
 	tokenMu sync.RWMutex
 	token   *AccessToken
 
+	linkRecorder   ReceiptLinkRecorder
+	counterparties CounterpartyResolver
+	rates          RateProvider
+	amountPolicy   AmountPolicy
+	location       *time.Location
+	strictDecoding bool
+	onSchemaDrift  SchemaDriftFunc
+	breaker        *CircuitBreaker
+	receiptQueue   ReceiptQueue
+
 	common service // Reuse a single struct instead of allocating one per service.
 
 	// Services used for talking to the different parts of the API.
@@ -151,6 +162,28 @@ func WithDeviceIDGenerator(generator DeviceIDGenerator) Option {
 	}
 }
 
+// WithReceiptLinkRecorder records which receipt replaced which whenever
+// IncomeService.Reissue or IncomeService.Refund cancels one and registers
+// another in its place.
+func WithReceiptLinkRecorder(recorder ReceiptLinkRecorder) Option {
+	return func(c *Client) {
+		c.linkRecorder = recorder
+	}
+}
+
+// WithLocation sets the time zone requests are built in, which defaults to
+// Europe/Moscow, the one the API works in: operation and request times are
+// sent in it, listing filters are expressed in it and Date builds days in it.
+// Tax periods stay Moscow months and zone-less timestamps in responses are
+// read as Moscow time whatever the location.
+func WithLocation(loc *time.Location) Option {
+	return func(c *Client) {
+		if loc != nil {
+			c.location = loc
+		}
+	}
+}
+
 func mustBaseURL(endpoint, version string) *url.URL {
 	parsed, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/" + version + "/")
 	if err != nil {
@@ -170,6 +203,8 @@ func NewClient(opts ...Option) *Client {
 		UserAgent:         defaultUserAgent,
 		version:           defaultVersion,
 		deviceIDGenerator: NewPlatformDeviceIDGenerator(),
+		amountPolicy:      DefaultAmountPolicy(),
+		location:          moscow,
 	}
 
 	for _, opt := range opts {
@@ -223,12 +258,41 @@ func (c *Client) WithToken(token *AccessToken) *Client {
 		deviceID:          c.deviceID,
 		deviceIDErr:       c.deviceIDErr,
 		token:             token,
+		linkRecorder:      c.linkRecorder,
+		counterparties:    c.counterparties,
+		rates:             c.rates,
+		amountPolicy:      c.amountPolicy,
+		location:          c.location,
+		strictDecoding:    c.strictDecoding,
+		onSchemaDrift:     c.onSchemaDrift,
+		breaker:           c.breaker,
+		receiptQueue:      c.receiptQueue,
 	}
 	authed.initServices()
 
 	return authed
 }
 
+// Location returns the time zone the client builds its requests in.
+func (c *Client) Location() *time.Location {
+	return c.location
+}
+
+// Date returns midnight of the given day in the client's location, for
+// listing filters such as IncomeListOptions.From.
+func (c *Client) Date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, c.location)
+}
+
+// apiTime returns t in the client's location, as sent to the API.
+func (c *Client) apiTime(t time.Time) Time {
+	if t.IsZero() {
+		return Time{}
+	}
+
+	return NewTime(t.In(c.location))
+}
+
 // Token returns the access token currently held by the client, which may have
 // been refreshed since it was passed to WithToken. It returns nil when the
 // client is unauthenticated.
@@ -329,14 +393,46 @@ func addOptions(s string, opts any) (string, error) {
 	return u.String(), nil
 }
 
+// requestIDHeaders are the headers the server and the proxies in front of it
+// identify a request with, in order of preference.
+var requestIDHeaders = []string{"X-Request-Id", "X-Correlation-Id", "X-Trace-Id", "X-B3-TraceId"}
+
 // Response wraps *http.Response so response metadata can grow independently of
 // the standard library type.
 type Response struct {
 	*http.Response
+
+	// RequestID is the request identifier the server returned in one of the
+	// requestIDHeaders, empty when it sent none. Quote it to nalog.ru support.
+	RequestID string
+	// Latency is the time from sending the first attempt to receiving the
+	// headers of the last one, token refreshes included.
+	Latency time.Duration
+	// Attempts is how many times the request was sent: more than one when a
+	// 401 response triggered a token refresh and a replay.
+	Attempts int
+	// TokenRefreshed reports whether the access token was refreshed on the way.
+	TokenRefreshed bool
+	// Token is the access token the last attempt was sent with, nil for
+	// unauthenticated requests. Persist it when TokenRefreshed is set.
+	Token *AccessToken
+
+	// SchemaIssues are the differences between the response body and the
+	// struct it was decoded into. Only recorded with WithStrictDecoding.
+	SchemaIssues []*SchemaIssue
 }
 
 func newResponse(r *http.Response) *Response {
-	return &Response{Response: r}
+	response := &Response{Response: r}
+	for _, header := range requestIDHeaders {
+		if id := r.Header.Get(header); id != "" {
+			response.RequestID = id
+
+			break
+		}
+	}
+
+	return response
 }
 
 // Do sends an API request and decodes a successful JSON response into v. When v
@@ -361,6 +457,14 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v any) (*Response, e
 			return resp, errors.Wrap(err, "moynalog: cannot read response body")
 		}
 	default:
+		if c.strictDecoding {
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return resp, errors.Wrap(err, "moynalog: cannot read response body")
+			}
+
+			return resp, c.decodeStrict(ctx, req, resp, body, v)
+		}
 		// An empty body is not an error; several endpoints answer with one.
 		if err := json.NewDecoder(resp.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
 			return resp, errors.Wrap(err, "moynalog: cannot decode response body")
@@ -379,6 +483,8 @@ func (c *Client) BareDo(ctx context.Context, req *http.Request) (*Response, erro
 	}
 
 	skipAuth := authSkipped(ctx)
+	start := time.Now()
+	refreshed := false
 
 	for attempt := 0; ; attempt++ {
 		token := c.Token()
@@ -387,7 +493,8 @@ func (c *Client) BareDo(ctx context.Context, req *http.Request) (*Response, erro
 		if err != nil {
 			return nil, err
 		}
-		if !skipAuth && token != nil && outReq.Header.Get("Authorization") == "" {
+		authed := !skipAuth && token != nil && outReq.Header.Get("Authorization") == ""
+		if authed {
 			outReq.Header.Set("Authorization", "Bearer "+token.Token)
 		}
 
@@ -396,9 +503,17 @@ func (c *Client) BareDo(ctx context.Context, req *http.Request) (*Response, erro
 			return nil, err
 		}
 
+		response := newResponse(resp)
+		response.Latency = time.Since(start)
+		response.Attempts = attempt + 1
+		response.TokenRefreshed = refreshed
+		if authed {
+			response.Token = token
+		}
+
 		apiErr := CheckResponse(resp)
 		if apiErr == nil {
-			return newResponse(resp), nil
+			return response, nil
 		}
 		//nolint:gosec // G104: CheckResponse already drained the body.
 		_ = resp.Body.Close()
@@ -409,19 +524,43 @@ func (c *Client) BareDo(ctx context.Context, req *http.Request) (*Response, erro
 			token != nil &&
 			token.RefreshToken != ""
 		if !retriable {
-			return newResponse(resp), apiErr
+			return response, apiErr
 		}
 
-		refreshed, _, err := c.Auth.Refresh(ctx, token)
+		newToken, _, err := c.Auth.Refresh(ctx, token)
 		if err != nil {
 			// Surface the original 401; the refresh failure is only context.
-			return newResponse(resp), errors.Wrap(apiErr, err.Error())
+			return response, errors.Wrap(apiErr, err.Error())
 		}
-		c.setToken(refreshed)
+		c.setToken(newToken)
+		refreshed = true
 	}
 }
 
 func (c *Client) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if c.breaker == nil {
+		return c.roundTrip(ctx, req)
+	}
+
+	endpoint := c.circuitEndpoint(req)
+	if err := c.breaker.allow(endpoint); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.roundTrip(ctx, req)
+	switch {
+	case ctx.Err() != nil:
+		c.breaker.done(endpoint, circuitIgnored)
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		c.breaker.done(endpoint, circuitFailure)
+	default:
+		c.breaker.done(endpoint, circuitSuccess)
+	}
+
+	return resp, err
+}
+
+func (c *Client) roundTrip(ctx context.Context, req *http.Request) (*http.Response, error) {
 	//nolint:gosec // G704: relaying caller-built requests to the configured
 	// endpoint is the entire purpose of this package.
 	resp, err := c.client.Do(req)
@@ -7,6 +7,7 @@
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -28,6 +29,9 @@ func TestNewClientDefaults(t *testing.T) {
 	if client.DeviceID() == "" {
 		t.Error("device id must be derived by NewClient")
 	}
+	if client.Location().String() != "Europe/Moscow" {
+		t.Errorf("Location = %s, want Europe/Moscow", client.Location())
+	}
 }
 
 func TestNewClientOptions(t *testing.T) {
@@ -56,6 +60,21 @@ func TestNewClientOptions(t *testing.T) {
 	}
 }
 
+func TestWithLocation(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient(WithLocation(time.UTC), WithLocation(nil)).WithToken(&AccessToken{Token: "t"})
+	if client.Location() != time.UTC {
+		t.Errorf("Location = %s, want UTC kept through WithToken", client.Location())
+	}
+	if got := client.Date(2024, time.September, 1); !got.Equal(time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Date = %s, want midnight UTC", got)
+	}
+	if got := NewClient().Date(2024, time.September, 1); got.UTC().Hour() != 21 || got.UTC().Day() != 31 {
+		t.Errorf("Date = %s, want midnight in Moscow", got)
+	}
+}
+
 // The device id must be stable for the lifetime of the client and survive
 // deriving an authenticated client from it.
 func TestDeviceIDIsStable(t *testing.T) {
@@ -245,6 +264,7 @@ func TestDoRefreshesTokenOn401(t *testing.T) {
 		}
 
 		testHeader(t, r, "Authorization", "Bearer new-token")
+		w.Header().Set("X-Request-Id", "req-42")
 		writeJSON(t, w, http.StatusOK, `{"ok":true}`)
 	})
 
@@ -256,13 +276,18 @@ func TestDoRefreshesTokenOn401(t *testing.T) {
 	got := struct {
 		OK bool `json:"ok"`
 	}{}
-	if _, err := client.Do(context.Background(), req, &got); err != nil {
+	resp, err := client.Do(context.Background(), req, &got)
+	if err != nil {
 		t.Fatalf("Do: %v", err)
 	}
 
 	if !got.OK {
 		t.Error("the replayed request must return the successful payload")
 	}
+	if resp.Attempts != 2 || !resp.TokenRefreshed || resp.Token == nil || resp.Token.Token != "new-token" ||
+		resp.RequestID != "req-42" || resp.Latency <= 0 {
+		t.Errorf("response metadata = %+v, want two attempts, a refresh and the new token", resp)
+	}
 	if refreshes != 1 {
 		t.Errorf("refresh calls = %d, want 1", refreshes)
 	}
@@ -274,6 +299,38 @@ func TestDoRefreshesTokenOn401(t *testing.T) {
 	}
 }
 
+func TestResponseMetadata(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/thing", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Correlation-Id", "corr-1")
+		writeJSON(t, w, http.StatusOK, `{}`)
+	})
+
+	req, err := client.NewRequest(http.MethodGet, "thing", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	resp, err := client.Do(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if resp.Attempts != 1 || resp.TokenRefreshed || resp.Token == nil || resp.Token.Token != "access-token" ||
+		resp.RequestID != "corr-1" {
+		t.Errorf("response metadata = %+v, want a single attempt with the original token", resp)
+	}
+
+	// Unauthenticated requests carry no token.
+	resp, err = client.Do(withoutAuth(context.Background()), req, nil)
+	if err != nil {
+		t.Fatalf("Do without auth: %v", err)
+	}
+	if resp.Token != nil {
+		t.Errorf("Token = %+v, want nil without auth", resp.Token)
+	}
+}
+
 // A token that keeps coming back 401 must give up rather than loop.
 func TestDoGivesUpAfterMaxRetries(t *testing.T) {
 	t.Parallel()
@@ -0,0 +1,220 @@
+package moynalog
+
+import (
+	"slices"
+	"strconv"
+	"time"
+)
+
+// IncomeServiceItem returns the line as it is sent when registering a receipt.
+func (i *ServiceItem) IncomeServiceItem() IncomeServiceItem {
+	return IncomeServiceItem{Name: i.Name, Amount: i.Amount, Quantity: i.Quantity}
+}
+
+// IncomeCreateRequest returns the request that registers a receipt identical
+// to this one: same lines, client, payment type and operation time.
+func (r *Receipt) IncomeCreateRequest() *IncomeCreateRequest {
+	client := receiptClient(r.ClientDisplayName, r.IncomeType, r.ClientInn)
+	client.ContactPhone = r.Phone
+
+	return newIncomeCreateRequest(r.Services, r.OperationTime.Time, client, r.PaymentType)
+}
+
+// IncomeCreateRequest returns the request that registers a receipt identical
+// to this one. Listings carry no client phone, so ContactPhone stays empty.
+func (i *IncomeListItem) IncomeCreateRequest() *IncomeCreateRequest {
+	return newIncomeCreateRequest(i.Services, i.OperationTime.Time,
+		receiptClient(i.ClientDisplayName, i.IncomeType, i.ClientInn), i.PaymentType)
+}
+
+// receiptClient returns the counterparty of a registered receipt. The API does
+// not return the country of a foreign agency, so Country stays empty.
+func receiptClient(displayName string, incomeType IncomeType, inn string) *IncomeClient {
+	return &IncomeClient{DisplayName: displayName, IncomeType: incomeType, Inn: inn, registered: true}
+}
+
+func newIncomeCreateRequest(items []*ServiceItem, operationTime time.Time, client *IncomeClient, paymentType PaymentType) *IncomeCreateRequest {
+	services := make([]IncomeServiceItem, 0, len(items))
+	for _, item := range items {
+		if item != nil {
+			services = append(services, item.IncomeServiceItem())
+		}
+	}
+
+	return &IncomeCreateRequest{
+		Services:      services,
+		OperationTime: operationTime,
+		Client:        client,
+		PaymentType:   paymentType,
+	}
+}
+
+// IncomeListItem returns the receipt as a listing reports it. Name, PartnerCode
+// and PartnerLogo only exist in listings and stay empty.
+func (r *Receipt) IncomeListItem() *IncomeListItem {
+	return &IncomeListItem{
+		ApprovedReceiptUUID: r.ReceiptID,
+		Services:            cloneServiceItems(r.Services),
+		OperationTime:       r.OperationTime,
+		RequestTime:         r.RequestTime,
+		RegisterTime:        r.RegisterTime,
+		TaxPeriodID:         r.TaxPeriodID,
+		PaymentType:         r.PaymentType,
+		IncomeType:          r.IncomeType,
+		TotalAmount:         r.TotalAmount,
+		CancellationInfo:    cloneCancellationInfo(r.CancellationInfo),
+		SourceDeviceID:      r.SourceDeviceID,
+		ClientInn:           r.ClientInn,
+		ClientDisplayName:   r.ClientDisplayName,
+		PartnerDisplayName:  r.PartnerDisplayName,
+		PartnerInn:          r.PartnerInn,
+		Inn:                 r.Inn,
+		Profession:          r.Profession,
+		Description:         slices.Clone(r.Description),
+		InvoiceID:           r.InvoiceID,
+	}
+}
+
+// Receipt returns the listed receipt as ReceiptService.JSON reports it. Email
+// and Phone only exist in the full receipt and stay empty.
+func (i *IncomeListItem) Receipt() *Receipt {
+	return &Receipt{
+		ReceiptID:          i.ApprovedReceiptUUID,
+		Services:           cloneServiceItems(i.Services),
+		OperationTime:      i.OperationTime,
+		RequestTime:        i.RequestTime,
+		RegisterTime:       i.RegisterTime,
+		TaxPeriodID:        i.TaxPeriodID,
+		PaymentType:        i.PaymentType,
+		IncomeType:         i.IncomeType,
+		TotalAmount:        i.TotalAmount,
+		CancellationInfo:   cloneCancellationInfo(i.CancellationInfo),
+		SourceDeviceID:     i.SourceDeviceID,
+		ClientInn:          i.ClientInn,
+		ClientDisplayName:  i.ClientDisplayName,
+		PartnerDisplayName: i.PartnerDisplayName,
+		PartnerInn:         i.PartnerInn,
+		Inn:                i.Inn,
+		Profession:         i.Profession,
+		Description:        slices.Clone(i.Description),
+		InvoiceID:          i.InvoiceID,
+	}
+}
+
+func cloneServiceItems(items []*ServiceItem) []*ServiceItem {
+	if items == nil {
+		return nil
+	}
+
+	cloned := make([]*ServiceItem, len(items))
+	for n, item := range items {
+		if item != nil {
+			itemCopy := *item
+			cloned[n] = &itemCopy
+		}
+	}
+
+	return cloned
+}
+
+func cloneCancellationInfo(info *CancellationInfo) *CancellationInfo {
+	if info == nil {
+		return nil
+	}
+	infoCopy := *info
+
+	return &infoCopy
+}
+
+// IncomeDiff is a field two receipt requests disagree on.
+type IncomeDiff struct {
+	// Field is the path of the field, such as "services[1].amount" or
+	// "client.inn".
+	Field string
+	Old   string
+	New   string
+}
+
+// Equal reports whether r and other register the same receipt. Defaults are
+// taken into account: a nil Client equals an anonymous individual and an
+// empty PaymentType equals PaymentTypeCash. Amounts compare by value and
+// times by instant.
+func (r *IncomeCreateRequest) Equal(other *IncomeCreateRequest) bool {
+	return len(r.Diff(other)) == 0
+}
+
+// Diff lists the fields other changes relative to r, with the same notion of
+// equality as Equal. Lines are compared by position.
+func (r *IncomeCreateRequest) Diff(other *IncomeCreateRequest) []IncomeDiff {
+	if r == nil || other == nil {
+		if r == other {
+			return nil
+		}
+
+		return []IncomeDiff{{Field: "request", Old: strconv.FormatBool(r != nil), New: strconv.FormatBool(other != nil)}}
+	}
+
+	var diffs []IncomeDiff
+	add := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			diffs = append(diffs, IncomeDiff{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+
+	for n := range max(len(r.Services), len(other.Services)) {
+		field := "services[" + strconv.Itoa(n) + "]"
+		switch {
+		case n >= len(r.Services):
+			add(field, "", other.Services[n].Name)
+		case n >= len(other.Services):
+			add(field, r.Services[n].Name, "")
+		default:
+			oldItem, newItem := r.Services[n], other.Services[n]
+			add(field+".name", oldItem.Name, newItem.Name)
+			add(field+".amount", oldItem.Amount.String(), newItem.Amount.String())
+			add(field+".quantity", oldItem.Quantity.String(), newItem.Quantity.String())
+		}
+	}
+
+	add("operationTime", timeString(r.OperationTime), timeString(other.OperationTime))
+
+	oldClient, newClient := normalizedClient(r.Client), normalizedClient(other.Client)
+	add("client.contactPhone", oldClient.ContactPhone, newClient.ContactPhone)
+	add("client.displayName", oldClient.DisplayName, newClient.DisplayName)
+	add("client.incomeType", string(oldClient.IncomeType), string(newClient.IncomeType))
+	add("client.inn", oldClient.Inn, newClient.Inn)
+
+	add("paymentType", string(normalizedPaymentType(r.PaymentType)), string(normalizedPaymentType(other.PaymentType)))
+	add("ignoreMaxTotalIncomeRestriction",
+		strconv.FormatBool(r.IgnoreMaxTotalIncomeRestriction), strconv.FormatBool(other.IgnoreMaxTotalIncomeRestriction))
+
+	return diffs
+}
+
+func normalizedClient(client *IncomeClient) IncomeClient {
+	normalized := IncomeClient{}
+	if client != nil {
+		normalized = *client
+	}
+	if normalized.IncomeType == "" {
+		normalized.IncomeType = IncomeTypeIndividual
+	}
+
+	return normalized
+}
+
+func normalizedPaymentType(paymentType PaymentType) PaymentType {
+	if paymentType == "" {
+		return PaymentTypeCash
+	}
+
+	return paymentType
+}
+
+func timeString(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,127 @@
+package moynalog
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReceiptConversions(t *testing.T) {
+	t.Parallel()
+
+	receipt := new(Receipt)
+	if err := json.Unmarshal([]byte(refundReceiptJSON), receipt); err != nil {
+		t.Fatalf("decode receipt: %v", err)
+	}
+	receipt.Phone = "+79000000000"
+
+	income := receipt.IncomeCreateRequest()
+	want := &IncomeCreateRequest{
+		Services: []IncomeServiceItem{
+			{Name: "Консультация", Amount: decimal.NewFromInt(1000), Quantity: decimal.NewFromInt(1)},
+			{Name: "Доставка", Amount: decimal.RequireFromString("333.33"), Quantity: decimal.NewFromInt(3)},
+		},
+		OperationTime: time.Date(2024, 9, 1, 9, 0, 0, 0, time.UTC),
+		Client: &IncomeClient{
+			ContactPhone: "+79000000000",
+			DisplayName:  "ООО Ромашка",
+			IncomeType:   IncomeTypeLegalEntity,
+			Inn:          "7707083893",
+		},
+		PaymentType: PaymentTypeAccount,
+	}
+	if diff := want.Diff(income); len(diff) != 0 {
+		t.Errorf("Receipt.IncomeCreateRequest differs: %+v", diff)
+	}
+
+	item := receipt.IncomeListItem()
+	if item.ApprovedReceiptUUID != "orig" || item.ClientInn != "7707083893" || len(item.Services) != 2 {
+		t.Errorf("IncomeListItem = %+v", item)
+	}
+	item.Services[0].Name = "changed"
+	if receipt.Services[0].Name != "Консультация" {
+		t.Error("IncomeListItem must not share lines with the receipt")
+	}
+	item.Services[0].Name = "Консультация"
+
+	// Only the phone is lost on the way through a listing.
+	back := item.Receipt()
+	if back.ReceiptID != receipt.ReceiptID || back.Phone != "" || !back.TotalAmount.Equal(receipt.TotalAmount) {
+		t.Errorf("IncomeListItem.Receipt = %+v", back)
+	}
+	diff := income.Diff(item.IncomeCreateRequest())
+	if len(diff) != 1 || diff[0] != (IncomeDiff{Field: "client.contactPhone", Old: "+79000000000", New: ""}) {
+		t.Errorf("Diff via listing = %+v, want only the phone", diff)
+	}
+}
+
+// A foreign agency receipt converts back into a client with its name intact
+// and no country, which the API does not return; re-registering it still
+// passes validation and sends the same display name.
+func TestReceiptConversionsForeignAgency(t *testing.T) {
+	t.Parallel()
+
+	receipt := &Receipt{ClientDisplayName: "Acme, Inc.", IncomeType: IncomeTypeForeignAgency}
+	client := receipt.IncomeCreateRequest().Client
+	if client.DisplayName != "Acme, Inc." || client.Country != "" {
+		t.Errorf("client = %+v, want the name as registered and no country", client)
+	}
+	if err := validateIncomeClient(client); err != nil {
+		t.Errorf("validateIncomeClient: %v", err)
+	}
+
+	original := &IncomeCreateRequest{Client: NewForeignAgencyClient("Acme, Inc.", "США")}
+	if diff := original.Diff(receipt.IncomeCreateRequest()); len(diff) != 0 {
+		t.Errorf("Diff = %+v, want the receipt equal to the request it came from", diff)
+	}
+}
+
+func TestIncomeCreateRequestDiff(t *testing.T) {
+	t.Parallel()
+
+	base := func() *IncomeCreateRequest {
+		return &IncomeCreateRequest{
+			Services:      []IncomeServiceItem{{Name: "Услуга", Amount: decimal.RequireFromString("100.50"), Quantity: decimal.NewFromInt(1)}},
+			OperationTime: time.Date(2024, 9, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60)),
+		}
+	}
+
+	// Defaults, scale and time zone do not make a difference.
+	same := base()
+	same.Services[0].Amount = decimal.RequireFromString("100.5")
+	same.OperationTime = same.OperationTime.UTC()
+	same.Client = &IncomeClient{IncomeType: IncomeTypeIndividual}
+	same.PaymentType = PaymentTypeCash
+	if !base().Equal(same) {
+		t.Errorf("Equal = false, diff %+v", base().Diff(same))
+	}
+
+	changed := base()
+	changed.Services[0].Quantity = decimal.NewFromInt(2)
+	changed.Services = append(changed.Services, IncomeServiceItem{Name: "Доставка"})
+	changed.Client = &IncomeClient{Inn: "500100732259"}
+	changed.PaymentType = PaymentTypeAccount
+
+	want := []IncomeDiff{
+		{Field: "services[0].quantity", Old: "1", New: "2"},
+		{Field: "services[1]", Old: "", New: "Доставка"},
+		{Field: "client.inn", Old: "", New: "500100732259"},
+		{Field: "paymentType", Old: string(PaymentTypeCash), New: string(PaymentTypeAccount)},
+	}
+	got := base().Diff(changed)
+	if len(got) != len(want) {
+		t.Fatalf("Diff = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Diff[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	var missing *IncomeCreateRequest
+	if base().Equal(missing) || !missing.Equal(nil) {
+		t.Error("a nil request must only equal another nil request")
+	}
+}
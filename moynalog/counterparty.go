@@ -0,0 +1,239 @@
+package moynalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/shoman4eg/go-moy-nalog/validate"
+)
+
+// Counterparty is what a CounterpartyResolver knows about an INN.
+type Counterparty struct {
+	Inn         string
+	DisplayName string
+}
+
+// CounterpartyResolver looks counterparties up by INN, typically in a local
+// copy of EGRUL/EGRIP. The library never queries external registries itself.
+// Implementations must be safe for concurrent use.
+type CounterpartyResolver interface {
+	// ResolveCounterparty returns the counterparty with inn, or nil when it
+	// is unknown.
+	ResolveCounterparty(ctx context.Context, inn string) (*Counterparty, error)
+}
+
+// CounterpartyResolverFunc adapts a function to CounterpartyResolver.
+type CounterpartyResolverFunc func(ctx context.Context, inn string) (*Counterparty, error)
+
+// ResolveCounterparty implements CounterpartyResolver.
+func (f CounterpartyResolverFunc) ResolveCounterparty(ctx context.Context, inn string) (*Counterparty, error) {
+	return f(ctx, inn)
+}
+
+// WithCounterpartyResolver makes IncomeService.Create and InvoiceService.Create
+// fill in the DisplayName of a client given only by Inn.
+func WithCounterpartyResolver(resolver CounterpartyResolver) Option {
+	return func(c *Client) {
+		c.counterparties = resolver
+	}
+}
+
+// resolveClient returns client with its DisplayName looked up when only the
+// INN is set. client itself is never modified. Unknown INNs, and INNs that
+// fail the control digit check, are left for validation to report.
+func (c *Client) resolveClient(ctx context.Context, client *IncomeClient) (*IncomeClient, error) {
+	if c.counterparties == nil || client == nil || client.Inn == "" || client.DisplayName != "" {
+		return client, nil
+	}
+	if validate.INN(client.Inn) != nil {
+		return client, nil
+	}
+
+	counterparty, err := c.counterparties.ResolveCounterparty(ctx, client.Inn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "moynalog: cannot resolve counterparty %s", client.Inn)
+	}
+	if counterparty == nil {
+		return client, nil
+	}
+
+	resolved := *client
+	resolved.DisplayName = counterparty.DisplayName
+
+	return &resolved, nil
+}
+
+// CachingCounterpartyResolver remembers the answers of another resolver,
+// unknown INNs included, for a fixed time. Expired answers are evicted, so the
+// cache holds no more than the INNs resolved within about two ttls.
+type CachingCounterpartyResolver struct {
+	next CounterpartyResolver
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]counterpartyCacheEntry
+	// sweepAt is when expired entries are next swept out.
+	sweepAt time.Time
+}
+
+type counterpartyCacheEntry struct {
+	counterparty *Counterparty
+	expires      time.Time
+}
+
+func (e counterpartyCacheEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// NewCachingCounterpartyResolver returns a resolver caching the answers of
+// next for ttl. A zero ttl caches them for the lifetime of the resolver.
+// Errors are not cached.
+func NewCachingCounterpartyResolver(next CounterpartyResolver, ttl time.Duration) *CachingCounterpartyResolver {
+	return &CachingCounterpartyResolver{
+		next:    next,
+		ttl:     ttl,
+		entries: map[string]counterpartyCacheEntry{},
+	}
+}
+
+// ResolveCounterparty implements CounterpartyResolver.
+func (r *CachingCounterpartyResolver) ResolveCounterparty(ctx context.Context, inn string) (*Counterparty, error) {
+	now := time.Now()
+
+	r.mu.Lock()
+	entry, ok := r.entries[inn]
+	if ok && !entry.expired(now) {
+		r.mu.Unlock()
+
+		return cloneCounterparty(entry.counterparty), nil
+	}
+	delete(r.entries, inn)
+	r.mu.Unlock()
+
+	counterparty, err := r.next.ResolveCounterparty(ctx, inn)
+	if err != nil {
+		return nil, err
+	}
+
+	entry = counterpartyCacheEntry{counterparty: cloneCounterparty(counterparty)}
+	if r.ttl > 0 {
+		entry.expires = now.Add(r.ttl)
+	}
+	r.mu.Lock()
+	r.entries[inn] = entry
+	r.sweep(now)
+	r.mu.Unlock()
+
+	return counterparty, nil
+}
+
+// sweep drops every expired entry, at most once per ttl. r.mu must be held.
+func (r *CachingCounterpartyResolver) sweep(now time.Time) {
+	if r.ttl <= 0 || now.Before(r.sweepAt) {
+		return
+	}
+
+	for inn, entry := range r.entries {
+		if entry.expired(now) {
+			delete(r.entries, inn)
+		}
+	}
+	r.sweepAt = now.Add(r.ttl)
+}
+
+// Forget drops inn from the cache.
+func (r *CachingCounterpartyResolver) Forget(inn string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, inn)
+}
+
+func cloneCounterparty(counterparty *Counterparty) *Counterparty {
+	if counterparty == nil {
+		return nil
+	}
+	counterpartyCopy := *counterparty
+
+	return &counterpartyCopy
+}
+
+// StaticCounterpartyResolver resolves counterparties from a fixed INN to
+// display name map.
+type StaticCounterpartyResolver map[string]string
+
+// ResolveCounterparty implements CounterpartyResolver.
+func (r StaticCounterpartyResolver) ResolveCounterparty(_ context.Context, inn string) (*Counterparty, error) {
+	name, ok := r[inn]
+	if !ok {
+		return nil, nil
+	}
+
+	return &Counterparty{Inn: inn, DisplayName: name}, nil
+}
+
+// ReadCounterpartyCSV reads a counterparty directory with the INN in the
+// first column and the display name in the second. Columns are separated by
+// commas or semicolons, whichever the first line uses; a header line is
+// skipped, and further columns are ignored. Every INN must pass validate.INN.
+func ReadCounterpartyCSV(r io.Reader) (StaticCounterpartyResolver, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot read counterparty directory")
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot parse counterparty directory")
+	}
+
+	resolver := StaticCounterpartyResolver{}
+	for n, record := range records {
+		if len(record) < 2 {
+			return nil, errors.Errorf("moynalog: counterparty directory line %d: want an INN and a name", n+1)
+		}
+
+		inn := strings.TrimSpace(strings.TrimPrefix(record[0], "\ufeff"))
+		name := strings.TrimSpace(record[1])
+		if n == 0 && !isDigits(inn) {
+			continue // Header.
+		}
+		if err := validateINN(inn, "INN"); err != nil {
+			return nil, errors.Wrapf(err, "moynalog: counterparty directory line %d", n+1)
+		}
+		if name == "" {
+			return nil, errors.Errorf("moynalog: counterparty directory line %d: name cannot be empty", n+1)
+		}
+		resolver[inn] = name
+	}
+
+	return resolver, nil
+}
+
+// LoadCounterpartyCSV reads the counterparty directory at path, see
+// ReadCounterpartyCSV.
+func LoadCounterpartyCSV(path string) (StaticCounterpartyResolver, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot read counterparty directory")
+	}
+
+	return ReadCounterpartyCSV(bytes.NewReader(data))
+}
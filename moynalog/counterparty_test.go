@@ -0,0 +1,238 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+func setupResolved(t *testing.T, resolver CounterpartyResolver) (*Client, *http.ServeMux) {
+	t.Helper()
+
+	client, mux := setup(t)
+	client.counterparties = resolver
+
+	return client.WithToken(&AccessToken{Token: "access-token", Profile: User{Inn: "770000000000"}}), mux
+}
+
+func TestCreateResolvesCounterparty(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupResolved(t, StaticCounterpartyResolver{"7707083893": "ПАО Сбербанк"})
+	for _, path := range []string{"/v1/income", "/v1/invoice"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			buyer, _ := testBody(t, r)["client"].(map[string]any)
+			if buyer["displayName"] != "ПАО Сбербанк" {
+				t.Errorf("%s: displayName = %v, want the resolved name", r.URL.Path, buyer["displayName"])
+			}
+			writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"r1"}`)
+		})
+	}
+
+	buyer := &IncomeClient{IncomeType: IncomeTypeLegalEntity, Inn: "7707083893"}
+	_, _, err := client.Income.Create(context.Background(), &IncomeCreateRequest{
+		Services: []IncomeServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(1), Quantity: decimal.NewFromInt(1)}},
+		Client:   buyer,
+	})
+	if err != nil {
+		t.Fatalf("Income.Create: %v", err)
+	}
+	_, _, err = client.Invoice.Create(context.Background(), &InvoiceCreateRequest{
+		Services: []InvoiceServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(1), Quantity: decimal.NewFromInt(1)}},
+		Client:   buyer,
+	})
+	if err != nil {
+		t.Fatalf("Invoice.Create: %v", err)
+	}
+	if buyer.DisplayName != "" {
+		t.Errorf("DisplayName = %q, the caller's client must not be modified", buyer.DisplayName)
+	}
+}
+
+func TestCreateCounterpartyNotResolved(t *testing.T) {
+	t.Parallel()
+
+	failing := CounterpartyResolverFunc(func(context.Context, string) (*Counterparty, error) {
+		return nil, errors.New("directory unavailable")
+	})
+
+	for name, resolver := range map[string]CounterpartyResolver{
+		"unknown INN":    StaticCounterpartyResolver{},
+		"resolver error": failing,
+	} {
+		client, mux := setupResolved(t, resolver)
+		mux.HandleFunc("/", func(_ http.ResponseWriter, r *http.Request) {
+			t.Errorf("%s: no request should have been sent, got %s", name, r.URL)
+		})
+
+		_, _, err := client.Income.Create(context.Background(), &IncomeCreateRequest{
+			Services: []IncomeServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(1), Quantity: decimal.NewFromInt(1)}},
+			Client:   &IncomeClient{IncomeType: IncomeTypeLegalEntity, Inn: "7707083893"},
+		})
+		assertNotSent(t, err)
+	}
+}
+
+func TestCachingCounterpartyResolver(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	var fail atomic.Bool
+	next := CounterpartyResolverFunc(func(_ context.Context, inn string) (*Counterparty, error) {
+		calls.Add(1)
+		if fail.Load() {
+			return nil, errors.New("directory unavailable")
+		}
+		if inn == "7707083893" {
+			return &Counterparty{Inn: inn, DisplayName: "ПАО Сбербанк"}, nil
+		}
+
+		return nil, nil
+	})
+	resolver := NewCachingCounterpartyResolver(next, 0)
+	ctx := context.Background()
+
+	for range 3 {
+		counterparty, err := resolver.ResolveCounterparty(ctx, "7707083893")
+		if err != nil || counterparty == nil || counterparty.DisplayName != "ПАО Сбербанк" {
+			t.Fatalf("ResolveCounterparty = %+v, %v", counterparty, err)
+		}
+		counterparty.DisplayName = "changed"
+		if counterparty, _ := resolver.ResolveCounterparty(ctx, "500100732259"); counterparty != nil {
+			t.Errorf("unknown INN resolved to %+v", counterparty)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("next called %d times, want once per INN", calls.Load())
+	}
+
+	resolver.Forget("7707083893")
+	fail.Store(true)
+	if _, err := resolver.ResolveCounterparty(ctx, "7707083893"); err == nil {
+		t.Error("want the error of the next resolver after Forget")
+	}
+	fail.Store(false)
+	if counterparty, err := resolver.ResolveCounterparty(ctx, "7707083893"); err != nil || counterparty == nil {
+		t.Errorf("errors must not be cached, got %+v, %v", counterparty, err)
+	}
+}
+
+func TestCachingCounterpartyResolverExpires(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	next := CounterpartyResolverFunc(func(context.Context, string) (*Counterparty, error) {
+		calls.Add(1)
+
+		return nil, nil
+	})
+	resolver := NewCachingCounterpartyResolver(next, time.Hour)
+
+	if _, err := resolver.ResolveCounterparty(context.Background(), "7707083893"); err != nil {
+		t.Fatalf("ResolveCounterparty: %v", err)
+	}
+	resolver.entries["7707083893"] = counterpartyCacheEntry{expires: time.Now().Add(-time.Second)}
+	if _, err := resolver.ResolveCounterparty(context.Background(), "7707083893"); err != nil {
+		t.Fatalf("ResolveCounterparty: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("next called %d times, want an expired entry looked up again", calls.Load())
+	}
+}
+
+func TestCachingCounterpartyResolverEvicts(t *testing.T) {
+	t.Parallel()
+
+	next := CounterpartyResolverFunc(func(context.Context, string) (*Counterparty, error) {
+		return nil, nil
+	})
+	resolver := NewCachingCounterpartyResolver(next, time.Hour)
+	ctx := context.Background()
+
+	if _, err := resolver.ResolveCounterparty(ctx, "7707083893"); err != nil {
+		t.Fatalf("ResolveCounterparty: %v", err)
+	}
+	// An INN never asked for again goes with the next sweep.
+	resolver.entries["7707083893"] = counterpartyCacheEntry{expires: time.Now().Add(-time.Second)}
+	resolver.sweepAt = time.Time{}
+	if _, err := resolver.ResolveCounterparty(ctx, "500100732259"); err != nil {
+		t.Fatalf("ResolveCounterparty: %v", err)
+	}
+
+	if _, ok := resolver.entries["7707083893"]; ok || len(resolver.entries) != 1 {
+		t.Errorf("entries = %v, want the expired one swept", resolver.entries)
+	}
+}
+
+func TestReadCounterpartyCSV(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"comma with header", "inn,name\n7707083893,ПАО Сбербанк\n500100732259,\"Иванов, ИП\"\n"},
+		{"semicolon with BOM", "\ufeff7707083893;ПАО Сбербанк;лишняя колонка\n500100732259;Иванов, ИП\n"},
+	}
+
+	for _, tt := range tests {
+		resolver, err := ReadCounterpartyCSV(strings.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("%s: ReadCounterpartyCSV: %v", tt.name, err)
+		}
+		if len(resolver) != 2 || resolver["7707083893"] != "ПАО Сбербанк" || resolver["500100732259"] != "Иванов, ИП" {
+			t.Errorf("%s: resolver = %v", tt.name, resolver)
+		}
+	}
+
+	for _, data := range []string{
+		"7707083894,Неверный ИНН\n",
+		"7707083893,\n",
+		"7707083893\n",
+	} {
+		if _, err := ReadCounterpartyCSV(strings.NewReader(data)); err == nil {
+			t.Errorf("ReadCounterpartyCSV(%q) = nil error, want one", data)
+		}
+	}
+}
+
+func TestLoadCounterpartyCSV(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "counterparties.csv")
+	if err := os.WriteFile(path, []byte("7707083893;ПАО Сбербанк\n"), 0o600); err != nil {
+		t.Fatalf("write directory: %v", err)
+	}
+
+	resolver, err := LoadCounterpartyCSV(path)
+	if err != nil {
+		t.Fatalf("LoadCounterpartyCSV: %v", err)
+	}
+	counterparty, err := resolver.ResolveCounterparty(context.Background(), "7707083893")
+	if err != nil || counterparty == nil || counterparty.DisplayName != "ПАО Сбербанк" {
+		t.Errorf("ResolveCounterparty = %+v, %v", counterparty, err)
+	}
+
+	if _, err := LoadCounterpartyCSV(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Error("want an error for a missing file")
+	}
+}
+
+// The resolver must survive deriving an authenticated client.
+func TestWithCounterpartyResolver(t *testing.T) {
+	t.Parallel()
+
+	resolver := StaticCounterpartyResolver{}
+	client := NewClient(WithCounterpartyResolver(resolver)).WithToken(&AccessToken{Token: "access"})
+	if client.counterparties == nil {
+		t.Error("WithToken dropped the counterparty resolver")
+	}
+}
@@ -0,0 +1,259 @@
+package moynalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Currency is an ISO 4217 alphabetic currency code.
+type Currency string
+
+// Common currencies. Any code a RateProvider knows may be used.
+const (
+	CurrencyRUB Currency = "RUB"
+	CurrencyUSD Currency = "USD"
+	CurrencyEUR Currency = "EUR"
+)
+
+// Rate sources reported in ExchangeRate.Source.
+const (
+	RateSourceFixed = "fixed"
+	RateSourceCBR   = "cbr"
+)
+
+const cbrDateLayout = "02.01.2006"
+
+// ExchangeRate is the value of one unit of a foreign currency in roubles.
+type ExchangeRate struct {
+	Currency Currency
+	// Rate is the number of roubles per unit of Currency.
+	Rate decimal.Decimal
+	// Date is the day the rate applies to.
+	Date time.Time
+	// Source names where the rate comes from, such as RateSourceCBR.
+	Source string
+}
+
+// Convert returns amount of the rate's currency in roubles, rounded half away
+// from zero to kopecks.
+func (r *ExchangeRate) Convert(amount decimal.Decimal) decimal.Decimal {
+	return amount.Mul(r.Rate).Round(amountPlaces)
+}
+
+// RateProvider supplies the exchange rates foreign currency receipts are
+// converted with. Implementations must be safe for concurrent use.
+type RateProvider interface {
+	// ExchangeRate returns the rate of currency applicable on date.
+	ExchangeRate(ctx context.Context, currency Currency, date time.Time) (*ExchangeRate, error)
+}
+
+// WithRateProvider sets the exchange rates IncomeService.CreateInCurrency
+// converts with.
+func WithRateProvider(provider RateProvider) Option {
+	return func(c *Client) {
+		c.rates = provider
+	}
+}
+
+// FixedRateProvider converts at fixed rates, in roubles per unit, whatever
+// the date.
+type FixedRateProvider map[Currency]decimal.Decimal
+
+// ExchangeRate implements RateProvider.
+func (p FixedRateProvider) ExchangeRate(_ context.Context, currency Currency, date time.Time) (*ExchangeRate, error) {
+	rate, ok := p[currency]
+	if !ok {
+		return nil, errors.Errorf("moynalog: no exchange rate for %s", currency)
+	}
+
+	return &ExchangeRate{Currency: currency, Rate: rate, Date: date, Source: RateSourceFixed}, nil
+}
+
+// CBRRates are the official rates of the Bank of Russia for one day, as
+// published at https://www.cbr.ru/scripts/XML_daily.asp.
+type CBRRates struct {
+	// Date is the day the rates are set for.
+	Date time.Time
+	// Rates are in roubles per unit of each currency.
+	Rates map[Currency]decimal.Decimal
+}
+
+// ExchangeRate implements RateProvider. Official rates stay in force until
+// the next ones are set, so any date from Date on is answered with them;
+// keeping the file current is up to the caller.
+func (r *CBRRates) ExchangeRate(_ context.Context, currency Currency, date time.Time) (*ExchangeRate, error) {
+	if day := date.In(moscow); day.Before(r.Date) {
+		return nil, errors.Errorf("moynalog: CBR rates of %s do not cover %s",
+			r.Date.Format(time.DateOnly), day.Format(time.DateOnly))
+	}
+	rate, ok := r.Rates[currency]
+	if !ok {
+		return nil, errors.Errorf("moynalog: no CBR rate for %s", currency)
+	}
+
+	return &ExchangeRate{Currency: currency, Rate: rate, Date: r.Date, Source: RateSourceCBR}, nil
+}
+
+type cbrValCurs struct {
+	Date    string `xml:"Date,attr"`
+	Valutes []struct {
+		CharCode string `xml:"CharCode"`
+		Nominal  string `xml:"Nominal"`
+		Value    string `xml:"Value"`
+	} `xml:"Valute"`
+}
+
+// ReadCBRRates reads a Bank of Russia daily rates document. The document is
+// published in windows-1251; only its ASCII fields are read.
+func ReadCBRRates(r io.Reader) (*CBRRates, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = cbrCharsetReader
+
+	var doc cbrValCurs
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot parse CBR rates")
+	}
+
+	date, err := time.ParseInLocation(cbrDateLayout, doc.Date, moscow)
+	if err != nil {
+		return nil, errors.Wrapf(err, "moynalog: CBR rates have an invalid date %q", doc.Date)
+	}
+
+	rates := &CBRRates{Date: date, Rates: make(map[Currency]decimal.Decimal, len(doc.Valutes))}
+	for _, valute := range doc.Valutes {
+		value, err := decimal.NewFromString(strings.Replace(strings.TrimSpace(valute.Value), ",", ".", 1))
+		if err != nil {
+			return nil, errors.Wrapf(err, "moynalog: CBR rate of %s is invalid", valute.CharCode)
+		}
+		nominal, err := decimal.NewFromString(strings.TrimSpace(valute.Nominal))
+		if err != nil || !nominal.IsPositive() {
+			return nil, errors.Errorf("moynalog: CBR nominal of %s is invalid", valute.CharCode)
+		}
+		rates.Rates[Currency(strings.TrimSpace(valute.CharCode))] = value.Div(nominal)
+	}
+
+	return rates, nil
+}
+
+// LoadCBRRates reads the Bank of Russia daily rates document at path, see
+// ReadCBRRates.
+func LoadCBRRates(path string) (*CBRRates, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot read CBR rates")
+	}
+
+	return ReadCBRRates(bytes.NewReader(data))
+}
+
+// cbrCharsetReader accepts the windows-1251 documents of the Bank of Russia.
+// Their only non-ASCII content are currency names, which are not read, so
+// the Cyrillic bytes are replaced rather than decoded.
+func cbrCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if !strings.EqualFold(charset, "windows-1251") {
+		return nil, errors.Errorf("moynalog: unsupported CBR rates charset %q", charset)
+	}
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, b := range data {
+		if b >= utf8.RuneSelf {
+			data[i] = '?'
+		}
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+// CurrencyConversion records how a receipt given in a foreign currency was
+// converted to roubles.
+type CurrencyConversion struct {
+	// ExchangeRate is the rate the receipt was converted at.
+	ExchangeRate ExchangeRate
+	// SourceServices are the receipt lines as given, in the foreign currency.
+	SourceServices []IncomeServiceItem
+	// SourceTotal is the receipt total in the foreign currency.
+	SourceTotal decimal.Decimal
+	// Total is the receipt total registered, in roubles.
+	Total decimal.Decimal
+}
+
+// CreateInCurrency registers a receipt whose amounts are in currency. The
+// receipt total is converted to roubles at the rate of the client's
+// RateProvider on the operation date, and the lines are scaled to it with
+// unit prices rounded to kopecks, the last line absorbing the rounding
+// difference. The operation time is pinned to the one the rate was looked up
+// for, and the conversion is returned in IncomeCreated.Conversion.
+//
+// POST /income
+func (s *IncomeService) CreateInCurrency(ctx context.Context, income *IncomeCreateRequest, currency Currency) (*IncomeCreated, *Response, error) {
+	if income == nil {
+		return nil, nil, invalidArgument("moynalog: income create request cannot be nil")
+	}
+	if currency == CurrencyRUB {
+		return s.Create(ctx, income)
+	}
+	if currency == "" {
+		return nil, nil, invalidArgument("moynalog: currency cannot be empty")
+	}
+	if s.client.rates == nil {
+		return nil, nil, errors.New("moynalog: converting currencies requires a RateProvider, see WithRateProvider")
+	}
+	if err := validateIncomeCreate(&IncomeCreateRequest{Services: income.Services}); err != nil {
+		return nil, nil, err
+	}
+
+	operationTime := income.OperationTime
+	if operationTime.IsZero() {
+		operationTime = time.Now()
+	}
+
+	rate, err := s.client.rates.ExchangeRate(ctx, currency, operationTime)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "moynalog: cannot get the exchange rate of %s", currency)
+	}
+	if !rate.Rate.IsPositive() {
+		return nil, nil, errors.Errorf("moynalog: exchange rate of %s must be greater than 0, got %s", currency, rate.Rate)
+	}
+
+	items := make([]*ServiceItem, len(income.Services))
+	sourceTotal := decimal.Zero
+	for i, item := range income.Services {
+		items[i] = &ServiceItem{Name: item.Name, Amount: item.Amount, Quantity: item.Quantity}
+		sourceTotal = sourceTotal.Add(item.TotalAmount())
+	}
+	total := rate.Convert(sourceTotal)
+	if !total.IsPositive() {
+		return nil, nil, invalidArgument("moynalog: %s %s is less than a kopeck", sourceTotal, currency)
+	}
+
+	converted := *income
+	converted.Services = scaleServices(items, sourceTotal, total)
+	converted.OperationTime = operationTime
+
+	created, resp, err := s.Create(ctx, &converted)
+	if err != nil {
+		return nil, resp, err
+	}
+	created.Conversion = &CurrencyConversion{
+		ExchangeRate:   *rate,
+		SourceServices: append([]IncomeServiceItem(nil), income.Services...),
+		SourceTotal:    sourceTotal,
+		Total:          total,
+	}
+
+	return created, resp, nil
+}
@@ -0,0 +1,184 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// cbrRatesXML is an excerpt of XML_daily.asp, Cyrillic names in windows-1251.
+const cbrRatesXML = `<?xml version="1.0" encoding="windows-1251"?>
+<ValCurs Date="19.10.2026" name="Foreign Currency Market">
+<Valute ID="R01235"><NumCode>840</NumCode><CharCode>USD</CharCode><Nominal>1</Nominal>` +
+	"<Name>\xc4\xee\xeb\xeb\xe0\xf0 \xd1\xd8\xc0</Name>" + `<Value>92,3456</Value></Valute>
+<Valute ID="R01820"><NumCode>392</NumCode><CharCode>JPY</CharCode><Nominal>100</Nominal>` +
+	"<Name>\xc8\xe5\xed</Name>" + `<Value>61,2345</Value></Valute>
+</ValCurs>`
+
+func TestReadCBRRates(t *testing.T) {
+	t.Parallel()
+
+	rates, err := ReadCBRRates(strings.NewReader(cbrRatesXML))
+	if err != nil {
+		t.Fatalf("ReadCBRRates: %v", err)
+	}
+	if want := time.Date(2026, 10, 19, 0, 0, 0, 0, moscow); !rates.Date.Equal(want) {
+		t.Errorf("Date = %v, want %v", rates.Date, want)
+	}
+	for currency, want := range map[Currency]string{CurrencyUSD: "92.3456", "JPY": "0.612345"} {
+		if got := rates.Rates[currency]; got.String() != want {
+			t.Errorf("rate of %s = %s, want %s", currency, got, want)
+		}
+	}
+
+	ctx := context.Background()
+	rate, err := rates.ExchangeRate(ctx, CurrencyUSD, time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ExchangeRate: %v", err)
+	}
+	if rate.Source != RateSourceCBR || !rate.Date.Equal(rates.Date) {
+		t.Errorf("rate = %+v, want the CBR rate of the document date", rate)
+	}
+	if _, err := rates.ExchangeRate(ctx, CurrencyUSD, time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("want an error for a date before the document")
+	}
+	if _, err := rates.ExchangeRate(ctx, CurrencyEUR, rates.Date); err == nil {
+		t.Error("want an error for a currency missing from the document")
+	}
+
+	for _, doc := range []string{
+		`<?xml version="1.0" encoding="koi8-r"?><ValCurs Date="19.10.2026"></ValCurs>`,
+		`<ValCurs Date="2026-10-19"></ValCurs>`,
+		`<ValCurs Date="19.10.2026"><Valute><CharCode>USD</CharCode><Nominal>0</Nominal><Value>1</Value></Valute></ValCurs>`,
+	} {
+		if _, err := ReadCBRRates(strings.NewReader(doc)); err == nil {
+			t.Errorf("ReadCBRRates(%q) = nil error, want one", doc)
+		}
+	}
+}
+
+func TestLoadCBRRates(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "XML_daily.xml")
+	if err := os.WriteFile(path, []byte(cbrRatesXML), 0o600); err != nil {
+		t.Fatalf("write rates: %v", err)
+	}
+	rates, err := LoadCBRRates(path)
+	if err != nil || len(rates.Rates) != 2 {
+		t.Errorf("LoadCBRRates = %+v, %v", rates, err)
+	}
+}
+
+func TestExchangeRateConvert(t *testing.T) {
+	t.Parallel()
+
+	rate := &ExchangeRate{Rate: decimal.RequireFromString("92.3456")}
+	for amount, want := range map[string]string{"35.55": "3282.89", "0.05": "4.62", "1": "92.35"} {
+		if got := rate.Convert(decimal.RequireFromString(amount)); got.String() != want {
+			t.Errorf("Convert(%s) = %s, want %s", amount, got, want)
+		}
+	}
+}
+
+func TestIncomeCreateInCurrency(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	client.rates = FixedRateProvider{CurrencyUSD: decimal.RequireFromString("92.3456")}
+	operationTime := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, r *http.Request) {
+		body := testBody(t, r)
+		// 35.55 USD * 92.3456 = 3282.886..., the last line absorbing a kopeck.
+		if body["totalAmount"] != "3282.89" {
+			t.Errorf("totalAmount = %v, want 3282.89", body["totalAmount"])
+		}
+		want := []map[string]any{
+			{"name": "Разработка", "amount": 923.46, "quantity": 3.0},
+			{"name": "Хостинг", "amount": 512.51, "quantity": 1.0},
+		}
+		services, _ := body["services"].([]any)
+		if len(services) != len(want) {
+			t.Fatalf("services = %v, want %v", services, want)
+		}
+		for i, line := range services {
+			line, _ := line.(map[string]any)
+			for key, value := range want[i] {
+				if line[key] != value {
+					t.Errorf("services[%d].%s = %v, want %v", i, key, line[key], value)
+				}
+			}
+		}
+		if body["operationTime"] != "2026-10-19T15:00:00+03:00" {
+			t.Errorf("operationTime = %v", body["operationTime"])
+		}
+		writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"r1"}`)
+	})
+
+	created, _, err := client.Income.CreateInCurrency(context.Background(), &IncomeCreateRequest{
+		Services: []IncomeServiceItem{
+			{Name: "Разработка", Amount: decimal.NewFromInt(10), Quantity: decimal.NewFromInt(3)},
+			{Name: "Хостинг", Amount: decimal.RequireFromString("5.55"), Quantity: decimal.NewFromInt(1)},
+		},
+		OperationTime: operationTime,
+		Client:        NewForeignAgencyClient("Acme Corp.", "США"),
+	}, CurrencyUSD)
+	if err != nil {
+		t.Fatalf("CreateInCurrency: %v", err)
+	}
+
+	conversion := created.Conversion
+	if created.ApprovedReceiptUUID != "r1" || conversion == nil {
+		t.Fatalf("created = %+v, want the receipt with its conversion", created)
+	}
+	if conversion.ExchangeRate.Source != RateSourceFixed || !conversion.ExchangeRate.Date.Equal(operationTime) {
+		t.Errorf("ExchangeRate = %+v", conversion.ExchangeRate)
+	}
+	if conversion.SourceTotal.String() != "35.55" || conversion.Total.String() != "3282.89" || len(conversion.SourceServices) != 2 {
+		t.Errorf("Conversion = %+v", conversion)
+	}
+}
+
+func TestIncomeCreateInCurrencyRejected(t *testing.T) {
+	t.Parallel()
+
+	income := func() *IncomeCreateRequest {
+		return &IncomeCreateRequest{
+			Services: []IncomeServiceItem{{Name: "Услуга", Amount: decimal.RequireFromString("0.001"), Quantity: decimal.NewFromInt(1)}},
+		}
+	}
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/", func(_ http.ResponseWriter, r *http.Request) {
+		t.Errorf("no request should have been sent, got %s", r.URL)
+	})
+
+	ctx := context.Background()
+	_, _, err := client.Income.CreateInCurrency(ctx, income(), CurrencyUSD)
+	assertNotSent(t, err)
+
+	client.rates = FixedRateProvider{CurrencyUSD: decimal.NewFromInt(2)}
+	_, _, err = client.Income.CreateInCurrency(ctx, income(), CurrencyEUR)
+	assertNotSent(t, err)
+	_, _, err = client.Income.CreateInCurrency(ctx, income(), CurrencyUSD)
+	assertLocalError(t, err)
+	_, _, err = client.Income.CreateInCurrency(ctx, &IncomeCreateRequest{}, CurrencyUSD)
+	assertLocalError(t, err)
+}
+
+// The rate provider must survive deriving an authenticated client.
+func TestWithRateProvider(t *testing.T) {
+	t.Parallel()
+
+	client := NewClient(WithRateProvider(FixedRateProvider{})).WithToken(&AccessToken{Token: "access"})
+	if client.rates == nil {
+		t.Error("WithToken dropped the rate provider")
+	}
+}
@@ -120,3 +120,28 @@ func (s SortBy) Valid() bool {
 		return false
 	}
 }
+
+// InvoiceStatus is where an invoice stands, as told by the receipts issued for
+// it.
+type InvoiceStatus string
+
+// Supported invoice statuses.
+const (
+	// InvoiceStatusPending — no receipt references the invoice yet.
+	InvoiceStatusPending InvoiceStatus = "PENDING"
+	// InvoiceStatusPaid — a registered receipt references the invoice.
+	InvoiceStatusPaid InvoiceStatus = "PAID"
+	// InvoiceStatusCancelled — the only receipts referencing the invoice were
+	// cancelled.
+	InvoiceStatusCancelled InvoiceStatus = "CANCELLED"
+)
+
+// Valid reports whether s is a known invoice status.
+func (s InvoiceStatus) Valid() bool {
+	switch s {
+	case InvoiceStatusPending, InvoiceStatusPaid, InvoiceStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
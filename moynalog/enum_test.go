@@ -60,6 +60,7 @@ func TestEnumValid(t *testing.T) {
 	valid := []interface{ Valid() bool }{
 		BuyerTypePerson, PaymentTypeCash, IncomeTypeIndividual,
 		ReceiptTypeRegistered, CancelCommentRefund, SortByTotalAmountAsc,
+		InvoiceStatusPaid,
 	}
 	for _, value := range valid {
 		if !value.Valid() {
@@ -70,6 +71,7 @@ func TestEnumValid(t *testing.T) {
 	invalid := []interface{ Valid() bool }{
 		BuyerType("NOPE"), PaymentType("NOPE"), IncomeType("NOPE"),
 		ReceiptType("NOPE"), CancelComment("своя причина"), SortBy("nope"),
+		InvoiceStatus("NOPE"),
 	}
 	for _, value := range invalid {
 		if value.Valid() {
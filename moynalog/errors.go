@@ -33,8 +33,41 @@
 
 	// ErrNotImplemented marks endpoints the upstream API does not expose.
 	ErrNotImplemented = errors.New("moynalog: not implemented by the upstream API")
+	// ErrCircuitOpen is returned without a request being sent while the
+	// CircuitBreaker of the client holds the circuit of the endpoint open.
+	ErrCircuitOpen = errors.New("moynalog: circuit breaker is open")
+	// ErrReceiptQueued is returned by IncomeService.Create when the receipt
+	// was handed to the ReceiptQueue of the client instead of being
+	// registered, the circuit of POST /income being open.
+	ErrReceiptQueued = errors.New("moynalog: receipt queued")
+	// ErrInvalidArgument is matched, without a request being sent, by the
+	// errors of arguments the client rejects itself: empty services, an
+	// invalid INN, fractions of a kopeck and the like. Unlike ErrValidation
+	// it is the caller's input at fault, never the API's answer.
+	ErrInvalidArgument = errors.New("moynalog: invalid argument")
 )
 
+// argumentError is an argument rejected by the client. It keeps its own
+// message and matches ErrInvalidArgument.
+type argumentError struct {
+	message string
+}
+
+func (e *argumentError) Error() string {
+	return e.message
+}
+
+// Is lets errors.Is match the error with ErrInvalidArgument.
+func (e *argumentError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+// invalidArgument returns an error matching ErrInvalidArgument with the
+// message format produces.
+func invalidArgument(format string, args ...any) error {
+	return errors.WithStack(&argumentError{message: fmt.Sprintf(format, args...)})
+}
+
 // ErrorResponse reports an error caused by an API request. It unwraps to one of
 // the sentinel errors declared above, so both of these work:
 //
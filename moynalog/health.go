@@ -0,0 +1,221 @@
+package moynalog
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// userStatusActive is the profile status of a taxpayer who may register
+// receipts.
+const userStatusActive = "ACTIVE"
+
+// HealthStatus is the verdict of a health check.
+type HealthStatus string
+
+// Supported health statuses.
+const (
+	// HealthOK — the API answers, the token is accepted and the taxpayer may
+	// register receipts.
+	HealthOK HealthStatus = "ok"
+	// HealthAPIUnreachable — the API could not be reached or failed: a
+	// transport error, a 5xx response or an open circuit.
+	HealthAPIUnreachable HealthStatus = "api_unreachable"
+	// HealthCheckFailed — the check says nothing about the API: it was
+	// cancelled or timed out by its context, or the profile request was
+	// rejected with a 4xx other than 401 and 403.
+	HealthCheckFailed HealthStatus = "check_failed"
+	// HealthTokenInvalid — the client has no token, or the API rejected it and
+	// it could not be refreshed.
+	HealthTokenInvalid HealthStatus = "token_invalid"
+	// HealthRestricted — the taxpayer is in restricted mode or their profile
+	// is not active, so receipts cannot be registered.
+	HealthRestricted HealthStatus = "restricted_mode"
+)
+
+// Health is the report of Client.Ping.
+type Health struct {
+	Status HealthStatus `json:"status"`
+	// Err is why the check did not pass, nil when Status is HealthOK. Error
+	// is its message.
+	Err   error  `json:"-"`
+	Error string `json:"error,omitempty"`
+	// CheckedAt is when the check started and Latency how long it took.
+	CheckedAt time.Time     `json:"checkedAt"`
+	Latency   time.Duration `json:"-"`
+	// RequestID identifies the profile request for nalog.ru support.
+	RequestID string `json:"requestId,omitempty"`
+
+	// Inn, UserStatus and RestrictedMode come from the taxpayer profile, if
+	// it could be read. Inn is left out of the JSON, HealthHandler only
+	// serves it with WithHealthInn.
+	Inn            string `json:"-"`
+	UserStatus     string `json:"userStatus,omitempty"`
+	RestrictedMode bool   `json:"restrictedMode"`
+
+	// The expiry of the access and refresh tokens after the check, zero when
+	// unknown or never.
+	TokenExpiresAt   time.Time `json:"tokenExpiresAt,omitzero"`
+	TokenExpired     bool      `json:"tokenExpired"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt,omitzero"`
+	RefreshExpired   bool      `json:"refreshExpired"`
+	// TokenRefreshed reports whether the check had to refresh the token;
+	// persist Client.Token when it did.
+	TokenRefreshed bool `json:"tokenRefreshed"`
+}
+
+// OK reports whether the check passed.
+func (h *Health) OK() bool {
+	return h.Status == HealthOK
+}
+
+// Ping checks that the API is reachable, the token is valid and the taxpayer
+// is allowed to register receipts, by reading the taxpayer profile. The
+// report is never nil; its Status tells the failures apart.
+//
+// GET /user
+func (c *Client) Ping(ctx context.Context) *Health {
+	health := &Health{CheckedAt: time.Now()}
+	defer func() {
+		health.Latency = time.Since(health.CheckedAt)
+		if health.Err != nil {
+			health.Error = health.Err.Error()
+		}
+		health.setToken(c.Token())
+	}()
+
+	if c.Token() == nil {
+		health.Status, health.Err = HealthTokenInvalid, errNoAccessToken
+
+		return health
+	}
+
+	user, resp, err := c.Users.Get(ctx)
+	if resp != nil {
+		health.RequestID = resp.RequestID
+		health.TokenRefreshed = resp.TokenRefreshed
+	}
+	if err != nil {
+		health.Status, health.Err = healthStatusOf(err), err
+
+		return health
+	}
+
+	health.Inn = user.Inn
+	health.UserStatus = user.Status
+	health.RestrictedMode = user.RestrictedMode
+	switch {
+	case user.RestrictedMode:
+		health.Status = HealthRestricted
+		health.Err = errors.New("moynalog: taxpayer is in restricted mode")
+	case user.Status != "" && user.Status != userStatusActive:
+		health.Status = HealthRestricted
+		health.Err = errors.Errorf("moynalog: taxpayer profile is %s", user.Status)
+	default:
+		health.Status = HealthOK
+	}
+
+	return health
+}
+
+// healthStatusOf classifies the error of a failed profile request. Only
+// transport errors, 5xx responses and an open circuit tell the API is down.
+func healthStatusOf(err error) HealthStatus {
+	var (
+		errResp *ErrorResponse
+		netErr  net.Error
+	)
+	switch {
+	case errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden):
+		return HealthTokenInvalid
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return HealthCheckFailed
+	case errors.Is(err, ErrServer) || errors.Is(err, ErrCircuitOpen):
+		return HealthAPIUnreachable
+	case errors.As(err, &errResp):
+		if errResp.StatusCode() >= http.StatusInternalServerError {
+			return HealthAPIUnreachable
+		}
+
+		return HealthCheckFailed
+	case errors.As(err, &netErr):
+		return HealthAPIUnreachable
+	default:
+		return HealthCheckFailed
+	}
+}
+
+func (h *Health) setToken(token *AccessToken) {
+	if token == nil {
+		h.TokenExpired, h.RefreshExpired = true, true
+
+		return
+	}
+
+	h.TokenExpiresAt = token.TokenExpireIn.Time
+	h.TokenExpired = token.IsExpired()
+	h.RefreshExpiresAt = token.RefreshTokenExpiresIn.Time
+	h.RefreshExpired = token.IsRefreshExpired()
+}
+
+// HealthHandler is an http.Handler serving the report of Client.Ping as JSON,
+// for readiness probes: 200 when the check passed, 503 otherwise. The INN of
+// the taxpayer is left out unless WithHealthInn is given, as probes are often
+// exposed beyond the service.
+type HealthHandler struct {
+	client  *Client
+	withInn bool
+}
+
+// HealthHandlerOption customises a HealthHandler.
+type HealthHandlerOption func(*HealthHandler)
+
+// WithHealthInn adds the INN of the taxpayer to the report.
+func WithHealthInn() HealthHandlerOption {
+	return func(h *HealthHandler) {
+		h.withInn = true
+	}
+}
+
+// NewHealthHandler returns a handler checking client on every request.
+func NewHealthHandler(client *Client, opts ...HealthHandlerOption) *HealthHandler {
+	h := &HealthHandler{client: client}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	health := h.client.Ping(r.Context())
+	status := http.StatusOK
+	if !health.OK() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	report := struct {
+		*Health
+		Inn     string `json:"inn,omitempty"`
+		Latency string `json:"latency"`
+	}{Health: health, Latency: health.Latency.String()}
+	if h.withInn {
+		report.Inn = health.Inn
+	}
+	//nolint:gosec // G104: the status line is already out; nothing to report to.
+	_ = json.NewEncoder(w).Encode(report)
+}
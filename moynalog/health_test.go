@@ -0,0 +1,182 @@
+package moynalog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		status int
+		user   string
+		want   HealthStatus
+	}{
+		{"active", http.StatusOK, `{"inn":"500100732259","status":"ACTIVE","restrictedMode":false}`, HealthOK},
+		{"restricted", http.StatusOK, `{"inn":"500100732259","status":"ACTIVE","restrictedMode":true}`, HealthRestricted},
+		{"deregistered", http.StatusOK, `{"inn":"500100732259","status":"DEREGISTERED"}`, HealthRestricted},
+		{"server error", http.StatusInternalServerError, `{"message":"maintenance"}`, HealthAPIUnreachable},
+		{"maintenance", http.StatusServiceUnavailable, `{"message":"maintenance"}`, HealthAPIUnreachable},
+		{"forbidden", http.StatusForbidden, `{"message":"forbidden"}`, HealthTokenInvalid},
+		{"rate limited", http.StatusTooManyRequests, `{"message":"too many requests"}`, HealthCheckFailed},
+		{"not found", http.StatusNotFound, `{"message":"not found"}`, HealthCheckFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, mux := setupAuthed(t)
+			mux.HandleFunc("/v1/user", func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("X-Request-Id", "req-1")
+				writeJSON(t, w, tt.status, tt.user)
+			})
+
+			health := client.Ping(context.Background())
+			if health.Status != tt.want {
+				t.Fatalf("Status = %s (%v), want %s", health.Status, health.Err, tt.want)
+			}
+			if health.OK() != (health.Err == nil) || health.OK() != (health.Error == "") {
+				t.Errorf("Err = %v with status %s", health.Err, health.Status)
+			}
+			if health.RequestID != "req-1" || health.CheckedAt.IsZero() || health.Latency <= 0 {
+				t.Errorf("health = %+v, want the request ID and timing", health)
+			}
+		})
+	}
+}
+
+func TestPingRejectedToken(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/user", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusUnauthorized, `{"message":"token expired"}`)
+	})
+	mux.HandleFunc("/v1/auth/token", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusUnauthorized, `{"message":"refresh token expired"}`)
+	})
+
+	if health := client.Ping(context.Background()); health.Status != HealthTokenInvalid {
+		t.Errorf("Status = %s (%v), want token invalid", health.Status, health.Err)
+	}
+}
+
+func TestPingWithoutToken(t *testing.T) {
+	t.Parallel()
+
+	client, _ := setup(t)
+	health := client.Ping(context.Background())
+	if health.Status != HealthTokenInvalid || !health.TokenExpired || !health.RefreshExpired {
+		t.Errorf("health = %+v, want token invalid without a request", health)
+	}
+}
+
+func TestPingUnreachable(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client := NewClient(WithEndpoint(server.URL), WithDeviceID("testdeviceid")).WithToken(&AccessToken{Token: "t"})
+
+	if health := client.Ping(context.Background()); health.Status != HealthAPIUnreachable {
+		t.Errorf("Status = %s (%v), want API unreachable", health.Status, health.Err)
+	}
+}
+
+// A check cut short by its own context says nothing about the API.
+func TestPingCancelled(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/user", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{"status":"ACTIVE"}`)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if health := client.Ping(ctx); health.Status != HealthCheckFailed {
+		t.Errorf("cancelled: Status = %s (%v), want %s", health.Status, health.Err, HealthCheckFailed)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if health := client.Ping(ctx); health.Status != HealthCheckFailed {
+		t.Errorf("timed out: Status = %s (%v), want %s", health.Status, health.Err, HealthCheckFailed)
+	}
+}
+
+// The INN stays out of the probe unless asked for.
+func TestHealthHandlerInn(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/user", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{"inn":"500100732259","status":"ACTIVE"}`)
+	})
+
+	for _, tt := range []struct {
+		handler *HealthHandler
+		want    bool
+	}{
+		{NewHealthHandler(client), false},
+		{NewHealthHandler(client, WithHealthInn()), true},
+	} {
+		rec := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if got := strings.Contains(rec.Body.String(), "500100732259"); got != tt.want {
+			t.Errorf("body = %s, want the INN included %t", rec.Body, tt.want)
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	restricted := false
+	mux.HandleFunc("/v1/user", func(w http.ResponseWriter, _ *http.Request) {
+		if restricted {
+			writeJSON(t, w, http.StatusOK, `{"status":"ACTIVE","restrictedMode":true}`)
+
+			return
+		}
+		writeJSON(t, w, http.StatusOK, `{"status":"ACTIVE"}`)
+	})
+	handler := NewHealthHandler(client)
+
+	check := func(method string, wantCode int, wantStatus HealthStatus) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, "/healthz", nil))
+		if rec.Code != wantCode {
+			t.Errorf("%s code = %d, want %d", method, rec.Code, wantCode)
+		}
+		if wantStatus == "" {
+			return
+		}
+
+		var body struct {
+			Status  HealthStatus `json:"status"`
+			Latency string       `json:"latency"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		if body.Status != wantStatus || body.Latency == "" {
+			t.Errorf("body = %s, want status %s and latency", rec.Body, wantStatus)
+		}
+	}
+
+	check(http.MethodGet, http.StatusOK, HealthOK)
+	restricted = true
+	check(http.MethodGet, http.StatusServiceUnavailable, HealthRestricted)
+	check(http.MethodPost, http.StatusMethodNotAllowed, "")
+}
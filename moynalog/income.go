@@ -4,7 +4,7 @@
 	"context"
 	"encoding/json"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,8 +16,9 @@
 	minListLimit = 1
 	maxListLimit = 100
 
-	innLengthIndividual  = 12
-	innLengthLegalEntity = 10
+	// foreignAgencyINNPrefix starts the INN of every foreign organisation
+	// registered with the Russian tax authority.
+	foreignAgencyINNPrefix = "9909"
 )
 
 // IncomeService handles the receipt (income) endpoints.
@@ -30,6 +31,14 @@ type IncomeClient struct {
 	DisplayName  string     `json:"displayName"`
 	IncomeType   IncomeType `json:"incomeType"`
 	Inn          string     `json:"inn"`
+	// Country is the country of a foreign agency, required when registering
+	// a receipt for one. The API has no field for it, so it is checked but
+	// not sent, and a client read back from a receipt leaves it empty.
+	Country string `json:"-"`
+
+	// registered marks a client read back from a registered receipt, which
+	// the API accepted without a country.
+	registered bool
 }
 
 // MarshalJSON implements json.Marshaler. Absent fields must be sent as null,
@@ -53,6 +62,17 @@ func (c IncomeClient) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// NewForeignAgencyClient returns the counterparty of a receipt issued to a
+// foreign organisation. Both name and country are required: Create rejects
+// the client when either is blank.
+func NewForeignAgencyClient(name, country string) *IncomeClient {
+	return &IncomeClient{
+		DisplayName: strings.TrimSpace(name),
+		Country:     strings.TrimSpace(country),
+		IncomeType:  IncomeTypeForeignAgency,
+	}
+}
+
 // IncomeServiceItem is a single line of a receipt.
 type IncomeServiceItem struct {
 	Name     string          `json:"name"`
@@ -108,22 +128,59 @@ type incomeCreateBody struct {
 // IncomeCreated identifies a freshly registered receipt.
 type IncomeCreated struct {
 	ApprovedReceiptUUID string `json:"approvedReceiptUuid"`
+
+	// Conversion is set by IncomeService.CreateInCurrency to how the foreign
+	// currency amounts were converted. It is not part of the API response.
+	Conversion *CurrencyConversion `json:"-"`
 }
 
-// Create registers a receipt.
+// Create registers a receipt. With a CounterpartyResolver configured, the
+// DisplayName of a client given only by Inn is looked up first. Amounts are
+// checked and rounded according to the client's AmountPolicy. With a
+// ReceiptQueue configured, a receipt the CircuitBreaker keeps from the API is
+// queued and Create returns an error matching ErrReceiptQueued.
 //
 // POST /income
 func (s *IncomeService) Create(ctx context.Context, income *IncomeCreateRequest) (*IncomeCreated, *Response, error) {
+	created, resp, err := s.create(ctx, income)
+	if err != nil && s.client.receiptQueue != nil && errors.Is(err, ErrCircuitOpen) {
+		return nil, resp, s.enqueue(ctx, income, err)
+	}
+
+	return created, resp, err
+}
+
+// create implements Create without falling back to the ReceiptQueue.
+func (s *IncomeService) create(ctx context.Context, income *IncomeCreateRequest) (*IncomeCreated, *Response, error) {
 	if income == nil {
-		return nil, nil, errors.New("moynalog: income create request cannot be nil")
+		return nil, nil, invalidArgument("moynalog: income create request cannot be nil")
+	}
+	buyer, err := s.client.resolveClient(ctx, income.Client)
+	if err != nil {
+		return nil, nil, err
 	}
+	incomeCopy := *income
+	incomeCopy.Client = buyer
+	income = &incomeCopy
+
 	if err := validateIncomeCreate(income); err != nil {
 		return nil, nil, err
 	}
 
+	policy := s.client.amountPolicy
+	services := make([]IncomeServiceItem, len(income.Services))
 	totalAmount := decimal.Zero
-	for _, item := range income.Services {
-		totalAmount = totalAmount.Add(item.TotalAmount())
+	for i, item := range income.Services {
+		amount, lineTotal, err := policy.line(i, item.Amount, item.Quantity)
+		if err != nil {
+			return nil, nil, err
+		}
+		item.Amount = amount
+		services[i] = item
+		totalAmount = totalAmount.Add(lineTotal)
+	}
+	if err := policy.checkTotal(totalAmount); err != nil {
+		return nil, nil, err
 	}
 
 	paymentType := income.PaymentType
@@ -137,17 +194,12 @@ func (s *IncomeService) Create(ctx context.Context, income *IncomeCreateRequest)
 		operationTime = requestTime
 	}
 
-	client := IncomeClient{IncomeType: IncomeTypeIndividual}
-	if income.Client != nil {
-		client = *income.Client
-	}
-
 	body := &incomeCreateBody{
-		OperationTime:                   NewTime(operationTime),
-		RequestTime:                     NewTime(requestTime),
-		Services:                        income.Services,
+		OperationTime:                   s.client.apiTime(operationTime),
+		RequestTime:                     s.client.apiTime(requestTime),
+		Services:                        services,
 		TotalAmount:                     totalAmount.String(),
-		Client:                          client,
+		Client:                          wireClient(income.Client),
 		PaymentType:                     paymentType,
 		IgnoreMaxTotalIncomeRestriction: income.IgnoreMaxTotalIncomeRestriction,
 	}
@@ -176,58 +228,99 @@ func (s *IncomeService) CreateItem(ctx context.Context, name string, amount, qua
 
 func validateIncomeCreate(income *IncomeCreateRequest) error {
 	if len(income.Services) == 0 {
-		return errors.New("moynalog: services cannot be empty")
+		return invalidArgument("moynalog: services cannot be empty")
 	}
 
 	for i, item := range income.Services {
 		if item.Name == "" {
-			return errors.Errorf("moynalog: name of item[%d] cannot be empty", i)
+			return invalidArgument("moynalog: name of item[%d] cannot be empty", i)
 		}
 		if item.Amount.LessThanOrEqual(decimal.Zero) {
-			return errors.Errorf("moynalog: amount of item[%d] must be greater than 0", i)
+			return invalidArgument("moynalog: amount of item[%d] must be greater than 0", i)
 		}
 		if item.Quantity.LessThanOrEqual(decimal.Zero) {
-			return errors.Errorf("moynalog: quantity of item[%d] must be greater than 0", i)
+			return invalidArgument("moynalog: quantity of item[%d] must be greater than 0", i)
 		}
 	}
 
 	if income.PaymentType != "" && !income.PaymentType.Valid() {
-		return errors.Errorf("moynalog: payment type %q is invalid", income.PaymentType)
+		return invalidArgument("moynalog: payment type %q is invalid", income.PaymentType)
 	}
 
 	return validateIncomeClient(income.Client)
 }
 
 // validateIncomeClient checks the counterparty of a receipt or an invoice. An
-// empty income type is allowed and defaults to an individual on the wire.
+// empty income type is allowed and defaults to an individual on the wire. An
+// INN, whenever given, must pass the control digit check, and a contact phone
+// must be convertible to E.164.
 func validateIncomeClient(client *IncomeClient) error {
 	if client == nil {
 		return nil
 	}
 	if client.IncomeType != "" && !client.IncomeType.Valid() {
-		return errors.Errorf("moynalog: income type %q is invalid", client.IncomeType)
+		return invalidArgument("moynalog: income type %q is invalid", client.IncomeType)
+	}
+	if client.Inn != "" {
+		if err := validateINN(client.Inn, "client INN"); err != nil {
+			return err
+		}
+	}
+	if client.ContactPhone != "" {
+		if _, err := normalizePhone(client.ContactPhone); err != nil {
+			return err
+		}
+	}
+	if client.IncomeType == IncomeTypeForeignAgency {
+		return validateForeignAgencyClient(client)
 	}
 	if client.IncomeType != IncomeTypeLegalEntity {
 		return nil
 	}
 
-	// Only receipts issued to a legal entity have to identify it.
+	// Only receipts issued to an organisation have to identify it.
 	if client.Inn == "" {
-		return errors.New("moynalog: client INN cannot be empty")
+		return invalidArgument("moynalog: client INN cannot be empty")
+	}
+	if client.DisplayName == "" {
+		return invalidArgument("moynalog: client display name cannot be empty")
 	}
-	if _, err := strconv.ParseUint(client.Inn, 10, 64); err != nil {
-		return errors.New("moynalog: client INN must contain only digits")
+
+	return nil
+}
+
+// validateForeignAgencyClient checks a foreign organisation: it must be named
+// and have a country, and an INN, if any, must be one issued to foreign
+// organisations.
+func validateForeignAgencyClient(client *IncomeClient) error {
+	if strings.TrimSpace(client.DisplayName) == "" {
+		return invalidArgument("moynalog: foreign agency display name cannot be empty")
 	}
-	if len(client.Inn) != innLengthLegalEntity && len(client.Inn) != innLengthIndividual {
-		return errors.Errorf("moynalog: client INN length must be %d or %d", innLengthLegalEntity, innLengthIndividual)
+	if strings.TrimSpace(client.Country) == "" && !client.registered {
+		return invalidArgument("moynalog: foreign agency country cannot be empty")
 	}
-	if client.DisplayName == "" {
-		return errors.New("moynalog: client display name cannot be empty")
+	if client.Inn != "" && !strings.HasPrefix(client.Inn, foreignAgencyINNPrefix) {
+		return invalidArgument("moynalog: foreign agency INN must start with %s", foreignAgencyINNPrefix)
 	}
 
 	return nil
 }
 
+// wireClient returns the counterparty as sent to the API: an anonymous
+// individual when client is nil, with the contact phone in E.164 format.
+// client must have passed validateIncomeClient.
+func wireClient(client *IncomeClient) IncomeClient {
+	wire := IncomeClient{IncomeType: IncomeTypeIndividual}
+	if client != nil {
+		wire = *client
+	}
+	if wire.ContactPhone != "" {
+		wire.ContactPhone, _ = normalizePhone(wire.ContactPhone)
+	}
+
+	return wire
+}
+
 // IncomeListOptions filters and paginates a receipt listing.
 type IncomeListOptions struct {
 	From        Time        `url:"from,omitempty"`
@@ -237,6 +330,9 @@ type IncomeListOptions struct {
 	SortBy      SortBy      `url:"sortBy,omitempty"`
 	BuyerType   BuyerType   `url:"buyerType,omitempty"`
 	ReceiptType ReceiptType `url:"receiptType,omitempty"`
+	// TaxPeriod lists the receipts of one tax period instead of those
+	// between From and To, which must then be left zero.
+	TaxPeriod TaxPeriod `url:"-"`
 }
 
 // IncomeList is one page of registered receipts.
@@ -273,6 +369,11 @@ type IncomeListItem struct {
 	InvoiceID           string            `json:"invoiceId"`
 }
 
+// TaxPeriod returns TaxPeriodID as a TaxPeriod.
+func (i *IncomeListItem) TaxPeriod() TaxPeriod {
+	return TaxPeriod(i.TaxPeriodID)
+}
+
 // Cancelled reports whether the receipt has been cancelled.
 func (i *IncomeListItem) Cancelled() bool {
 	return i.CancellationInfo != nil
@@ -294,8 +395,15 @@ type CancellationInfo struct {
 	Comment       CancelComment `json:"comment"`
 }
 
+// TaxPeriod returns TaxPeriodID as a TaxPeriod.
+func (c *CancellationInfo) TaxPeriod() TaxPeriod {
+	return TaxPeriod(c.TaxPeriodID)
+}
+
 // List returns a page of registered receipts. A nil opts lists the 100 most
-// recent receipts.
+// recent receipts. From and To are sent in the client's location; build
+// day boundaries with Client.Date. A TaxPeriod is listed from the start to the
+// end of its Moscow month.
 //
 // GET /incomes
 func (s *IncomeService) List(ctx context.Context, opts *IncomeListOptions) (*IncomeList, *Response, error) {
@@ -310,16 +418,30 @@ func (s *IncomeService) List(ctx context.Context, opts *IncomeListOptions) (*Inc
 	if query.Limit == 0 {
 		query.Limit = maxListLimit
 	}
+	if query.TaxPeriod != 0 {
+		if !query.TaxPeriod.Valid() {
+			return nil, nil, invalidArgument("moynalog: tax period %s is invalid", query.TaxPeriod)
+		}
+		if !query.From.IsZero() || !query.To.IsZero() {
+			return nil, nil, invalidArgument("moynalog: tax period cannot be combined with from and to")
+		}
+		// The listing has millisecond precision, so stop just short of the
+		// next period.
+		query.From = NewTime(query.TaxPeriod.Start())
+		query.To = NewTime(query.TaxPeriod.End().Add(-time.Millisecond))
+	}
+	query.From = s.client.apiTime(query.From.Time)
+	query.To = s.client.apiTime(query.To.Time)
 	query.Limit = clamp(query.Limit, minListLimit, maxListLimit)
 
 	if query.SortBy != "" && !query.SortBy.Valid() {
-		return nil, nil, errors.Errorf("moynalog: sort order %q is invalid", query.SortBy)
+		return nil, nil, invalidArgument("moynalog: sort order %q is invalid", query.SortBy)
 	}
 	if query.BuyerType != "" && !query.BuyerType.Valid() {
-		return nil, nil, errors.Errorf("moynalog: buyer type %q is invalid", query.BuyerType)
+		return nil, nil, invalidArgument("moynalog: buyer type %q is invalid", query.BuyerType)
 	}
 	if query.ReceiptType != "" && !query.ReceiptType.Valid() {
-		return nil, nil, errors.Errorf("moynalog: receipt type %q is invalid", query.ReceiptType)
+		return nil, nil, invalidArgument("moynalog: receipt type %q is invalid", query.ReceiptType)
 	}
 
 	u, err := addOptions("incomes", query)
@@ -341,6 +463,29 @@ func (s *IncomeService) List(ctx context.Context, opts *IncomeListOptions) (*Inc
 	return list, resp, nil
 }
 
+// walk pages through the listing described by opts, calling fn for every
+// receipt until fn returns false or the listing is exhausted. opts.Offset is
+// the starting point and opts.Limit the page size.
+func (s *IncomeService) walk(ctx context.Context, opts IncomeListOptions, fn func(*IncomeListItem) bool) error {
+	for {
+		page, _, err := s.List(ctx, &opts)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range page.Content {
+			if item != nil && !fn(item) {
+				return nil
+			}
+		}
+
+		if !page.HasMore || len(page.Content) == 0 {
+			return nil
+		}
+		opts.Offset += len(page.Content)
+	}
+}
+
 // IncomeCancelRequest describes a receipt cancellation.
 type IncomeCancelRequest struct {
 	// ReceiptUUID identifies the receipt to cancel. Required.
@@ -400,13 +545,13 @@ func (c *IncomeCancelled) UnmarshalJSON(data []byte) error {
 // POST /cancel
 func (s *IncomeService) Cancel(ctx context.Context, income *IncomeCancelRequest) (*IncomeCancelled, *Response, error) {
 	if income == nil {
-		return nil, nil, errors.New("moynalog: income cancel request cannot be nil")
+		return nil, nil, invalidArgument("moynalog: income cancel request cannot be nil")
 	}
 	if income.ReceiptUUID == "" {
-		return nil, nil, errors.New("moynalog: receipt UUID cannot be empty")
+		return nil, nil, invalidArgument("moynalog: receipt UUID cannot be empty")
 	}
 	if !income.Comment.Valid() {
-		return nil, nil, errors.Errorf("moynalog: cancel comment %q is invalid", income.Comment)
+		return nil, nil, invalidArgument("moynalog: cancel comment %q is invalid", income.Comment)
 	}
 
 	now := time.Now()
@@ -420,8 +565,8 @@ func (s *IncomeService) Cancel(ctx context.Context, income *IncomeCancelRequest)
 	}
 
 	body := &incomeCancelBody{
-		OperationTime: NewTime(operationTime),
-		RequestTime:   NewTime(requestTime),
+		OperationTime: s.client.apiTime(operationTime),
+		RequestTime:   s.client.apiTime(requestTime),
 		Comment:       income.Comment,
 		ReceiptUUID:   income.ReceiptUUID,
 		PartnerCode:   nullableString(income.PartnerCode),
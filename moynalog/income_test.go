@@ -3,6 +3,7 @@
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"strings"
 	"testing"
@@ -154,9 +155,29 @@ func TestIncomeCreateValidation(t *testing.T) {
 		},
 		{
 			"legal entity without a display name",
-			&IncomeCreateRequest{Services: []IncomeServiceItem{valid}, Client: legalEntity("7724035047", "")},
+			&IncomeCreateRequest{Services: []IncomeServiceItem{valid}, Client: legalEntity("7707083893", "")},
 			"client display name cannot be empty",
 		},
+		{
+			"foreign agency without a name",
+			&IncomeCreateRequest{Services: []IncomeServiceItem{valid}, Client: NewForeignAgencyClient(" ", "США")},
+			"foreign agency display name cannot be empty",
+		},
+		{
+			"foreign agency without a country",
+			&IncomeCreateRequest{Services: []IncomeServiceItem{valid}, Client: NewForeignAgencyClient("Acme Inc.", " ")},
+			"foreign agency country cannot be empty",
+		},
+		{
+			"foreign agency with a Russian INN",
+			&IncomeCreateRequest{Services: []IncomeServiceItem{valid}, Client: &IncomeClient{
+				IncomeType:  IncomeTypeForeignAgency,
+				DisplayName: "Acme Inc.",
+				Country:     "США",
+				Inn:         "7707083893",
+			}},
+			"foreign agency INN must start with 9909",
+		},
 	}
 
 	for _, tt := range tests {
@@ -185,8 +206,8 @@ func TestIncomeCreateAcceptsLegalEntity(t *testing.T) {
 		if !ok {
 			t.Fatal("client must be an object")
 		}
-		if client["inn"] != "7724035047" {
-			t.Errorf("client.inn = %v, want %q", client["inn"], "7724035047")
+		if client["inn"] != "7707083893" {
+			t.Errorf("client.inn = %v, want %q", client["inn"], "7707083893")
 		}
 		writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"legal"}`)
 	})
@@ -199,7 +220,7 @@ func TestIncomeCreateAcceptsLegalEntity(t *testing.T) {
 		}},
 		Client: &IncomeClient{
 			IncomeType:  IncomeTypeLegalEntity,
-			Inn:         "7724035047",
+			Inn:         "7707083893",
 			DisplayName: "ИП Литвинов Сергей Александрович",
 		},
 	})
@@ -220,7 +241,8 @@ func TestIncomeList(t *testing.T) {
 			"sortBy":      string(SortByOperationTimeDesc),
 			"buyerType":   string(BuyerTypePerson),
 			"receiptType": string(ReceiptTypeRegistered),
-			"from":        "2021-03-30T22:39:54.391Z",
+			// Filters go out in Moscow time.
+			"from": "2021-03-31T01:39:54.391+03:00",
 		})
 
 		writeJSON(t, w, http.StatusOK, `{
@@ -288,6 +310,61 @@ func TestIncomeList(t *testing.T) {
 	}
 }
 
+// A tax period is a Moscow month whatever the client's location: its bounds
+// are only written in the client's zone, and decoded times stay in Moscow.
+func TestIncomeListInLocation(t *testing.T) {
+	t.Parallel()
+
+	vladivostok, err := time.LoadLocation("Asia/Vladivostok")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	client, mux := setupAuthed(t)
+	client.location = vladivostok
+	mux.HandleFunc("/v1/incomes", func(w http.ResponseWriter, r *http.Request) {
+		testQuery(t, r, map[string]string{
+			"from": "2024-09-01T07:00:00.000+10:00",
+			"to":   "2024-10-01T06:59:59.999+10:00",
+		})
+		writeJSON(t, w, http.StatusOK, `{"content":[{"approvedReceiptUuid":"r1","operationTime":"2024-09-01T12:00:00"}]}`)
+	})
+
+	list, _, err := client.Income.List(context.Background(), &IncomeListOptions{TaxPeriod: 202409})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	at := list.Content[0].OperationTime
+	if at.Location() != moscow || !at.Equal(time.Date(2024, time.September, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("OperationTime = %s, want the Moscow wall clock time", at)
+	}
+}
+
+// A receipt registered just before midnight UTC belongs to the next day, and
+// possibly the next tax period, in Moscow, and must be sent as such.
+func TestIncomeCreateSendsMoscowTime(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, r *http.Request) {
+		body := testBody(t, r)
+		if body["operationTime"] != "2024-10-01T01:30:00+03:00" {
+			t.Errorf("operationTime = %v, want it in Moscow time", body["operationTime"])
+		}
+		if requestTime, _ := body["requestTime"].(string); !strings.HasSuffix(requestTime, "+03:00") {
+			t.Errorf("requestTime = %v, want it in Moscow time", body["requestTime"])
+		}
+		writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"r1"}`)
+	})
+
+	_, _, err := client.Income.Create(context.Background(), &IncomeCreateRequest{
+		Services:      []IncomeServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(1), Quantity: decimal.NewFromInt(1)}},
+		OperationTime: time.Date(2024, time.September, 30, 22, 30, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
 // A nil options value must still produce the API defaults.
 func TestIncomeListDefaults(t *testing.T) {
 	t.Parallel()
@@ -529,9 +606,9 @@ func TestIncomeCreateINNLength(t *testing.T) {
 		wantErr bool
 	}{
 		{"nine digits", strings.Repeat("1", 9), true},
-		{"ten digits", strings.Repeat("1", 10), false},
+		{"ten digits", "7707083893", false},
 		{"eleven digits", strings.Repeat("1", 11), true},
-		{"twelve digits", strings.Repeat("1", 12), false},
+		{"twelve digits", "500100732259", false},
 		{"thirteen digits", strings.Repeat("1", 13), true},
 	}
 
@@ -568,7 +645,7 @@ func TestIncomeCreateINNLength(t *testing.T) {
 	}
 }
 
-// Only legal entities are validated; a foreign agency needs no INN.
+// A foreign agency needs no INN.
 func TestIncomeCreateForeignAgencyNeedsNoINN(t *testing.T) {
 	t.Parallel()
 
@@ -584,9 +661,10 @@ func TestIncomeCreateForeignAgencyNeedsNoINN(t *testing.T) {
 			Quantity: decimal.NewFromInt(1),
 		}},
 		Client: &IncomeClient{
-			ContactPhone: "phone",
+			ContactPhone: "+79001234567",
 			DisplayName:  "testClient",
 			IncomeType:   IncomeTypeForeignAgency,
+			Country:      "Германия",
 		},
 	})
 	if err != nil {
@@ -594,6 +672,80 @@ func TestIncomeCreateForeignAgencyNeedsNoINN(t *testing.T) {
 	}
 }
 
+func TestNewForeignAgencyClient(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name, country, wantName, wantCountry string
+	}{
+		{"Acme Inc.", "США", "Acme Inc.", "США"},
+		{" Acme GmbH ", " Germany ", "Acme GmbH", "Germany"},
+	}
+
+	for _, tt := range tests {
+		got := NewForeignAgencyClient(tt.name, tt.country)
+		if got.DisplayName != tt.wantName || got.Country != tt.wantCountry || got.IncomeType != IncomeTypeForeignAgency || got.Inn != "" {
+			t.Errorf("NewForeignAgencyClient(%q, %q) = %+v, want %q from %q", tt.name, tt.country, got, tt.wantName, tt.wantCountry)
+		}
+	}
+}
+
+// The client of a foreign agency receipt goes out with the name only, or with
+// a foreign organisation INN when one is known.
+func TestIncomeCreateForeignAgencyPayload(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		client *IncomeClient
+		want   string
+	}{
+		{
+			"name and country",
+			NewForeignAgencyClient("Acme Inc.", "США"),
+			`{"contactPhone":null,"displayName":"Acme Inc.","incomeType":"FROM_FOREIGN_AGENCY","inn":null}`,
+		},
+		{
+			"registered in Russia",
+			&IncomeClient{IncomeType: IncomeTypeForeignAgency, DisplayName: "Acme GmbH", Country: "Германия", Inn: "9909000004"},
+			`{"contactPhone":null,"displayName":"Acme GmbH","incomeType":"FROM_FOREIGN_AGENCY","inn":"9909000004"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, mux := setupAuthed(t)
+			mux.HandleFunc("/v1/income", func(w http.ResponseWriter, r *http.Request) {
+				raw, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatalf("read body: %v", err)
+				}
+				body := struct {
+					Client json.RawMessage `json:"client"`
+				}{}
+				if err := json.Unmarshal(raw, &body); err != nil {
+					t.Fatalf("decode body: %v", err)
+				}
+				if string(body.Client) != tt.want {
+					t.Errorf("client = %s, want %s", body.Client, tt.want)
+				}
+				writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"foreign"}`)
+			})
+
+			_, _, err := client.Income.Create(context.Background(), &IncomeCreateRequest{
+				Services:    []IncomeServiceItem{{Name: "Software development", Amount: decimal.NewFromInt(90000), Quantity: decimal.NewFromInt(1)}},
+				Client:      tt.client,
+				PaymentType: PaymentTypeAccount,
+			})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		})
+	}
+}
+
 func TestIncomeListLimitClamp(t *testing.T) {
 	t.Parallel()
 
@@ -6,11 +6,12 @@
 	"net/http"
 	"time"
 
-	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 )
 
-// InvoiceService handles the payment invoice endpoints.
+// InvoiceService handles the payment invoice endpoints. The API only issues
+// invoices, with POST /invoice. It has no endpoints to list, cancel or update
+// them, so Status and Statuses work from the receipt listing instead.
 type InvoiceService service
 
 // InvoiceServiceItem is a single line of an invoice.
@@ -66,34 +67,50 @@ type invoiceCreateBody struct {
 }
 
 // Create issues an invoice. Invoices are always settled through an account, so
-// the payment type is fixed to PaymentTypeAccount.
+// the payment type is fixed to PaymentTypeAccount. Amounts are checked and
+// rounded according to the client's AmountPolicy.
 //
 // POST /invoice
 func (s *InvoiceService) Create(ctx context.Context, invoice *InvoiceCreateRequest) (*IncomeCreated, *Response, error) {
 	if invoice == nil {
-		return nil, nil, errors.New("moynalog: invoice create request cannot be nil")
+		return nil, nil, invalidArgument("moynalog: invoice create request cannot be nil")
 	}
 	if len(invoice.Services) == 0 {
-		return nil, nil, errors.New("moynalog: services cannot be empty")
+		return nil, nil, invalidArgument("moynalog: services cannot be empty")
 	}
-	// The counterparty is validated exactly as it is for a receipt: an invoice
-	// issued to a legal entity has to identify it.
-	if err := validateIncomeClient(invoice.Client); err != nil {
+	// The counterparty is resolved and validated exactly as it is for a
+	// receipt: an invoice issued to a legal entity has to identify it.
+	buyer, err := s.client.resolveClient(ctx, invoice.Client)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateIncomeClient(buyer); err != nil {
 		return nil, nil, err
 	}
 
+	policy := s.client.amountPolicy
+	services := make([]InvoiceServiceItem, len(invoice.Services))
 	totalAmount := decimal.Zero
 	for i, item := range invoice.Services {
 		if item.Name == "" {
-			return nil, nil, errors.Errorf("moynalog: name of item[%d] cannot be empty", i)
+			return nil, nil, invalidArgument("moynalog: name of item[%d] cannot be empty", i)
 		}
 		if item.Amount.LessThanOrEqual(decimal.Zero) {
-			return nil, nil, errors.Errorf("moynalog: amount of item[%d] must be greater than 0", i)
+			return nil, nil, invalidArgument("moynalog: amount of item[%d] must be greater than 0", i)
 		}
 		if item.Quantity.LessThanOrEqual(decimal.Zero) {
-			return nil, nil, errors.Errorf("moynalog: quantity of item[%d] must be greater than 0", i)
+			return nil, nil, invalidArgument("moynalog: quantity of item[%d] must be greater than 0", i)
+		}
+		amount, lineTotal, err := policy.line(i, item.Amount, item.Quantity)
+		if err != nil {
+			return nil, nil, err
 		}
-		totalAmount = totalAmount.Add(item.TotalAmount())
+		item.Amount = amount
+		services[i] = item
+		totalAmount = totalAmount.Add(lineTotal)
+	}
+	if err := policy.checkTotal(totalAmount); err != nil {
+		return nil, nil, err
 	}
 
 	requestTime := time.Now()
@@ -102,18 +119,13 @@ func (s *InvoiceService) Create(ctx context.Context, invoice *InvoiceCreateReque
 		operationTime = requestTime
 	}
 
-	client := IncomeClient{IncomeType: IncomeTypeIndividual}
-	if invoice.Client != nil {
-		client = *invoice.Client
-	}
-
 	body := &invoiceCreateBody{
 		PaymentType:                     PaymentTypeAccount,
 		IgnoreMaxTotalIncomeRestriction: invoice.IgnoreMaxTotalIncomeRestriction,
-		Client:                          client,
-		Services:                        invoice.Services,
-		RequestTime:                     NewTime(requestTime),
-		OperationTime:                   NewTime(operationTime),
+		Client:                          wireClient(buyer),
+		Services:                        services,
+		RequestTime:                     s.client.apiTime(requestTime),
+		OperationTime:                   s.client.apiTime(operationTime),
 		TotalAmount:                     totalAmount.String(),
 	}
 
@@ -138,14 +150,22 @@ func (s *InvoiceService) CreateItem(ctx context.Context, name string, amount, qu
 	})
 }
 
-// Cancel always fails with ErrNotImplemented: the upstream API exposes no
-// invoice cancellation endpoint. It exists to mirror the reference PHP client.
+// Cancel always fails with ErrNotImplemented. It exists to mirror the
+// reference PHP client, but the API has no invoice cancellation endpoint:
+// there is no POST /invoice/{id}/cancel, and an issued invoice cannot be
+// withdrawn. What can be annulled is the receipt registered when the invoice
+// is paid. Call IncomeService.Cancel with the receipt from Status, which then
+// reports the invoice as InvoiceStatusCancelled.
 func (s *InvoiceService) Cancel(_ context.Context, _ int64) (*Response, error) {
 	return nil, ErrNotImplemented
 }
 
-// UpdatePaymentInfo always fails with ErrNotImplemented: the upstream API
-// exposes no such endpoint. It exists to mirror the reference PHP client.
+// UpdatePaymentInfo always fails with ErrNotImplemented. It exists to mirror
+// the reference PHP client, but the API has no endpoint to mark an invoice as
+// paid or to change its payment details, and no invoice listing to read them
+// back from. The portal records a payment by registering a receipt whose
+// InvoiceID refers to the invoice. Status and Statuses find that receipt
+// through GET /incomes and stand in for both the update and the listing.
 func (s *InvoiceService) UpdatePaymentInfo(_ context.Context) (*Response, error) {
 	return nil, ErrNotImplemented
 }
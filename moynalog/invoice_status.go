@@ -0,0 +1,113 @@
+package moynalog
+
+import (
+	"context"
+	"time"
+)
+
+// InvoiceState is the status of an invoice and the receipt it was settled
+// with.
+//
+// The API has no endpoint reporting on invoices: once an invoice is paid,
+// the portal registers a receipt whose InvoiceID refers to it, and that
+// receipt is the only trace of the payment. InvoiceState is derived from the
+// receipt listing accordingly.
+type InvoiceState struct {
+	InvoiceID string
+	Status    InvoiceStatus
+	// Receipt is the receipt settling the invoice: the registered one when
+	// paid, the latest cancelled one when cancelled, nil when pending.
+	Receipt *IncomeListItem
+}
+
+// MatchInvoices matches receipts against invoiceIDs by their InvoiceID. Every
+// invoice gets a state, pending when no receipt refers to it. A registered
+// receipt wins over cancelled ones, so an invoice whose first receipt was
+// replaced is still paid.
+func MatchInvoices(receipts []*IncomeListItem, invoiceIDs ...string) map[string]*InvoiceState {
+	states := make(map[string]*InvoiceState, len(invoiceIDs))
+	for _, id := range invoiceIDs {
+		states[id] = &InvoiceState{InvoiceID: id, Status: InvoiceStatusPending}
+	}
+
+	for _, receipt := range receipts {
+		if receipt == nil {
+			continue
+		}
+		state, ok := states[receipt.InvoiceID]
+		if !ok || receipt.InvoiceID == "" {
+			continue
+		}
+		state.match(receipt)
+	}
+
+	return states
+}
+
+// match records receipt in the state if it says more about the invoice than
+// what is known.
+func (s *InvoiceState) match(receipt *IncomeListItem) {
+	switch {
+	case !receipt.Cancelled():
+		if s.Status != InvoiceStatusPaid || receipt.OperationTime.After(s.Receipt.OperationTime.Time) {
+			s.Status, s.Receipt = InvoiceStatusPaid, receipt
+		}
+	case s.Status == InvoiceStatusPending:
+		s.Status, s.Receipt = InvoiceStatusCancelled, receipt
+	case s.Status == InvoiceStatusCancelled && receipt.OperationTime.After(s.Receipt.OperationTime.Time):
+		s.Receipt = receipt
+	}
+}
+
+// Statuses returns the states of invoiceIDs, looking for their receipts among
+// those with an operation time from from on. Pass the date the oldest invoice
+// was issued, since it cannot have been paid earlier.
+//
+// GET /incomes
+func (s *InvoiceService) Statuses(ctx context.Context, from time.Time, invoiceIDs ...string) (map[string]*InvoiceState, error) {
+	if len(invoiceIDs) == 0 {
+		return map[string]*InvoiceState{}, nil
+	}
+	for _, id := range invoiceIDs {
+		if id == "" {
+			return nil, invalidArgument("moynalog: invoice ID cannot be empty")
+		}
+	}
+
+	wanted := make(map[string]bool, len(invoiceIDs))
+	for _, id := range invoiceIDs {
+		wanted[id] = true
+	}
+
+	var receipts []*IncomeListItem
+	opts := IncomeListOptions{
+		From:   NewTime(from),
+		To:     NewTime(time.Now()),
+		Limit:  maxListLimit,
+		SortBy: SortByOperationTimeDesc,
+	}
+	err := s.client.Income.walk(ctx, opts, func(item *IncomeListItem) bool {
+		if wanted[item.InvoiceID] {
+			receipts = append(receipts, item)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return MatchInvoices(receipts, invoiceIDs...), nil
+}
+
+// Status returns the state of a single invoice, see Statuses.
+//
+// GET /incomes
+func (s *InvoiceService) Status(ctx context.Context, from time.Time, invoiceID string) (*InvoiceState, error) {
+	states, err := s.Statuses(ctx, from, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return states[invoiceID], nil
+}
@@ -0,0 +1,118 @@
+package moynalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func invoiceReceipt(uuid, invoiceID string, day int, cancelled bool) string {
+	cancellation := "null"
+	if cancelled {
+		cancellation = `{"operationTime":"2026-10-20T10:00:00+03:00","comment":"Возврат средств"}`
+	}
+
+	return fmt.Sprintf(`{"approvedReceiptUuid":%q,"invoiceId":%q,"operationTime":"2026-10-%02dT10:00:00+03:00",`+
+		`"totalAmount":100,"cancellationInfo":%s}`, uuid, invoiceID, day, cancellation)
+}
+
+func TestMatchInvoices(t *testing.T) {
+	t.Parallel()
+
+	receipts := []*IncomeListItem{
+		{ApprovedReceiptUUID: "r1", InvoiceID: "paid", OperationTime: NewTime(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)), CancellationInfo: &CancellationInfo{}},
+		{ApprovedReceiptUUID: "r2", InvoiceID: "paid", OperationTime: NewTime(time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC))},
+		{ApprovedReceiptUUID: "r3", InvoiceID: "cancelled", CancellationInfo: &CancellationInfo{}},
+		{ApprovedReceiptUUID: "r4", InvoiceID: "other"},
+		{ApprovedReceiptUUID: "r5"},
+		nil,
+	}
+
+	states := MatchInvoices(receipts, "paid", "cancelled", "pending")
+	want := map[string]struct {
+		status  InvoiceStatus
+		receipt string
+	}{
+		"paid":      {InvoiceStatusPaid, "r2"},
+		"cancelled": {InvoiceStatusCancelled, "r3"},
+		"pending":   {InvoiceStatusPending, ""},
+	}
+	if len(states) != len(want) {
+		t.Fatalf("states = %v, want %d", states, len(want))
+	}
+	for id, w := range want {
+		state := states[id]
+		receipt := ""
+		if state.Receipt != nil {
+			receipt = state.Receipt.ApprovedReceiptUUID
+		}
+		if state.InvoiceID != id || state.Status != w.status || receipt != w.receipt {
+			t.Errorf("states[%s] = %s with %q, want %s with %q", id, state.Status, receipt, w.status, w.receipt)
+		}
+	}
+}
+
+func TestInvoiceStatuses(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	var requests int
+	mux.HandleFunc("/v1/incomes", func(w http.ResponseWriter, r *http.Request) {
+		testQuery(t, r, map[string]string{"from": "2026-10-01T03:00:00.000+03:00", "sortBy": string(SortByOperationTimeDesc)})
+		if r.URL.Query().Get("to") == "" {
+			t.Error("to must be set")
+		}
+
+		requests++
+		if r.URL.Query().Get("offset") == "0" {
+			content := strings.Join([]string{
+				invoiceReceipt("r3", "inv-2", 19, false),
+				invoiceReceipt("r2", "", 18, false),
+			}, ",")
+			writeJSON(t, w, http.StatusOK, `{"content":[`+content+`],"hasMore":true}`)
+
+			return
+		}
+		writeJSON(t, w, http.StatusOK, `{"content":[`+invoiceReceipt("r1", "inv-1", 17, true)+`],"hasMore":false}`)
+	})
+
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	states, err := client.Invoice.Statuses(context.Background(), from, "inv-1", "inv-2", "inv-3")
+	if err != nil {
+		t.Fatalf("Statuses: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want the whole listing walked", requests)
+	}
+	for id, want := range map[string]InvoiceStatus{"inv-1": InvoiceStatusCancelled, "inv-2": InvoiceStatusPaid, "inv-3": InvoiceStatusPending} {
+		if states[id].Status != want {
+			t.Errorf("status of %s = %s, want %s", id, states[id].Status, want)
+		}
+	}
+	if states["inv-2"].Receipt.ApprovedReceiptUUID != "r3" {
+		t.Errorf("receipt of inv-2 = %+v, want r3", states["inv-2"].Receipt)
+	}
+}
+
+func TestInvoiceStatus(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/incomes", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{"content":[`+invoiceReceipt("r1", "inv-1", 17, false)+`],"hasMore":false}`)
+	})
+
+	state, err := client.Invoice.Status(context.Background(), time.Time{}, "inv-1")
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if state.Status != InvoiceStatusPaid || state.Receipt.ApprovedReceiptUUID != "r1" {
+		t.Errorf("state = %+v, want paid with r1", state)
+	}
+
+	_, err = client.Invoice.Status(context.Background(), time.Time{}, "")
+	assertLocalError(t, err)
+}
@@ -178,7 +178,7 @@ func TestInvoiceCreateValidatesClient(t *testing.T) {
 		}},
 		{"legal entity without a display name", &IncomeClient{
 			IncomeType: IncomeTypeLegalEntity,
-			Inn:        "7724035047",
+			Inn:        "7707083893",
 		}},
 		{"unknown income type", &IncomeClient{IncomeType: "FROM_MARS"}},
 	}
@@ -0,0 +1,459 @@
+package moynalog
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// defaultMirrorLookback is how far before the watermark an incremental sync
+// starts listing. The API filters by operation time, which may predate the
+// registration by up to the previous tax period.
+const defaultMirrorLookback = 62 * 24 * time.Hour
+
+// defaultMirrorCancelWindow is how far before the watermark an incremental
+// sync looks for cancelled receipts, by operation time.
+const defaultMirrorCancelWindow = 366 * 24 * time.Hour
+
+// MirrorSnapshot is the state a ReceiptMirror persists between runs.
+type MirrorSnapshot struct {
+	// Watermark is the latest registration or cancellation time synced so far.
+	Watermark time.Time `json:"watermark"`
+	// Receipts are every receipt mirrored so far, cancelled ones included.
+	Receipts []*IncomeListItem `json:"receipts"`
+}
+
+// MirrorStore persists the receipts kept by a ReceiptMirror. Implementations
+// must be safe for concurrent use.
+type MirrorStore interface {
+	// Load returns the stored snapshot, or an empty one when nothing has been
+	// stored yet.
+	Load(ctx context.Context) (*MirrorSnapshot, error)
+	// Save replaces the stored snapshot.
+	Save(ctx context.Context, snapshot *MirrorSnapshot) error
+}
+
+// MemoryMirrorStore keeps the mirror in memory only. The zero value is ready
+// to use.
+type MemoryMirrorStore struct {
+	mu       sync.Mutex
+	snapshot MirrorSnapshot
+}
+
+// Load implements MirrorStore.
+func (s *MemoryMirrorStore) Load(context.Context) (*MirrorSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &MirrorSnapshot{
+		Watermark: s.snapshot.Watermark,
+		Receipts:  append([]*IncomeListItem(nil), s.snapshot.Receipts...),
+	}, nil
+}
+
+// Save implements MirrorStore.
+func (s *MemoryMirrorStore) Save(_ context.Context, snapshot *MirrorSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshot = MirrorSnapshot{
+		Watermark: snapshot.Watermark,
+		Receipts:  append([]*IncomeListItem(nil), snapshot.Receipts...),
+	}
+
+	return nil
+}
+
+// FileMirrorStore keeps the mirror in a single JSON file, rewritten atomically
+// on every save.
+type FileMirrorStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileMirrorStore returns a store backed by the file at path. The file is
+// created on the first save.
+func NewFileMirrorStore(path string) *FileMirrorStore {
+	return &FileMirrorStore{path: path}
+}
+
+// Load implements MirrorStore.
+func (s *FileMirrorStore) Load(context.Context) (*MirrorSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := new(MirrorSnapshot)
+	if err := readJSONFile(s.path, snapshot); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// Save implements MirrorStore.
+func (s *FileMirrorStore) Save(_ context.Context, snapshot *MirrorSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeJSONFile(s.path, snapshot)
+}
+
+// readJSONFile decodes the file at path into v. A missing file leaves v as it is.
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "moynalog: cannot read store file")
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrapf(err, "moynalog: cannot decode store file %s", path)
+	}
+
+	return nil
+}
+
+// writeJSONFile encodes v into the file at path through a temporary file, so a
+// crash never leaves a truncated file behind.
+func writeJSONFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "moynalog: cannot encode store file")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "moynalog: cannot create store file")
+	}
+	//nolint:gosec // G104: removing a renamed temporary file fails harmlessly.
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return errors.Wrap(err, "moynalog: cannot write store file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "moynalog: cannot write store file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "moynalog: cannot replace store file")
+	}
+
+	return nil
+}
+
+// ReceiptFilter narrows a query against a ReceiptMirror. Zero fields do not
+// filter.
+type ReceiptFilter struct {
+	// ClientInn matches the counterparty INN exactly.
+	ClientInn string
+	// MinAmount and MaxAmount bound the receipt total, both inclusive.
+	MinAmount decimal.Decimal
+	MaxAmount decimal.Decimal
+	// From and To bound the operation time to [From, To).
+	From time.Time
+	To   time.Time
+	// IncludeCancelled also matches cancelled receipts.
+	IncludeCancelled bool
+}
+
+func (f *ReceiptFilter) match(item *IncomeListItem) bool {
+	switch {
+	case !f.IncludeCancelled && item.Cancelled():
+		return false
+	case f.ClientInn != "" && item.ClientInn != f.ClientInn:
+		return false
+	case !f.MinAmount.IsZero() && item.TotalAmount.LessThan(f.MinAmount):
+		return false
+	case !f.MaxAmount.IsZero() && item.TotalAmount.GreaterThan(f.MaxAmount):
+		return false
+	case !f.From.IsZero() && item.OperationTime.Before(f.From):
+		return false
+	case !f.To.IsZero() && !item.OperationTime.Before(f.To):
+		return false
+	default:
+		return true
+	}
+}
+
+// MirrorSyncResult summarises a single ReceiptMirror.Sync run.
+type MirrorSyncResult struct {
+	// Added counts receipts seen for the first time.
+	Added int
+	// Cancelled counts known receipts found cancelled since the last sync.
+	Cancelled int
+	// Watermark is the watermark after the sync.
+	Watermark time.Time
+}
+
+// ReceiptMirror keeps a local copy of every receipt of the taxpayer, so that
+// repeated queries never touch the network. Call Sync to bring it up to date.
+// It is safe for concurrent use.
+//
+// It lives here rather than in a package of its own: it pages through
+// Income.List with the same internal walker as Watcher, and a package named
+// sync would shadow the standard library one in every importer.
+type ReceiptMirror struct {
+	income       *IncomeService
+	store        MirrorStore
+	lookback     time.Duration
+	cancelWindow time.Duration
+
+	// syncMu serialises Sync runs; mu guards the in-memory state.
+	syncMu    sync.Mutex
+	mu        sync.RWMutex
+	loaded    bool
+	receipts  map[string]*IncomeListItem
+	watermark time.Time
+}
+
+// MirrorOption customises a ReceiptMirror.
+type MirrorOption func(*ReceiptMirror)
+
+// WithMirrorStore sets where the mirror is persisted. Defaults to a
+// MemoryMirrorStore.
+func WithMirrorStore(store MirrorStore) MirrorOption {
+	return func(m *ReceiptMirror) {
+		if store != nil {
+			m.store = store
+		}
+	}
+}
+
+// WithMirrorLookback sets how far before the watermark an incremental sync
+// starts listing receipts by operation time. Defaults to 62 days.
+func WithMirrorLookback(lookback time.Duration) MirrorOption {
+	return func(m *ReceiptMirror) {
+		if lookback > 0 {
+			m.lookback = lookback
+		}
+	}
+}
+
+// WithMirrorCancelWindow sets how far before the watermark an incremental sync
+// looks for cancelled receipts, by operation time. Cancellations of receipts
+// operated earlier are missed; a fresh mirror picks them up. Defaults to 366
+// days.
+func WithMirrorCancelWindow(window time.Duration) MirrorOption {
+	return func(m *ReceiptMirror) {
+		if window > 0 {
+			m.cancelWindow = window
+		}
+	}
+}
+
+// NewReceiptMirror returns a mirror of the receipts visible to client.
+func NewReceiptMirror(client *Client, opts ...MirrorOption) *ReceiptMirror {
+	m := &ReceiptMirror{
+		income:       client.Income,
+		store:        new(MemoryMirrorStore),
+		lookback:     defaultMirrorLookback,
+		cancelWindow: defaultMirrorCancelWindow,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Sync brings the mirror up to date. The first sync lists every receipt; later
+// ones list only what was operated since the watermark minus the lookback, and
+// then the cancelled receipts operated within the cancel window before the
+// watermark, so cancellations of older receipts are picked up as well.
+func (m *ReceiptMirror) Sync(ctx context.Context) (*MirrorSyncResult, error) {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	if err := m.load(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	watermark := m.watermark
+	m.mu.RUnlock()
+
+	result := &MirrorSyncResult{Watermark: watermark}
+	collect := func(item *IncomeListItem) bool {
+		m.upsert(item, result)
+
+		return true
+	}
+
+	recent := IncomeListOptions{Limit: maxListLimit, SortBy: SortByOperationTimeDesc}
+	if !watermark.IsZero() {
+		recent.From = NewTime(watermark.Add(-m.lookback))
+	}
+	if err := m.income.walk(ctx, recent, collect); err != nil {
+		return nil, err
+	}
+
+	if !watermark.IsZero() {
+		cancelled := IncomeListOptions{
+			Limit:       maxListLimit,
+			SortBy:      SortByOperationTimeDesc,
+			ReceiptType: ReceiptTypeCancelled,
+			From:        NewTime(watermark.Add(-m.cancelWindow)),
+		}
+		if err := m.income.walk(ctx, cancelled, collect); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	m.watermark = result.Watermark
+	snapshot := m.snapshotLocked()
+	m.mu.Unlock()
+
+	if err := m.store.Save(ctx, snapshot); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (m *ReceiptMirror) upsert(item *IncomeListItem, result *MirrorSyncResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous, known := m.receipts[item.ApprovedReceiptUUID]
+	switch {
+	case !known:
+		result.Added++
+	case !previous.Cancelled() && item.Cancelled():
+		result.Cancelled++
+	}
+	m.receipts[item.ApprovedReceiptUUID] = item
+
+	if item.RegisterTime.After(result.Watermark) {
+		result.Watermark = item.RegisterTime.Time
+	}
+	if item.CancellationInfo != nil && item.CancellationInfo.RegisterTime.After(result.Watermark) {
+		result.Watermark = item.CancellationInfo.RegisterTime.Time
+	}
+}
+
+// load reads the persisted snapshot once.
+func (m *ReceiptMirror) load(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.loaded {
+		return nil
+	}
+
+	snapshot, err := m.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.receipts = make(map[string]*IncomeListItem, len(snapshot.Receipts))
+	for _, item := range snapshot.Receipts {
+		if item != nil {
+			m.receipts[item.ApprovedReceiptUUID] = item
+		}
+	}
+	m.watermark = snapshot.Watermark
+	m.loaded = true
+
+	return nil
+}
+
+func (m *ReceiptMirror) snapshotLocked() *MirrorSnapshot {
+	snapshot := &MirrorSnapshot{
+		Watermark: m.watermark,
+		Receipts:  make([]*IncomeListItem, 0, len(m.receipts)),
+	}
+	for _, item := range m.receipts {
+		snapshot.Receipts = append(snapshot.Receipts, item)
+	}
+	sortByOperationTimeDesc(snapshot.Receipts)
+
+	return snapshot
+}
+
+// Watermark returns the latest registration or cancellation time synced so far.
+func (m *ReceiptMirror) Watermark(ctx context.Context) (time.Time, error) {
+	if err := m.load(ctx); err != nil {
+		return time.Time{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.watermark, nil
+}
+
+// Get returns the mirrored receipt identified by receiptUUID, or nil when it
+// is not known.
+func (m *ReceiptMirror) Get(ctx context.Context, receiptUUID string) (*IncomeListItem, error) {
+	if err := m.load(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.receipts[receiptUUID], nil
+}
+
+// Find returns the mirrored receipts matching filter, most recent first. A nil
+// filter matches every receipt that has not been cancelled.
+func (m *ReceiptMirror) Find(ctx context.Context, filter *ReceiptFilter) ([]*IncomeListItem, error) {
+	if err := m.load(ctx); err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = new(ReceiptFilter)
+	}
+
+	m.mu.RLock()
+	var found []*IncomeListItem
+	for _, item := range m.receipts {
+		if filter.match(item) {
+			found = append(found, item)
+		}
+	}
+	m.mu.RUnlock()
+
+	sortByOperationTimeDesc(found)
+
+	return found, nil
+}
+
+// ByClientInn returns the active receipts issued to the counterparty with inn.
+func (m *ReceiptMirror) ByClientInn(ctx context.Context, inn string) ([]*IncomeListItem, error) {
+	return m.Find(ctx, &ReceiptFilter{ClientInn: inn})
+}
+
+// ByAmountRange returns the active receipts whose total lies within
+// [minAmount, maxAmount].
+func (m *ReceiptMirror) ByAmountRange(ctx context.Context, minAmount, maxAmount decimal.Decimal) ([]*IncomeListItem, error) {
+	return m.Find(ctx, &ReceiptFilter{MinAmount: minAmount, MaxAmount: maxAmount})
+}
+
+// ByPeriod returns the active receipts operated within [from, to).
+func (m *ReceiptMirror) ByPeriod(ctx context.Context, from, to time.Time) ([]*IncomeListItem, error) {
+	return m.Find(ctx, &ReceiptFilter{From: from, To: to})
+}
+
+func sortByOperationTimeDesc(items []*IncomeListItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].OperationTime.Equal(items[j].OperationTime.Time) {
+			return items[i].ApprovedReceiptUUID < items[j].ApprovedReceiptUUID
+		}
+
+		return items[i].OperationTime.After(items[j].OperationTime.Time)
+	})
+}
@@ -0,0 +1,220 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	mirrorPageOne = `{"hasMore":true,"currentOffset":0,"currentLimit":2,"content":[
+		{"approvedReceiptUuid":"r3","operationTime":"2024-09-03T10:00:00+03:00","registerTime":"2024-09-03T10:00:01+03:00","totalAmount":300,"clientInn":"7724035047"},
+		{"approvedReceiptUuid":"r2","operationTime":"2024-09-02T10:00:00+03:00","registerTime":"2024-09-02T10:00:01+03:00","totalAmount":200}
+	]}`
+	mirrorPageTwo = `{"hasMore":false,"currentOffset":2,"currentLimit":2,"content":[
+		{"approvedReceiptUuid":"r1","operationTime":"2024-08-01T10:00:00+03:00","registerTime":"2024-08-01T10:00:01+03:00","totalAmount":100,"clientInn":"7724035047"}
+	]}`
+)
+
+// mirrorServer serves a full listing on the first sync and an incremental one
+// afterwards, recording the queries it was asked.
+func mirrorServer(t *testing.T, mux *http.ServeMux) *[]map[string]string {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		queries []map[string]string
+	)
+	mux.HandleFunc("/v1/incomes", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		mu.Lock()
+		queries = append(queries, map[string]string{
+			"offset":      q.Get("offset"),
+			"from":        q.Get("from"),
+			"receiptType": q.Get("receiptType"),
+		})
+		mu.Unlock()
+
+		switch {
+		case q.Get("receiptType") == string(ReceiptTypeCancelled):
+			writeJSON(t, w, http.StatusOK, `{"hasMore":false,"content":[
+				{"approvedReceiptUuid":"r1","operationTime":"2024-08-01T10:00:00+03:00","registerTime":"2024-08-01T10:00:01+03:00","totalAmount":100,"clientInn":"7724035047",
+				 "cancellationInfo":{"registerTime":"2024-09-05T09:00:00+03:00","comment":"Возврат средств"}}
+			]}`)
+		case q.Get("from") != "":
+			writeJSON(t, w, http.StatusOK, `{"hasMore":false,"content":[
+				{"approvedReceiptUuid":"r4","operationTime":"2024-09-04T10:00:00+03:00","registerTime":"2024-09-04T10:00:01+03:00","totalAmount":400}
+			]}`)
+		case q.Get("offset") == "2":
+			writeJSON(t, w, http.StatusOK, mirrorPageTwo)
+		default:
+			writeJSON(t, w, http.StatusOK, mirrorPageOne)
+		}
+	})
+
+	return &queries
+}
+
+func TestReceiptMirrorSync(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	queries := mirrorServer(t, mux)
+	ctx := context.Background()
+
+	mirror := NewReceiptMirror(client)
+	result, err := mirror.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.Added != 3 {
+		t.Errorf("Added = %d, want 3", result.Added)
+	}
+	wantWatermark := time.Date(2024, 9, 3, 7, 0, 1, 0, time.UTC)
+	if !result.Watermark.Equal(wantWatermark) {
+		t.Errorf("Watermark = %v, want %v", result.Watermark, wantWatermark)
+	}
+	if len(*queries) != 2 || (*queries)[1]["offset"] != "2" || (*queries)[0]["from"] != "" {
+		t.Errorf("first sync queries = %v, want two full pages", *queries)
+	}
+
+	byInn, err := mirror.ByClientInn(ctx, "7724035047")
+	if err != nil {
+		t.Fatalf("ByClientInn: %v", err)
+	}
+	if len(byInn) != 2 || byInn[0].ApprovedReceiptUUID != "r3" || byInn[1].ApprovedReceiptUUID != "r1" {
+		t.Errorf("ByClientInn = %v, want r3 then r1", receiptUUIDs(byInn))
+	}
+
+	byAmount, err := mirror.ByAmountRange(ctx, decimal.NewFromInt(150), decimal.NewFromInt(300))
+	if err != nil {
+		t.Fatalf("ByAmountRange: %v", err)
+	}
+	if got := receiptUUIDs(byAmount); len(got) != 2 || got[0] != "r3" || got[1] != "r2" {
+		t.Errorf("ByAmountRange = %v, want [r3 r2]", got)
+	}
+
+	september := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	byPeriod, err := mirror.ByPeriod(ctx, september, september.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("ByPeriod: %v", err)
+	}
+	if got := receiptUUIDs(byPeriod); len(got) != 2 {
+		t.Errorf("ByPeriod = %v, want the two September receipts", got)
+	}
+
+	// The incremental sync starts from the watermark minus the lookback and
+	// then rescans the cancelled receipts.
+	*queries = nil
+	result, err = mirror.Sync(ctx)
+	if err != nil {
+		t.Fatalf("second Sync: %v", err)
+	}
+	if result.Added != 1 || result.Cancelled != 1 {
+		t.Errorf("second Sync = %+v, want one added and one cancelled", result)
+	}
+	if len(*queries) != 2 || (*queries)[0]["from"] == "" || (*queries)[1]["receiptType"] != string(ReceiptTypeCancelled) {
+		t.Errorf("second sync queries = %v, want a windowed listing and a cancelled one", *queries)
+	}
+	if from := (*queries)[1]["from"]; from == "" || from >= (*queries)[0]["from"] {
+		t.Errorf("cancelled listing from = %q, want it bounded by the cancel window", from)
+	}
+
+	active, err := mirror.ByClientInn(ctx, "7724035047")
+	if err != nil {
+		t.Fatalf("ByClientInn: %v", err)
+	}
+	if got := receiptUUIDs(active); len(got) != 1 || got[0] != "r3" {
+		t.Errorf("ByClientInn after cancellation = %v, want [r3]", got)
+	}
+
+	all, err := mirror.Find(ctx, &ReceiptFilter{ClientInn: "7724035047", IncludeCancelled: true})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("Find with cancelled = %v, want two receipts", receiptUUIDs(all))
+	}
+}
+
+func TestReceiptMirrorFileStore(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "mirror.json")
+	ctx := context.Background()
+
+	client, mux := setupAuthed(t)
+	mirrorServer(t, mux)
+	if _, err := NewReceiptMirror(client, WithMirrorStore(NewFileMirrorStore(path))).Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// A fresh mirror over the same file answers queries without the network.
+	reopened := NewReceiptMirror(setupNoRequest(t), WithMirrorStore(NewFileMirrorStore(path)))
+	item, err := reopened.Get(ctx, "r2")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if item == nil || !item.TotalAmount.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Get(r2) = %+v, want the persisted receipt", item)
+	}
+
+	watermark, err := reopened.Watermark(ctx)
+	if err != nil {
+		t.Fatalf("Watermark: %v", err)
+	}
+	if watermark.IsZero() {
+		t.Error("Watermark must be persisted")
+	}
+}
+
+func TestFileMirrorStoreMissingFile(t *testing.T) {
+	t.Parallel()
+
+	snapshot, err := NewFileMirrorStore(filepath.Join(t.TempDir(), "absent.json")).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(snapshot.Receipts) != 0 || !snapshot.Watermark.IsZero() {
+		t.Errorf("Load = %+v, want an empty snapshot", snapshot)
+	}
+}
+
+func receiptUUIDs(items []*IncomeListItem) []string {
+	uuids := make([]string, 0, len(items))
+	for _, item := range items {
+		uuids = append(uuids, item.ApprovedReceiptUUID)
+	}
+
+	return uuids
+}
+
+func TestReceiptMirrorCancelWindow(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	queries := mirrorServer(t, mux)
+	ctx := context.Background()
+
+	mirror := NewReceiptMirror(client, WithMirrorCancelWindow(24*time.Hour))
+	if _, err := mirror.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	*queries = nil
+	if _, err := mirror.Sync(ctx); err != nil {
+		t.Fatalf("second Sync: %v", err)
+	}
+
+	from, err := time.Parse(time.RFC3339, (*queries)[1]["from"])
+	if err != nil {
+		t.Fatalf("cancelled listing from: %v", err)
+	}
+	if want := time.Date(2024, 9, 2, 7, 0, 1, 0, time.UTC); !from.Equal(want) {
+		t.Errorf("cancelled listing from = %v, want a day before the watermark %v", from, want)
+	}
+}
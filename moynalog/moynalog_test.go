@@ -107,19 +107,31 @@ func setupNoRequest(t *testing.T) *Client {
 	return client
 }
 
-// assertLocalError fails unless err is a client-side validation error. An
-// *ErrorResponse means the input reached the API instead of being rejected.
+// assertLocalError fails unless err is a client-side validation error, one
+// matching ErrInvalidArgument. An *ErrorResponse means the input reached the
+// API instead of being rejected.
 func assertLocalError(t *testing.T, err error) {
 	t.Helper()
 
+	assertNotSent(t, err)
+	if err != nil && !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("want %v to match ErrInvalidArgument", err)
+	}
+}
+
+// assertNotSent fails unless err is a client-side failure of any kind, a
+// missing token or rate provider for instance, rather than an API error.
+func assertNotSent(t *testing.T, err error) {
+	t.Helper()
+
 	if err == nil {
-		t.Error("want a validation error, got nil")
+		t.Error("want a local error, got nil")
 
 		return
 	}
 
 	var errResp *ErrorResponse
 	if errors.As(err, &errResp) {
-		t.Errorf("want a local validation error, got an API error: %v", err)
+		t.Errorf("want a local error, got an API error: %v", err)
 	}
 }
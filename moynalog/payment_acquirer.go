@@ -0,0 +1,310 @@
+package moynalog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// yooKassaNetworks are the addresses YooKassa sends its notifications from.
+// YooKassa does not sign notifications; their origin is what is verified.
+var yooKassaNetworks = []netip.Prefix{
+	netip.MustParsePrefix("185.71.76.0/27"),
+	netip.MustParsePrefix("185.71.77.0/27"),
+	netip.MustParsePrefix("77.75.153.0/25"),
+	netip.MustParsePrefix("77.75.156.11/32"),
+	netip.MustParsePrefix("77.75.156.35/32"),
+	netip.MustParsePrefix("77.75.154.128/25"),
+	netip.MustParsePrefix("2a02:5180::/32"),
+}
+
+// YooKassaAcquirer understands YooKassa-style notifications: a JSON object
+// with an "event" name and the payment or refund under "object".
+type YooKassaAcquirer struct {
+	// Networks are the trusted notification origins. Defaults to the
+	// networks YooKassa publishes; set it when notifications arrive through a
+	// proxy.
+	Networks []netip.Prefix
+}
+
+type yooKassaNotification struct {
+	Event  string `json:"event"`
+	Object struct {
+		ID        string `json:"id"`
+		PaymentID string `json:"payment_id"`
+		Amount    struct {
+			Value    decimal.Decimal `json:"value"`
+			Currency string          `json:"currency"`
+		} `json:"amount"`
+		Description string    `json:"description"`
+		CapturedAt  time.Time `json:"captured_at"`
+		CreatedAt   time.Time `json:"created_at"`
+	} `json:"object"`
+}
+
+// ParsePaymentEvent implements PaymentAcquirer.
+func (a YooKassaAcquirer) ParsePaymentEvent(r *http.Request, body []byte) (*PaymentEvent, error) {
+	if !a.trusted(r.RemoteAddr) {
+		return nil, errors.Wrapf(ErrPaymentSignature, "moynalog: notification from untrusted address %s", r.RemoteAddr)
+	}
+
+	notification := new(yooKassaNotification)
+	if err := json.Unmarshal(body, notification); err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot decode YooKassa notification")
+	}
+
+	object := notification.Object
+	event := &PaymentEvent{
+		Amount:      object.Amount.Value,
+		Currency:    Currency(object.Amount.Currency),
+		Description: object.Description,
+	}
+	switch notification.Event {
+	case "payment.succeeded":
+		event.Type = PaymentSucceeded
+		event.PaymentID = object.ID
+		event.OccurredAt = object.CapturedAt
+	case "refund.succeeded":
+		event.Type = PaymentRefunded
+		event.PaymentID = object.PaymentID
+		event.RefundID = object.ID
+		event.OccurredAt = object.CreatedAt
+	default:
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+// Acknowledge implements PaymentAcquirer. YooKassa only needs a 200.
+func (YooKassaAcquirer) Acknowledge(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a YooKassaAcquirer) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	networks := a.Networks
+	if len(networks) == 0 {
+		networks = yooKassaNetworks
+	}
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CloudPaymentsAcquirer understands CloudPayments-style Pay and Refund
+// notifications, form or JSON encoded, signed with a Content-HMAC header.
+type CloudPaymentsAcquirer struct {
+	// APISecret keys the Content-HMAC signature. Required.
+	APISecret string
+}
+
+// ParsePaymentEvent implements PaymentAcquirer.
+func (a CloudPaymentsAcquirer) ParsePaymentEvent(r *http.Request, body []byte) (*PaymentEvent, error) {
+	mac := hmac.New(sha256.New, []byte(a.APISecret))
+	mac.Write(body)
+	want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if a.APISecret == "" || !hmac.Equal([]byte(want), []byte(r.Header.Get("Content-HMAC"))) {
+		return nil, errors.Wrap(ErrPaymentSignature, "moynalog: CloudPayments Content-HMAC mismatch")
+	}
+
+	fields, err := cloudPaymentsFields(r, body)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := decimal.NewFromString(fields["Amount"])
+	if err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot parse CloudPayments amount")
+	}
+
+	event := &PaymentEvent{
+		Amount:      amount,
+		Currency:    Currency(fields["Currency"]),
+		Description: fields["Description"],
+	}
+	if raw := fields["DateTime"]; raw != "" {
+		// CloudPayments reports UTC without a zone designator.
+		if event.OccurredAt, err = time.Parse("2006-01-02 15:04:05", raw); err != nil {
+			return nil, errors.Wrap(err, "moynalog: cannot parse CloudPayments date")
+		}
+	}
+
+	switch {
+	case fields["OperationType"] == "Refund":
+		event.Type = PaymentRefunded
+		event.PaymentID = fields["PaymentTransactionId"]
+		event.RefundID = fields["TransactionId"]
+	case fields["Status"] == "Completed":
+		event.Type = PaymentSucceeded
+		event.PaymentID = fields["TransactionId"]
+	default:
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+// cloudPaymentsFields flattens a notification body into its top level fields.
+func cloudPaymentsFields(r *http.Request, body []byte) (map[string]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mediaTypeJSON {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "moynalog: cannot decode CloudPayments notification")
+		}
+
+		fields := make(map[string]string, len(values))
+		for key := range values {
+			fields[key] = values.Get(key)
+		}
+
+		return fields, nil
+	}
+
+	return flatJSONFields(body)
+}
+
+// Acknowledge implements PaymentAcquirer. CloudPayments expects {"code":0}.
+func (CloudPaymentsAcquirer) Acknowledge(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	//nolint:gosec // G104: the status line is already out; nothing to report to.
+	_, _ = io.WriteString(w, `{"code":0}`)
+}
+
+// TinkoffAcquirer understands Tinkoff-style notifications: a flat JSON object
+// signed with a Token field, amounts in kopecks.
+type TinkoffAcquirer struct {
+	// Password is the terminal password the Token is derived with. Required.
+	Password string
+}
+
+// ParsePaymentEvent implements PaymentAcquirer.
+func (a TinkoffAcquirer) ParsePaymentEvent(_ *http.Request, body []byte) (*PaymentEvent, error) {
+	fields, err := flatJSONFields(body)
+	if err != nil {
+		return nil, err
+	}
+
+	token := fields["Token"]
+	delete(fields, "Token")
+	fields["Password"] = a.Password
+	if a.Password == "" || !hmac.Equal([]byte(tinkoffToken(fields)), []byte(token)) {
+		return nil, errors.Wrap(ErrPaymentSignature, "moynalog: Tinkoff token mismatch")
+	}
+
+	if fields["Success"] != "true" {
+		return nil, nil
+	}
+
+	kopecks, err := decimal.NewFromString(fields["Amount"])
+	if err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot parse Tinkoff amount")
+	}
+
+	event := &PaymentEvent{
+		PaymentID:  fields["PaymentId"],
+		Amount:     kopecks.Shift(-2),
+		Currency:   CurrencyRUB,
+		OccurredAt: time.Now(),
+	}
+	switch fields["Status"] {
+	case "CONFIRMED":
+		event.Type = PaymentSucceeded
+	case "REFUNDED":
+		// Without a refund ID the handler cancels the whole receipt.
+		event.Type = PaymentRefunded
+	case "PARTIAL_REFUNDED":
+		// Nothing in the notification tells one partial refund from another
+		// of the same amount, or from a redelivery. Guessing would either
+		// drop a refund or apply one twice, and misstate the income either
+		// way.
+		return nil, errors.Wrapf(ErrPaymentUnsupported,
+			"moynalog: Tinkoff partial refund of payment %s carries no refund ID", event.PaymentID)
+	default:
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+// Acknowledge implements PaymentAcquirer. Tinkoff expects a plain "OK".
+func (TinkoffAcquirer) Acknowledge(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	//nolint:gosec // G104: the status line is already out; nothing to report to.
+	_, _ = io.WriteString(w, "OK")
+}
+
+// tinkoffToken concatenates the values of fields in key order and hashes the
+// result, which is how Tinkoff signs its notifications.
+func tinkoffToken(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(fields[key])
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// flatJSONFields decodes the scalar top level fields of a JSON object into
+// strings, keeping numbers exactly as sent. Nested values are skipped.
+func flatJSONFields(body []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	raw := map[string]any{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot decode payment notification")
+	}
+
+	fields := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch value := value.(type) {
+		case string:
+			fields[key] = value
+		case json.Number:
+			fields[key] = value.String()
+		case bool:
+			fields[key] = strconv.FormatBool(value)
+		}
+	}
+
+	return fields, nil
+}
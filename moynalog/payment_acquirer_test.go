@@ -0,0 +1,204 @@
+package moynalog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+func TestYooKassaAcquirer(t *testing.T) {
+	t.Parallel()
+
+	const payment = `{"type":"notification","event":"payment.succeeded","object":{
+		"id":"22d6d597-000f-5000-9000-145f6df21d6f","status":"succeeded",
+		"amount":{"value":"2.50","currency":"RUB"},"description":"Заказ №72",
+		"captured_at":"2018-07-18T10:51:18.139Z","created_at":"2018-07-18T10:51:10.000Z"}}`
+	const refund = `{"type":"notification","event":"refund.succeeded","object":{
+		"id":"216749f7-0016-50be-b000-078d43a63ae4","payment_id":"22d6d597-000f-5000-9000-145f6df21d6f",
+		"status":"succeeded","amount":{"value":"2.50","currency":"RUB"},"created_at":"2018-07-19T10:00:00.000Z"}}`
+
+	acquirer := YooKassaAcquirer{}
+	request := func(remoteAddr string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+		r.RemoteAddr = remoteAddr
+
+		return r
+	}
+
+	event, err := acquirer.ParsePaymentEvent(request("185.71.76.5:443"), []byte(payment))
+	if err != nil {
+		t.Fatalf("ParsePaymentEvent(payment): %v", err)
+	}
+	if event.Type != PaymentSucceeded || event.PaymentID != "22d6d597-000f-5000-9000-145f6df21d6f" ||
+		!event.Amount.Equal(decimal.NewFromFloat(2.5)) || event.Description != "Заказ №72" || event.OccurredAt.IsZero() {
+		t.Errorf("payment event = %+v", event)
+	}
+
+	event, err = acquirer.ParsePaymentEvent(request("[2a02:5180::1]:443"), []byte(refund))
+	if err != nil {
+		t.Fatalf("ParsePaymentEvent(refund): %v", err)
+	}
+	if event.Type != PaymentRefunded || event.PaymentID != "22d6d597-000f-5000-9000-145f6df21d6f" ||
+		event.RefundID != "216749f7-0016-50be-b000-078d43a63ae4" {
+		t.Errorf("refund event = %+v, want a refund of the original payment", event)
+	}
+
+	if _, err := acquirer.ParsePaymentEvent(request("203.0.113.7:443"), []byte(payment)); !errors.Is(err, ErrPaymentSignature) {
+		t.Errorf("untrusted origin: err = %v, want ErrPaymentSignature", err)
+	}
+
+	proxied := YooKassaAcquirer{Networks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	if _, err := proxied.ParsePaymentEvent(request("10.1.2.3:443"), []byte(payment)); err != nil {
+		t.Errorf("custom network: %v", err)
+	}
+
+	waiting := strings.Replace(payment, "payment.succeeded", "payment.waiting_for_capture", 1)
+	if event, err := acquirer.ParsePaymentEvent(request("185.71.76.5:443"), []byte(waiting)); err != nil || event != nil {
+		t.Errorf("waiting_for_capture = %+v, %v; want it ignored", event, err)
+	}
+}
+
+func TestCloudPaymentsAcquirer(t *testing.T) {
+	t.Parallel()
+
+	acquirer := CloudPaymentsAcquirer{APISecret: "api-secret"}
+	signed := func(contentType, body string) *http.Request {
+		mac := hmac.New(sha256.New, []byte("api-secret"))
+		mac.Write([]byte(body))
+
+		r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("Content-HMAC", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+		return r
+	}
+
+	pay := "TransactionId=1211506522&Amount=10.00&Currency=RUB&DateTime=2024-09-01+11%3A49%3A42" +
+		"&Status=Completed&OperationType=Payment&Description=%D0%97%D0%B0%D0%BA%D0%B0%D0%B7"
+	event, err := acquirer.ParsePaymentEvent(signed("application/x-www-form-urlencoded", pay), []byte(pay))
+	if err != nil {
+		t.Fatalf("ParsePaymentEvent(pay): %v", err)
+	}
+	if event.Type != PaymentSucceeded || event.PaymentID != "1211506522" || !event.Amount.Equal(decimal.NewFromInt(10)) ||
+		event.Description != "Заказ" || event.OccurredAt.Hour() != 11 {
+		t.Errorf("pay event = %+v", event)
+	}
+
+	refund := `{"TransactionId":1211506600,"PaymentTransactionId":1211506522,"Amount":4.5,"DateTime":"2024-09-02 10:00:00","OperationType":"Refund"}`
+	event, err = acquirer.ParsePaymentEvent(signed("application/json; charset=utf-8", refund), []byte(refund))
+	if err != nil {
+		t.Fatalf("ParsePaymentEvent(refund): %v", err)
+	}
+	if event.Type != PaymentRefunded || event.PaymentID != "1211506522" || event.RefundID != "1211506600" ||
+		!event.Amount.Equal(decimal.NewFromFloat(4.5)) {
+		t.Errorf("refund event = %+v, want a refund of the original transaction", event)
+	}
+
+	forged := signed("application/x-www-form-urlencoded", pay)
+	forged.Header.Set("Content-HMAC", "AAAA")
+	if _, err := acquirer.ParsePaymentEvent(forged, []byte(pay)); !errors.Is(err, ErrPaymentSignature) {
+		t.Errorf("forged: err = %v, want ErrPaymentSignature", err)
+	}
+
+	rec := httptest.NewRecorder()
+	acquirer.Acknowledge(rec)
+	if rec.Body.String() != `{"code":0}` {
+		t.Errorf("acknowledgement = %q, want {\"code\":0}", rec.Body.String())
+	}
+}
+
+func TestTinkoffAcquirer(t *testing.T) {
+	t.Parallel()
+
+	acquirer := TinkoffAcquirer{Password: "terminal-password"}
+	sign := func(body string) string {
+		fields, err := flatJSONFields([]byte(body))
+		if err != nil {
+			t.Fatalf("flatJSONFields: %v", err)
+		}
+		fields["Password"] = "terminal-password"
+
+		return strings.Replace(body, `"Token":""`, `"Token":"`+tinkoffToken(fields)+`"`, 1)
+	}
+
+	confirmed := sign(`{"TerminalKey":"1321054611234DEMO","OrderId":"201709","Success":true,"Status":"CONFIRMED",` +
+		`"PaymentId":8742591,"ErrorCode":"0","Amount":150050,"CardId":322264,"Pan":"430000******0777",` +
+		`"ExpDate":"1122","Data":{"Phone":"+79000000000"},"Token":""}`)
+	event, err := acquirer.ParsePaymentEvent(nil, []byte(confirmed))
+	if err != nil {
+		t.Fatalf("ParsePaymentEvent(confirmed): %v", err)
+	}
+	if event.Type != PaymentSucceeded || event.PaymentID != "8742591" || !event.Amount.Equal(decimal.NewFromFloat(1500.5)) {
+		t.Errorf("confirmed event = %+v, want 1500.50 rubles for 8742591", event)
+	}
+
+	full := sign(`{"TerminalKey":"1321054611234DEMO","Success":true,"Status":"REFUNDED","PaymentId":8742591,"Amount":150050,"Token":""}`)
+	event, err = acquirer.ParsePaymentEvent(nil, []byte(full))
+	if err != nil {
+		t.Fatalf("ParsePaymentEvent(full refund): %v", err)
+	}
+	if event.Type != PaymentRefunded || event.RefundID != "" {
+		t.Errorf("full refund event = %+v, want a refund cancelling the receipt", event)
+	}
+
+	tampered := strings.Replace(confirmed, `"Amount":150050`, `"Amount":1`, 1)
+	if _, err := acquirer.ParsePaymentEvent(nil, []byte(tampered)); !errors.Is(err, ErrPaymentSignature) {
+		t.Errorf("tampered: err = %v, want ErrPaymentSignature", err)
+	}
+
+	authorized := sign(`{"Success":true,"Status":"AUTHORIZED","PaymentId":1,"Amount":100,"Token":""}`)
+	if event, err := acquirer.ParsePaymentEvent(nil, []byte(authorized)); err != nil || event != nil {
+		t.Errorf("AUTHORIZED = %+v, %v; want it ignored", event, err)
+	}
+
+	rec := httptest.NewRecorder()
+	acquirer.Acknowledge(rec)
+	if rec.Body.String() != "OK" {
+		t.Errorf("acknowledgement = %q, want OK", rec.Body.String())
+	}
+}
+
+// A Tinkoff partial refund has no refund ID to tell two refunds of the same
+// amount apart, so it is rejected loudly rather than applied by guesswork.
+func TestTinkoffPartialRefund(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t)
+	store := new(MemoryPaymentReceiptStore)
+	if err := store.SavePaymentReceipt(context.Background(), "8742591", &PaymentReceipt{ReceiptUUID: "orig"}); err != nil {
+		t.Fatalf("SavePaymentReceipt: %v", err)
+	}
+
+	acquirer := TinkoffAcquirer{Password: "terminal-password"}
+	fields := map[string]string{
+		"TerminalKey": "1321054611234DEMO", "Success": "true", "Status": "PARTIAL_REFUNDED",
+		"PaymentId": "8742591", "Amount": "50000", "Password": "terminal-password",
+	}
+	body := `{"TerminalKey":"1321054611234DEMO","Success":true,"Status":"PARTIAL_REFUNDED","PaymentId":8742591,` +
+		`"Amount":50000,"Token":"` + tinkoffToken(fields) + `"}`
+
+	if _, err := acquirer.ParsePaymentEvent(nil, []byte(body)); !errors.Is(err, ErrPaymentUnsupported) {
+		t.Errorf("ParsePaymentEvent: err = %v, want ErrPaymentUnsupported", err)
+	}
+
+	var reported error
+	handler := NewPaymentWebhookHandler(client, acquirer, WithPaymentReceiptStore(store),
+		WithPaymentErrorHandler(func(_ *http.Request, err error) { reported = err }))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+	if rec.Code != http.StatusUnprocessableEntity || !errors.Is(reported, ErrPaymentUnsupported) {
+		t.Errorf("status = %d, reported %v, want %d and ErrPaymentUnsupported", rec.Code, reported, http.StatusUnprocessableEntity)
+	}
+	if len(srv.calls) != 0 {
+		t.Errorf("calls = %q, want the receipt left alone", srv.calls)
+	}
+}
@@ -0,0 +1,345 @@
+package moynalog
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// maxPaymentNotificationBody bounds the acquirer notifications accepted.
+const maxPaymentNotificationBody = 1 << 20
+
+var (
+	// ErrPaymentSignature is returned by a PaymentAcquirer for a notification
+	// that fails signature or origin verification.
+	ErrPaymentSignature = errors.New("moynalog: payment notification signature mismatch")
+	// ErrPaymentUnsupported is returned by a PaymentAcquirer for a verified
+	// notification it cannot apply safely, such as a Tinkoff partial refund,
+	// which has no refund ID. Such refunds are to be registered by hand with
+	// IncomeService.Refund, or passed to PaymentWebhookHandler.Handle with a
+	// RefundID of their own.
+	ErrPaymentUnsupported = errors.New("moynalog: payment notification is not supported")
+)
+
+// PaymentEventType is the kind of payment notification.
+type PaymentEventType string
+
+// Supported payment event types.
+const (
+	PaymentSucceeded PaymentEventType = "payment.succeeded"
+	PaymentRefunded  PaymentEventType = "payment.refunded"
+)
+
+// PaymentEvent is an acquirer notification reduced to what a receipt needs.
+type PaymentEvent struct {
+	Type PaymentEventType
+	// PaymentID identifies the original payment, for refunds as well.
+	PaymentID string
+	// RefundID identifies a refund. Refunds carrying one may be partial;
+	// refunds without one cancel the whole receipt.
+	RefundID string
+	// Amount is the paid or refunded amount in Currency.
+	Amount   decimal.Decimal
+	Currency Currency
+	// Description becomes the receipt line. Defaults to a generic one.
+	Description string
+	// OccurredAt is when the acquirer settled the operation.
+	OccurredAt time.Time
+	// Client is the counterparty, when the acquirer knows it.
+	Client *IncomeClient
+}
+
+// IncomeCreateRequest maps a successful payment onto a single line receipt
+// paid through an account.
+func (e *PaymentEvent) IncomeCreateRequest() (*IncomeCreateRequest, error) {
+	if e.Type != PaymentSucceeded {
+		return nil, errors.Errorf("moynalog: cannot register a receipt for a %s event", e.Type)
+	}
+	if e.Currency != "" && e.Currency != CurrencyRUB {
+		return nil, errors.Errorf("moynalog: payment currency %q is not supported", e.Currency)
+	}
+
+	name := e.Description
+	if name == "" {
+		name = "Оплата заказа " + e.PaymentID
+	}
+
+	return &IncomeCreateRequest{
+		Services:      []IncomeServiceItem{{Name: name, Amount: e.Amount, Quantity: decimal.NewFromInt(1)}},
+		OperationTime: e.OccurredAt,
+		Client:        e.Client,
+		PaymentType:   PaymentTypeAccount,
+	}, nil
+}
+
+// PaymentAcquirer understands the webhook notifications of one acquirer.
+//
+// The YooKassa, CloudPayments and Tinkoff adapters live in this package rather
+// than a separate one: they only turn notifications into a PaymentEvent using
+// the standard library, so a package of their own would isolate no
+// dependency and would only split the handler from the events it consumes.
+type PaymentAcquirer interface {
+	// ParsePaymentEvent verifies and decodes a notification. It returns a nil
+	// event for notifications that need no receipt, and an error wrapping
+	// ErrPaymentSignature when verification fails.
+	ParsePaymentEvent(r *http.Request, body []byte) (*PaymentEvent, error)
+	// Acknowledge answers a handled notification the way the acquirer expects.
+	Acknowledge(w http.ResponseWriter)
+}
+
+// PaymentReceipt is the receipt registered for a payment.
+type PaymentReceipt struct {
+	// ReceiptUUID is the receipt currently standing for the payment: the
+	// remainder receipt once the payment has been partially refunded.
+	ReceiptUUID string
+	// Refunded reports that the payment has been refunded in full.
+	Refunded bool
+	// Refunds are the IDs of the refunds already applied.
+	Refunds []string
+}
+
+// PaymentReceiptStore remembers which receipt was registered for which
+// payment. Acquirers redeliver notifications, so it also keeps the handler
+// idempotent. Implementations must be safe for concurrent use.
+type PaymentReceiptStore interface {
+	// PaymentReceipt returns the receipt of paymentID, or nil when none is known.
+	PaymentReceipt(ctx context.Context, paymentID string) (*PaymentReceipt, error)
+	// SavePaymentReceipt records the receipt of paymentID.
+	SavePaymentReceipt(ctx context.Context, paymentID string, receipt *PaymentReceipt) error
+}
+
+// MemoryPaymentReceiptStore keeps payment receipts in memory. The zero value
+// is ready to use.
+type MemoryPaymentReceiptStore struct {
+	mu       sync.Mutex
+	receipts map[string]PaymentReceipt
+}
+
+// PaymentReceipt implements PaymentReceiptStore.
+func (s *MemoryPaymentReceiptStore) PaymentReceipt(_ context.Context, paymentID string) (*PaymentReceipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt, ok := s.receipts[paymentID]
+	if !ok {
+		return nil, nil
+	}
+	receipt.Refunds = slices.Clone(receipt.Refunds)
+
+	return &receipt, nil
+}
+
+// SavePaymentReceipt implements PaymentReceiptStore.
+func (s *MemoryPaymentReceiptStore) SavePaymentReceipt(_ context.Context, paymentID string, receipt *PaymentReceipt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.receipts == nil {
+		s.receipts = map[string]PaymentReceipt{}
+	}
+	stored := *receipt
+	stored.Refunds = slices.Clone(receipt.Refunds)
+	s.receipts[paymentID] = stored
+
+	return nil
+}
+
+// PaymentEventMapper turns a successful payment into the receipt to register.
+type PaymentEventMapper func(event *PaymentEvent) (*IncomeCreateRequest, error)
+
+// PaymentWebhookHandler is an http.Handler receiving acquirer notifications:
+// successful payments are registered as receipts and refunds cancel them with
+// CancelCommentRefund, re-registering the remainder of a partial refund (see
+// IncomeService.Refund). Failures answer 5xx so the acquirer redelivers.
+type PaymentWebhookHandler struct {
+	acquirer PaymentAcquirer
+	income   *IncomeService
+	store    PaymentReceiptStore
+	mapper   PaymentEventMapper
+	onError  func(r *http.Request, err error)
+	// mu serialises notifications so a redelivery racing the original cannot
+	// register a second receipt.
+	mu sync.Mutex
+}
+
+// PaymentHandlerOption customises a PaymentWebhookHandler.
+type PaymentHandlerOption func(*PaymentWebhookHandler)
+
+// WithPaymentReceiptStore sets where payment receipts are remembered. Defaults
+// to a MemoryPaymentReceiptStore.
+func WithPaymentReceiptStore(store PaymentReceiptStore) PaymentHandlerOption {
+	return func(h *PaymentWebhookHandler) {
+		if store != nil {
+			h.store = store
+		}
+	}
+}
+
+// WithPaymentEventMapper replaces PaymentEvent.IncomeCreateRequest as the
+// mapping from payments to receipts.
+func WithPaymentEventMapper(mapper PaymentEventMapper) PaymentHandlerOption {
+	return func(h *PaymentWebhookHandler) {
+		if mapper != nil {
+			h.mapper = mapper
+		}
+	}
+}
+
+// WithPaymentErrorHandler reports every notification that failed, for logging.
+func WithPaymentErrorHandler(onError func(r *http.Request, err error)) PaymentHandlerOption {
+	return func(h *PaymentWebhookHandler) {
+		h.onError = onError
+	}
+}
+
+// NewPaymentWebhookHandler returns a handler registering receipts through
+// client for the notifications of acquirer.
+func NewPaymentWebhookHandler(client *Client, acquirer PaymentAcquirer, opts ...PaymentHandlerOption) *PaymentWebhookHandler {
+	h := &PaymentWebhookHandler{
+		acquirer: acquirer,
+		income:   client.Income,
+		store:    new(MemoryPaymentReceiptStore),
+		mapper:   (*PaymentEvent).IncomeCreateRequest,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *PaymentWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPaymentNotificationBody))
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, errors.Wrap(err, "moynalog: cannot read payment notification"))
+
+		return
+	}
+
+	event, err := h.acquirer.ParsePaymentEvent(r, body)
+	switch {
+	case errors.Is(err, ErrPaymentSignature):
+		h.fail(w, r, http.StatusForbidden, err)
+
+		return
+	case errors.Is(err, ErrPaymentUnsupported):
+		h.fail(w, r, http.StatusUnprocessableEntity, err)
+
+		return
+	case err != nil:
+		h.fail(w, r, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if event != nil {
+		if err := h.handle(r.Context(), event); err != nil {
+			h.fail(w, r, http.StatusInternalServerError, err)
+
+			return
+		}
+	}
+
+	h.acquirer.Acknowledge(w)
+}
+
+// Handle registers or cancels the receipt of event. ServeHTTP calls it for
+// every verified notification; call it directly for events obtained otherwise.
+func (h *PaymentWebhookHandler) Handle(ctx context.Context, event *PaymentEvent) error {
+	if event == nil {
+		return errors.New("moynalog: payment event cannot be nil")
+	}
+
+	return h.handle(ctx, event)
+}
+
+func (h *PaymentWebhookHandler) handle(ctx context.Context, event *PaymentEvent) error {
+	if event.PaymentID == "" {
+		return errors.New("moynalog: payment event has no payment ID")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	known, err := h.store.PaymentReceipt(ctx, event.PaymentID)
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case PaymentSucceeded:
+		if known != nil {
+			return nil
+		}
+
+		income, err := h.mapper(event)
+		if err != nil {
+			return err
+		}
+		created, _, err := h.income.Create(ctx, income)
+		if err != nil {
+			return err
+		}
+
+		return h.store.SavePaymentReceipt(ctx, event.PaymentID, &PaymentReceipt{ReceiptUUID: created.ApprovedReceiptUUID})
+	case PaymentRefunded:
+		// A refund of a payment no receipt was registered for has nothing to
+		// cancel.
+		if known == nil || known.Refunded || slices.Contains(known.Refunds, event.RefundID) {
+			return nil
+		}
+		if event.Currency != "" && event.Currency != CurrencyRUB {
+			return errors.Errorf("moynalog: refund currency %q is not supported", event.Currency)
+		}
+
+		if event.RefundID == "" || !event.Amount.IsPositive() {
+			_, _, err := h.income.Cancel(ctx, &IncomeCancelRequest{
+				ReceiptUUID:   known.ReceiptUUID,
+				Comment:       CancelCommentRefund,
+				OperationTime: event.OccurredAt,
+			})
+			if err != nil {
+				return err
+			}
+			known.Refunded = true
+
+			return h.store.SavePaymentReceipt(ctx, event.PaymentID, known)
+		}
+
+		refund, _, err := h.income.Refund(ctx, known.ReceiptUUID, event.Amount)
+		if err != nil {
+			return err
+		}
+		known.Refunds = append(known.Refunds, event.RefundID)
+		if refund.RemainderReceiptUUID == "" {
+			known.Refunded = true
+		} else {
+			known.ReceiptUUID = refund.RemainderReceiptUUID
+		}
+
+		return h.store.SavePaymentReceipt(ctx, event.PaymentID, known)
+	default:
+		return errors.Errorf("moynalog: payment event type %q is unknown", event.Type)
+	}
+}
+
+func (h *PaymentWebhookHandler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.onError != nil {
+		h.onError(r, err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
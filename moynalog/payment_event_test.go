@@ -0,0 +1,230 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// stubAcquirer accepts every notification and decodes it with parse.
+type stubAcquirer struct {
+	parse func(body string) (*PaymentEvent, error)
+}
+
+func (a stubAcquirer) ParsePaymentEvent(_ *http.Request, body []byte) (*PaymentEvent, error) {
+	return a.parse(string(body))
+}
+
+func (stubAcquirer) Acknowledge(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func postNotification(t *testing.T, handler http.Handler, body string) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+
+	return rec.Code
+}
+
+func TestPaymentEventIncomeCreateRequest(t *testing.T) {
+	t.Parallel()
+
+	paidAt := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	event := &PaymentEvent{
+		Type:       PaymentSucceeded,
+		PaymentID:  "p1",
+		Amount:     decimal.NewFromFloat(1500.5),
+		Currency:   "RUB",
+		OccurredAt: paidAt,
+	}
+
+	income, err := event.IncomeCreateRequest()
+	if err != nil {
+		t.Fatalf("IncomeCreateRequest: %v", err)
+	}
+	if len(income.Services) != 1 || income.Services[0].Name != "Оплата заказа p1" ||
+		!income.Services[0].Amount.Equal(event.Amount) || !income.Services[0].Quantity.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("Services = %+v, want a single line for the paid amount", income.Services)
+	}
+	if income.PaymentType != PaymentTypeAccount || !income.OperationTime.Equal(paidAt) {
+		t.Errorf("request = %+v, want an account payment at the payment time", income)
+	}
+
+	event.Currency = "USD"
+	if _, err := event.IncomeCreateRequest(); err == nil {
+		t.Error("want an error for a foreign currency")
+	}
+
+	event.Currency = "RUB"
+	event.Type = PaymentRefunded
+	if _, err := event.IncomeCreateRequest(); err == nil {
+		t.Error("want an error for a refund")
+	}
+}
+
+func TestPaymentWebhookHandler(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+
+	var creates, cancels atomic.Int32
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, r *http.Request) {
+		creates.Add(1)
+		if got := testBody(t, r)["paymentType"]; got != string(PaymentTypeAccount) {
+			t.Errorf("paymentType = %v, want %q", got, PaymentTypeAccount)
+		}
+		writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"r1"}`)
+	})
+	mux.HandleFunc("/v1/cancel", func(w http.ResponseWriter, r *http.Request) {
+		cancels.Add(1)
+		body := testBody(t, r)
+		if body["receiptUuid"] != "r1" || body["comment"] != string(CancelCommentRefund) {
+			t.Errorf("cancel body = %v, want a refund of r1", body)
+		}
+		writeJSON(t, w, http.StatusOK, `{"incomeInfo":{"approvedReceiptUuid":"r1"}}`)
+	})
+
+	acquirer := stubAcquirer{parse: func(body string) (*PaymentEvent, error) {
+		switch body {
+		case "paid":
+			return &PaymentEvent{Type: PaymentSucceeded, PaymentID: "p1", Amount: decimal.NewFromInt(100)}, nil
+		case "refunded":
+			return &PaymentEvent{Type: PaymentRefunded, PaymentID: "p1", Amount: decimal.NewFromInt(100)}, nil
+		case "unknown refund":
+			return &PaymentEvent{Type: PaymentRefunded, PaymentID: "p2"}, nil
+		case "forged":
+			return nil, ErrPaymentSignature
+		default:
+			return nil, nil
+		}
+	}}
+
+	store := new(MemoryPaymentReceiptStore)
+	var failures atomic.Int32
+	handler := NewPaymentWebhookHandler(
+		client, acquirer,
+		WithPaymentReceiptStore(store),
+		WithPaymentErrorHandler(func(*http.Request, error) { failures.Add(1) }),
+	)
+
+	// Redelivered notifications must not register or cancel twice.
+	for _, body := range []string{"paid", "paid", "pending", "refunded", "refunded", "unknown refund"} {
+		if status := postNotification(t, handler, body); status != http.StatusAccepted {
+			t.Errorf("%q: status = %d, want the acquirer acknowledgement", body, status)
+		}
+	}
+	if creates.Load() != 1 || cancels.Load() != 1 {
+		t.Errorf("creates = %d, cancels = %d, want one of each", creates.Load(), cancels.Load())
+	}
+
+	receipt, err := store.PaymentReceipt(context.Background(), "p1")
+	if err != nil {
+		t.Fatalf("PaymentReceipt: %v", err)
+	}
+	if receipt == nil || receipt.ReceiptUUID != "r1" || !receipt.Refunded {
+		t.Errorf("stored receipt = %+v, want r1 marked refunded", receipt)
+	}
+
+	if status := postNotification(t, handler, "forged"); status != http.StatusForbidden {
+		t.Errorf("forged: status = %d, want %d", status, http.StatusForbidden)
+	}
+	if failures.Load() != 1 {
+		t.Errorf("error handler called %d times, want 1", failures.Load())
+	}
+}
+
+// A failed registration must answer 5xx so the acquirer redelivers.
+func TestPaymentWebhookHandlerUpstreamFailure(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	acquirer := stubAcquirer{parse: func(string) (*PaymentEvent, error) {
+		return &PaymentEvent{Type: PaymentSucceeded, PaymentID: "p1", Amount: decimal.NewFromInt(100)}, nil
+	}}
+	store := new(MemoryPaymentReceiptStore)
+	handler := NewPaymentWebhookHandler(client, acquirer, WithPaymentReceiptStore(store))
+
+	if status := postNotification(t, handler, "paid"); status != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", status, http.StatusInternalServerError)
+	}
+	if receipt, _ := store.PaymentReceipt(context.Background(), "p1"); receipt != nil {
+		t.Errorf("stored receipt = %+v, want none after a failure", receipt)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhook", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+// A partial refund re-registers the remainder, and is applied only once.
+func TestPaymentWebhookHandlerPartialRefund(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t)
+
+	store := new(MemoryPaymentReceiptStore)
+	if err := store.SavePaymentReceipt(context.Background(), "p1", &PaymentReceipt{ReceiptUUID: "orig"}); err != nil {
+		t.Fatalf("SavePaymentReceipt: %v", err)
+	}
+
+	acquirer := stubAcquirer{parse: func(string) (*PaymentEvent, error) {
+		return &PaymentEvent{Type: PaymentRefunded, PaymentID: "p1", RefundID: "rf1", Amount: decimal.NewFromInt(500)}, nil
+	}}
+	handler := NewPaymentWebhookHandler(client, acquirer, WithPaymentReceiptStore(store))
+
+	for range 2 {
+		if status := postNotification(t, handler, "refunded"); status != http.StatusAccepted {
+			t.Errorf("status = %d, want the acquirer acknowledgement", status)
+		}
+	}
+	if len(srv.calls) != 2 {
+		t.Errorf("calls = %q, want one create and one cancel", srv.calls)
+	}
+
+	receipt, err := store.PaymentReceipt(context.Background(), "p1")
+	if err != nil {
+		t.Fatalf("PaymentReceipt: %v", err)
+	}
+	if receipt.ReceiptUUID != "rest" || receipt.Refunded || len(receipt.Refunds) != 1 {
+		t.Errorf("stored receipt = %+v, want the remainder receipt with rf1 applied", receipt)
+	}
+}
+
+// Refunds are checked for their currency like payments, before any receipt is
+// touched.
+func TestPaymentWebhookHandlerRefundCurrency(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t)
+	store := new(MemoryPaymentReceiptStore)
+	if err := store.SavePaymentReceipt(context.Background(), "p1", &PaymentReceipt{ReceiptUUID: "orig"}); err != nil {
+		t.Fatalf("SavePaymentReceipt: %v", err)
+	}
+	handler := NewPaymentWebhookHandler(client, stubAcquirer{}, WithPaymentReceiptStore(store))
+
+	for _, event := range []*PaymentEvent{
+		{Type: PaymentRefunded, PaymentID: "p1", RefundID: "rf1", Amount: decimal.NewFromInt(5), Currency: CurrencyUSD},
+		{Type: PaymentRefunded, PaymentID: "p1", Currency: CurrencyEUR},
+	} {
+		if err := handler.Handle(context.Background(), event); err == nil {
+			t.Errorf("Handle(%s refund) = nil, want an error", event.Currency)
+		}
+	}
+	if len(srv.calls) != 0 {
+		t.Errorf("calls = %q, want the receipt left alone", srv.calls)
+	}
+}
@@ -0,0 +1,275 @@
+package moynalog
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// qrPayloadHeader opens an ST00012 payload: the GOST R 56042 format
+	// identifier, version 0001 and encoding 2, UTF-8.
+	qrPayloadHeader = "ST00012"
+	// qrPayloadSeparator separates the fields of the payload.
+	qrPayloadSeparator = "|"
+
+	bicLength     = 9
+	accountLength = 20
+
+	// DrawerStatusIndividual is the payer status, field 101 of a payment
+	// order, of an individual paying their own tax.
+	DrawerStatusIndividual = "13"
+)
+
+// TaxPayee holds the bank details tax is paid to.
+type TaxPayee struct {
+	Name                 string
+	INN                  string
+	KPP                  string
+	BankName             string
+	BIC                  string
+	Account              string
+	CorrespondentAccount string
+}
+
+// DefaultTaxPayee returns the details of the single tax account of the
+// Federal Treasury, which every tax, the professional income tax included,
+// is paid to since 2023.
+func DefaultTaxPayee() TaxPayee {
+	return TaxPayee{
+		Name:                 "Казначейство России (ФНС России)",
+		INN:                  "7727406020",
+		KPP:                  "770801001",
+		BankName:             "ОКЦ № 7 ГУ Банка России по ЦФО//УФК по Тульской области, г Тула",
+		BIC:                  "017003983",
+		Account:              "03100643000000018500",
+		CorrespondentAccount: "40102810445370000059",
+	}
+}
+
+// TaxPaymentOrder is a payment order for a tax charge. Build it with
+// TaxHistoryRecord.PaymentOrder or TaxPayment.PaymentOrder, then scan its
+// QRPayload in a bank app or print its Text or HTML.
+type TaxPaymentOrder struct {
+	Payee     TaxPayee
+	PayerINN  string
+	PayerName string
+	Amount    decimal.Decimal
+	Kbk       string
+	Oktmo     string
+	// DocumentIndex is the unique charge identifier (UIN) of the tax notice,
+	// if there is one.
+	DocumentIndex string
+	TaxPeriod     TaxPeriod
+	Purpose       string
+	// DrawerStatus is the payer status, field 101 of the order, which the
+	// bank requires for tax payments: DrawerStatusIndividual by default.
+	DrawerStatus string
+}
+
+// PaymentOrder returns the order paying what is left unpaid of the accrual by
+// the taxpayer with payerINN.
+func (r *TaxHistoryRecord) PaymentOrder(payerINN string) *TaxPaymentOrder {
+	return newTaxPaymentOrder(payerINN, r.TaxAmount.Sub(r.PaidAmount), r.Kbk, r.Oktmo, "", r.TaxPeriod())
+}
+
+// PaymentOrder returns the order making the payment by the taxpayer with
+// payerINN.
+func (p *TaxPayment) PaymentOrder(payerINN string) *TaxPaymentOrder {
+	return newTaxPaymentOrder(payerINN, p.Amount, p.Kbk, p.Oktmo, p.DocumentIndex, p.TaxPeriod())
+}
+
+func newTaxPaymentOrder(payerINN string, amount decimal.Decimal, kbk, oktmo, index string, period TaxPeriod) *TaxPaymentOrder {
+	purpose := "Налог на профессиональный доход"
+	if period.Valid() {
+		purpose += " за " + period.Start().Format("01.2006")
+	}
+
+	return &TaxPaymentOrder{
+		Payee:         DefaultTaxPayee(),
+		PayerINN:      payerINN,
+		Amount:        amount,
+		Kbk:           kbk,
+		Oktmo:         oktmo,
+		DocumentIndex: index,
+		TaxPeriod:     period,
+		Purpose:       purpose,
+		DrawerStatus:  DrawerStatusIndividual,
+	}
+}
+
+// Validate checks that the order has what a bank needs to make the payment.
+func (o *TaxPaymentOrder) Validate() error {
+	payee := o.Payee
+	switch {
+	case payee.Name == "" || payee.BankName == "":
+		return invalidArgument("moynalog: payment order payee and bank names are required")
+	case len(payee.BIC) != bicLength || !isDigits(payee.BIC):
+		return invalidArgument("moynalog: payment order BIC %q must be %d digits", payee.BIC, bicLength)
+	case len(payee.Account) != accountLength || !isDigits(payee.Account):
+		return invalidArgument("moynalog: payment order account %q must be %d digits", payee.Account, accountLength)
+	case payee.CorrespondentAccount != "" &&
+		(len(payee.CorrespondentAccount) != accountLength || !isDigits(payee.CorrespondentAccount)):
+		return invalidArgument("moynalog: payment order correspondent account %q must be %d digits",
+			payee.CorrespondentAccount, accountLength)
+	case !o.Amount.IsPositive():
+		return invalidArgument("moynalog: payment order amount %s must be positive", o.Amount)
+	case !o.Amount.Equal(o.Amount.Round(amountPlaces)):
+		return invalidArgument("moynalog: payment order amount %s has fractions of a kopeck", o.Amount)
+	case o.DrawerStatus == "":
+		return invalidArgument("moynalog: payment order payer status is required")
+	}
+	if payee.INN != "" {
+		if err := validateINN(payee.INN, "payee INN"); err != nil {
+			return err
+		}
+	}
+	if o.PayerINN != "" {
+		if err := validateINN(o.PayerINN, "payer INN"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QRPayload returns the order as an ST00012 payload of GOST R 56042, the
+// format bank apps read from payment QR codes. Encode it into a QR code with
+// any library; the sum is written in kopecks.
+func (o *TaxPaymentOrder) QRPayload() (string, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+
+	fields := []struct{ name, value string }{
+		{"Name", o.Payee.Name},
+		{"PersonalAcc", o.Payee.Account},
+		{"BankName", o.Payee.BankName},
+		{"BIC", o.Payee.BIC},
+		{"CorrespAcc", o.Payee.CorrespondentAccount},
+		{"Sum", o.Amount.Shift(amountPlaces).String()},
+		{"Purpose", o.Purpose},
+		{"PayeeINN", o.Payee.INN},
+		{"KPP", o.Payee.KPP},
+		{"PayerINN", o.PayerINN},
+		{"DrawerStatus", o.DrawerStatus},
+		{"CBC", o.Kbk},
+		{"OKTMO", o.Oktmo},
+		{"UIN", o.DocumentIndex},
+	}
+
+	var payload strings.Builder
+	payload.WriteString(qrPayloadHeader)
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if strings.Contains(field.value, qrPayloadSeparator) {
+			return "", invalidArgument("moynalog: payment order %s cannot contain %q", field.name, qrPayloadSeparator)
+		}
+		payload.WriteString(qrPayloadSeparator + field.name + "=" + field.value)
+	}
+
+	return payload.String(), nil
+}
+
+const taxPaymentOrderTextTemplate = `Платёжное поручение
+Получатель: {{.Payee.Name}}
+ИНН {{.Payee.INN}}, КПП {{.Payee.KPP}}
+Банк получателя: {{.Payee.BankName}}
+БИК {{.Payee.BIC}}
+Счёт получателя: {{.Payee.Account}}
+Корр. счёт: {{.Payee.CorrespondentAccount}}
+{{if .PayerName}}Плательщик: {{.PayerName}}
+{{end}}{{if .PayerINN}}ИНН плательщика: {{.PayerINN}}
+{{end}}{{if .DrawerStatus}}Статус плательщика: {{.DrawerStatus}}
+{{end}}Сумма: {{.Amount}}
+КБК: {{.Kbk}}
+ОКТМО: {{.Oktmo}}
+{{if .DocumentIndex}}УИН: {{.DocumentIndex}}
+{{end}}Назначение платежа: {{.Purpose}}
+`
+
+const taxPaymentOrderHTMLTemplate = `<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Платёжное поручение</title></head>
+<body style="font-family:sans-serif">
+<h1>Платёжное поручение</h1>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Получатель</th><td>{{.Payee.Name}}</td></tr>
+<tr><th>ИНН / КПП</th><td>{{.Payee.INN}} / {{.Payee.KPP}}</td></tr>
+<tr><th>Банк получателя</th><td>{{.Payee.BankName}}</td></tr>
+<tr><th>БИК</th><td>{{.Payee.BIC}}</td></tr>
+<tr><th>Счёт получателя</th><td>{{.Payee.Account}}</td></tr>
+<tr><th>Корр. счёт</th><td>{{.Payee.CorrespondentAccount}}</td></tr>
+{{- if .PayerName}}
+<tr><th>Плательщик</th><td>{{.PayerName}}</td></tr>
+{{- end}}
+{{- if .PayerINN}}
+<tr><th>ИНН плательщика</th><td>{{.PayerINN}}</td></tr>
+{{- end}}
+{{- if .DrawerStatus}}
+<tr><th>Статус плательщика</th><td>{{.DrawerStatus}}</td></tr>
+{{- end}}
+<tr><th>Сумма</th><td>{{.Amount}}</td></tr>
+<tr><th>КБК</th><td>{{.Kbk}}</td></tr>
+<tr><th>ОКТМО</th><td>{{.Oktmo}}</td></tr>
+{{- if .DocumentIndex}}
+<tr><th>УИН</th><td>{{.DocumentIndex}}</td></tr>
+{{- end}}
+<tr><th>Назначение платежа</th><td>{{.Purpose}}</td></tr>
+</table>
+</body>
+</html>
+`
+
+var (
+	taxPaymentOrderText = texttemplate.Must(texttemplate.New("payment_order.txt").Parse(taxPaymentOrderTextTemplate))
+	taxPaymentOrderHTML = htmltemplate.Must(htmltemplate.New("payment_order.html").Parse(taxPaymentOrderHTMLTemplate))
+)
+
+// taxPaymentOrderView is the data both payment order templates are executed
+// against.
+type taxPaymentOrderView struct {
+	*TaxPaymentOrder
+	Amount string
+}
+
+func (o *TaxPaymentOrder) view() *taxPaymentOrderView {
+	return &taxPaymentOrderView{
+		TaxPaymentOrder: o,
+		Amount:          strings.Replace(o.Amount.StringFixed(amountPlaces), ".", ",", 1) + " ₽",
+	}
+}
+
+// Text renders the order as plain text.
+func (o *TaxPaymentOrder) Text() (string, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+
+	var text bytes.Buffer
+	if err := taxPaymentOrderText.Execute(&text, o.view()); err != nil {
+		return "", errors.Wrap(err, "moynalog: cannot render payment order text")
+	}
+
+	return text.String(), nil
+}
+
+// HTML renders the order as an HTML page.
+func (o *TaxPaymentOrder) HTML() (string, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+
+	var html bytes.Buffer
+	if err := taxPaymentOrderHTML.Execute(&html, o.view()); err != nil {
+		return "", errors.Wrap(err, "moynalog: cannot render payment order HTML")
+	}
+
+	return html.String(), nil
+}
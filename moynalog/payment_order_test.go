@@ -0,0 +1,114 @@
+package moynalog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestTaxHistoryRecordPaymentOrder(t *testing.T) {
+	t.Parallel()
+
+	record := &TaxHistoryRecord{
+		TaxPeriodID: 202409,
+		TaxAmount:   decimal.RequireFromString("1200.50"),
+		PaidAmount:  decimal.RequireFromString("200"),
+		Kbk:         "18210506000011000110",
+		Oktmo:       "45000000",
+	}
+	order := record.PaymentOrder("500100732259")
+
+	payload, err := order.QRPayload()
+	if err != nil {
+		t.Fatalf("QRPayload: %v", err)
+	}
+	want := "ST00012|Name=Казначейство России (ФНС России)|PersonalAcc=03100643000000018500" +
+		"|BankName=ОКЦ № 7 ГУ Банка России по ЦФО//УФК по Тульской области, г Тула|BIC=017003983" +
+		"|CorrespAcc=40102810445370000059|Sum=100050|Purpose=Налог на профессиональный доход за 09.2024" +
+		"|PayeeINN=7727406020|KPP=770801001|PayerINN=500100732259|DrawerStatus=13|CBC=18210506000011000110|OKTMO=45000000"
+	if payload != want {
+		t.Errorf("QRPayload =\n%s\nwant\n%s", payload, want)
+	}
+}
+
+func TestTaxPaymentPaymentOrder(t *testing.T) {
+	t.Parallel()
+
+	payment := &TaxPayment{
+		DocumentIndex: "18201061201010000510",
+		Amount:        decimal.RequireFromString("99.9"),
+		Kbk:           "18210506000011000110",
+		Oktmo:         "45000000",
+	}
+	order := payment.PaymentOrder("")
+	order.PayerName = "Иванов <Иван>"
+
+	payload, err := order.QRPayload()
+	if err != nil {
+		t.Fatalf("QRPayload: %v", err)
+	}
+	if !strings.Contains(payload, "|Sum=9990|Purpose=Налог на профессиональный доход|") || !strings.Contains(payload, "|DrawerStatus=13|") ||
+		!strings.HasSuffix(payload, "|UIN=18201061201010000510") || strings.Contains(payload, "PayerINN") {
+		t.Errorf("QRPayload = %s", payload)
+	}
+
+	text, err := order.Text()
+	if err != nil {
+		t.Fatalf("Text: %v", err)
+	}
+	for _, want := range []string{"Плательщик: Иванов <Иван>\n", "Статус плательщика: 13\n", "Сумма: 99,90 ₽\n", "УИН: 18201061201010000510\n"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Text lacks %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "ИНН плательщика") {
+		t.Errorf("Text must leave out the missing payer INN:\n%s", text)
+	}
+
+	html, err := order.HTML()
+	if err != nil {
+		t.Fatalf("HTML: %v", err)
+	}
+	if !strings.Contains(html, "<td>Иванов &lt;Иван&gt;</td>") || !strings.Contains(html, "<td>99,90 ₽</td>") {
+		t.Errorf("HTML must escape the payer name and format the amount:\n%s", html)
+	}
+}
+
+func TestTaxPaymentOrderInvalid(t *testing.T) {
+	t.Parallel()
+
+	valid := func() *TaxPaymentOrder {
+		return (&TaxPayment{Amount: decimal.NewFromInt(100), Kbk: "18210506000011000110"}).PaymentOrder("500100732259")
+	}
+
+	tests := map[string]func(o *TaxPaymentOrder){
+		"nothing to pay":   func(o *TaxPaymentOrder) { o.Amount = decimal.Zero },
+		"kopeck fractions": func(o *TaxPaymentOrder) { o.Amount = decimal.RequireFromString("1.005") },
+		"short BIC":        func(o *TaxPaymentOrder) { o.Payee.BIC = "01700398" },
+		"account letters":  func(o *TaxPaymentOrder) { o.Payee.Account = "0310064300000001850x" },
+		"no payee":         func(o *TaxPaymentOrder) { o.Payee.Name = "" },
+		"payer INN":        func(o *TaxPaymentOrder) { o.PayerINN = "500100732250" },
+		"separator":        func(o *TaxPaymentOrder) { o.Purpose = "налог | пени" },
+		"no payer status":  func(o *TaxPaymentOrder) { o.DrawerStatus = "" },
+	}
+	for name, spoil := range tests {
+		order := valid()
+		spoil(order)
+		if _, err := order.QRPayload(); err == nil {
+			t.Errorf("%s: QRPayload = nil error, want one", name)
+		}
+	}
+
+	if _, err := valid().QRPayload(); err != nil {
+		t.Errorf("QRPayload of a valid order: %v", err)
+	}
+	order := valid()
+	order.Amount = decimal.Zero
+	if _, err := order.Text(); err == nil {
+		t.Error("Text must validate the order")
+	}
+	if _, err := order.HTML(); err == nil {
+		t.Error("HTML must validate the order")
+	}
+}
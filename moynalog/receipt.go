@@ -5,6 +5,7 @@
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
@@ -38,6 +39,11 @@ type Receipt struct {
 	InvoiceID          string            `json:"invoiceId"`
 }
 
+// TaxPeriod returns TaxPeriodID as a TaxPeriod.
+func (r *Receipt) TaxPeriod() TaxPeriod {
+	return TaxPeriod(r.TaxPeriodID)
+}
+
 // Cancelled reports whether the receipt has been cancelled.
 func (r *Receipt) Cancelled() bool {
 	return r.CancellationInfo != nil
@@ -66,6 +72,27 @@ func (s *ReceiptService) JSON(ctx context.Context, receiptUUID string) (*Receipt
 	return receipt, resp, nil
 }
 
+// receiptPublicEndpoint is where buyers check receipts on lknpd.nalog.ru,
+// whatever endpoint the client talks to.
+const receiptPublicEndpoint = "https://lknpd.nalog.ru/api/v1/receipt/"
+
+// ReceiptPublicURL returns the public address of the receipt receiptUUID
+// issued by the taxpayer inn: the one encoded in the QR code of receipts made
+// in the "Мой налог" app, which buyers open without an account.
+func ReceiptPublicURL(inn, receiptUUID string) string {
+	return receiptPublicEndpoint + url.PathEscape(inn) + "/" + url.PathEscape(receiptUUID) + "/print"
+}
+
+// PublicURL returns the public address of the receipt, see ReceiptPublicURL.
+// It is empty when the receipt lacks its INN or ID.
+func (r *Receipt) PublicURL() string {
+	if r.Inn == "" || r.ReceiptID == "" {
+		return ""
+	}
+
+	return ReceiptPublicURL(r.Inn, r.ReceiptID)
+}
+
 // PrintURL returns the absolute URL of the printable receipt. The URL is not
 // public: fetch it with an authenticated client, or use Print.
 func (s *ReceiptService) PrintURL(ctx context.Context, receiptUUID string) (string, error) {
@@ -110,7 +137,7 @@ func (s *ReceiptService) Print(ctx context.Context, receiptUUID string) ([]byte,
 // otherwise.
 func (s *ReceiptService) receiptPath(ctx context.Context, receiptUUID, action string) (string, error) {
 	if receiptUUID == "" {
-		return "", errors.New("moynalog: receipt UUID cannot be empty")
+		return "", invalidArgument("moynalog: receipt UUID cannot be empty")
 	}
 
 	inn, err := s.inn(ctx)
@@ -0,0 +1,88 @@
+package moynalog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReceiptQueue is an outbox for receipts: with one configured through
+// WithReceiptQueue, IncomeService.Create queues the receipt instead of failing
+// while the CircuitBreaker holds POST /income open, and returns an error
+// matching ErrReceiptQueued. Registering the queued receipts once the API is
+// back, with IncomeService.Create, is up to the queue's owner; see
+// MemoryReceiptQueue.Flush.
+type ReceiptQueue interface {
+	EnqueueReceipt(ctx context.Context, income *IncomeCreateRequest) error
+}
+
+// WithReceiptQueue makes IncomeService.Create queue receipts in queue while
+// the circuit of POST /income is open.
+func WithReceiptQueue(queue ReceiptQueue) Option {
+	return func(c *Client) {
+		c.receiptQueue = queue
+	}
+}
+
+// enqueue queues income after Create failed with circuitErr. A receipt without
+// an operation time is queued with the current one, so it is registered for
+// the moment of the sale rather than that of the flush.
+func (s *IncomeService) enqueue(ctx context.Context, income *IncomeCreateRequest, circuitErr error) error {
+	queued := *income
+	if queued.OperationTime.IsZero() {
+		queued.OperationTime = time.Now()
+	}
+	if err := s.client.receiptQueue.EnqueueReceipt(ctx, &queued); err != nil {
+		return errors.Wrapf(err, "moynalog: cannot queue the receipt (%v)", circuitErr)
+	}
+
+	return errors.Wrap(ErrReceiptQueued, circuitErr.Error())
+}
+
+// MemoryReceiptQueue keeps queued receipts in memory, in the order they were
+// queued. The zero value is ready to use.
+type MemoryReceiptQueue struct {
+	mu       sync.Mutex
+	receipts []*IncomeCreateRequest
+}
+
+// EnqueueReceipt implements ReceiptQueue.
+func (q *MemoryReceiptQueue) EnqueueReceipt(_ context.Context, income *IncomeCreateRequest) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.receipts = append(q.receipts, income)
+
+	return nil
+}
+
+// Len returns the number of queued receipts.
+func (q *MemoryReceiptQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.receipts)
+}
+
+// Flush registers the queued receipts in order with s and returns the
+// receipts created. It stops at the first failure, a circuit still open
+// included, and returns it; the receipt that failed and those after it stay
+// queued for the next Flush.
+func (q *MemoryReceiptQueue) Flush(ctx context.Context, s *IncomeService) ([]*IncomeCreated, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var created []*IncomeCreated
+	for len(q.receipts) > 0 {
+		receipt, _, err := s.create(ctx, q.receipts[0])
+		if err != nil {
+			return created, err
+		}
+		created = append(created, receipt)
+		q.receipts = q.receipts[1:]
+	}
+
+	return created, nil
+}
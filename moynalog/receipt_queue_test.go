@@ -0,0 +1,65 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// While POST /income is open, receipts go to the queue with their operation
+// time fixed, and Flush registers them once the circuit closes again.
+func TestIncomeCreateQueuesWhileCircuitOpen(t *testing.T) {
+	t.Parallel()
+
+	breaker, clock := newTestBreaker(WithCircuitThreshold(1), WithCircuitCooldown(time.Minute))
+	client, mux, _ := setupBreaker(t, breaker)
+	queue := new(MemoryReceiptQueue)
+	client.receiptQueue = queue
+
+	var healthy atomic.Bool
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, _ *http.Request) {
+		if !healthy.Load() {
+			writeJSON(t, w, http.StatusInternalServerError, `{"message":"maintenance"}`)
+
+			return
+		}
+		writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"r1"}`)
+	})
+
+	income := &IncomeCreateRequest{
+		Services: []IncomeServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(100), Quantity: decimal.NewFromInt(1)}},
+	}
+	if _, _, err := client.Income.Create(context.Background(), income); !errors.Is(err, ErrServer) {
+		t.Fatalf("Create = %v, want the server error, the circuit still closed", err)
+	}
+	if queue.Len() != 0 {
+		t.Errorf("queued %d receipts, want a server error left to the caller", queue.Len())
+	}
+
+	created, _, err := client.Income.Create(context.Background(), income)
+	if !errors.Is(err, ErrReceiptQueued) || created != nil {
+		t.Fatalf("Create while open = %+v, %v; want ErrReceiptQueued", created, err)
+	}
+	if queue.Len() != 1 || queue.receipts[0].OperationTime.IsZero() || !income.OperationTime.IsZero() {
+		t.Errorf("queued %+v, want a copy with the operation time set", queue.receipts)
+	}
+
+	if _, err := queue.Flush(context.Background(), client.Income); !errors.Is(err, ErrCircuitOpen) || queue.Len() != 1 {
+		t.Errorf("Flush while open = %v with %d queued, want ErrCircuitOpen and the receipt kept", err, queue.Len())
+	}
+
+	clock.Advance(time.Minute)
+	healthy.Store(true)
+	flushed, err := queue.Flush(context.Background(), client.Income)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(flushed) != 1 || flushed[0].ApprovedReceiptUUID != "r1" || queue.Len() != 0 {
+		t.Errorf("Flush = %+v with %d queued, want r1 registered", flushed, queue.Len())
+	}
+}
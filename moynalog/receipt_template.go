@@ -0,0 +1,404 @@
+package moynalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// ReceiptLocale is the language a receipt is rendered in.
+type ReceiptLocale string
+
+// Supported receipt locales.
+const (
+	ReceiptLocaleRU ReceiptLocale = "ru"
+	ReceiptLocaleEN ReceiptLocale = "en"
+)
+
+// Valid reports whether l is a known receipt locale.
+func (l ReceiptLocale) Valid() bool {
+	switch l {
+	case ReceiptLocaleRU, ReceiptLocaleEN:
+		return true
+	default:
+		return false
+	}
+}
+
+// receiptDateLayout is how timestamps appear on a rendered receipt.
+const receiptDateLayout = "02.01.2006 15:04"
+
+// receiptLabels holds the captions of a rendered receipt in one locale.
+type receiptLabels struct {
+	Subject      string
+	Title        string
+	Cancelled    string
+	Reason       string
+	Seller       string
+	Buyer        string
+	Inn          string
+	Date         string
+	Service      string
+	Quantity     string
+	Price        string
+	Amount       string
+	Total        string
+	PaymentType  string
+	Link         string
+	Cash         string
+	Account      string
+	Anonymous    string
+	CancelReason map[CancelComment]string
+}
+
+var receiptLabelsByLocale = map[ReceiptLocale]receiptLabels{
+	ReceiptLocaleRU: {
+		Subject:     "Чек №",
+		Title:       "Чек",
+		Cancelled:   "Чек аннулирован",
+		Reason:      "Причина",
+		Seller:      "Продавец",
+		Buyer:       "Покупатель",
+		Inn:         "ИНН",
+		Date:        "Дата",
+		Service:     "Наименование",
+		Quantity:    "Кол-во",
+		Price:       "Цена",
+		Amount:      "Сумма",
+		Total:       "Итого",
+		PaymentType: "Способ оплаты",
+		Link:        "Проверить чек",
+		Cash:        "Наличные",
+		Account:     "Безналичный расчёт",
+		Anonymous:   "Физическое лицо",
+		CancelReason: map[CancelComment]string{
+			CancelCommentMistake: string(CancelCommentMistake),
+			CancelCommentRefund:  string(CancelCommentRefund),
+		},
+	},
+	ReceiptLocaleEN: {
+		Subject:     "Receipt #",
+		Title:       "Receipt",
+		Cancelled:   "This receipt has been cancelled",
+		Reason:      "Reason",
+		Seller:      "Seller",
+		Buyer:       "Buyer",
+		Inn:         "INN",
+		Date:        "Date",
+		Service:     "Service",
+		Quantity:    "Qty",
+		Price:       "Price",
+		Amount:      "Amount",
+		Total:       "Total",
+		PaymentType: "Payment",
+		Link:        "Verify receipt",
+		Cash:        "Cash",
+		Account:     "Bank transfer",
+		Anonymous:   "Individual",
+		CancelReason: map[CancelComment]string{
+			CancelCommentMistake: "Issued by mistake",
+			CancelCommentRefund:  "Refund",
+		},
+	},
+}
+
+const receiptHTMLTemplate = `<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family:sans-serif">
+{{- if .Cancelled}}
+<p style="padding:8px;background:#fdecea;color:#b71c1c"><strong>{{.Labels.Cancelled}}</strong>{{if .CancelReason}}. {{.Labels.Reason}}: {{.CancelReason}}{{end}}</p>
+{{- end}}
+<h1>{{.Labels.Title}} {{.ReceiptID}}</h1>
+<p>{{.Labels.Date}}: {{.OperationTime}}</p>
+<p>{{.Labels.Seller}}: {{.SellerName}}{{if .SellerInn}}, {{.Labels.Inn}} {{.SellerInn}}{{end}}</p>
+<p>{{.Labels.Buyer}}: {{.BuyerName}}{{if .BuyerInn}}, {{.Labels.Inn}} {{.BuyerInn}}{{end}}</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>{{.Labels.Service}}</th><th>{{.Labels.Quantity}}</th><th>{{.Labels.Price}}</th><th>{{.Labels.Amount}}</th></tr>
+{{- range .Lines}}
+<tr><td>{{.Name}}</td><td>{{.Quantity}}</td><td>{{.Price}}</td><td>{{.Amount}}</td></tr>
+{{- end}}
+<tr><th colspan="3">{{.Labels.Total}}</th><th>{{.Total}}</th></tr>
+</table>
+<p>{{.Labels.PaymentType}}: {{.PaymentType}}</p>
+{{- if .Link}}
+<p><a href="{{.Link}}">{{.Labels.Link}}</a></p>
+{{- if .QRCode}}
+<p><img src="{{.QRCode}}" alt="{{.Labels.Link}}" width="160" height="160"></p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`
+
+const receiptTextTemplate = `{{if .Cancelled}}*** {{.Labels.Cancelled}}{{if .CancelReason}}. {{.Labels.Reason}}: {{.CancelReason}}{{end}} ***
+
+{{end}}{{.Labels.Title}} {{.ReceiptID}}
+{{.Labels.Date}}: {{.OperationTime}}
+{{.Labels.Seller}}: {{.SellerName}}{{if .SellerInn}}, {{.Labels.Inn}} {{.SellerInn}}{{end}}
+{{.Labels.Buyer}}: {{.BuyerName}}{{if .BuyerInn}}, {{.Labels.Inn}} {{.BuyerInn}}{{end}}
+
+{{range .Lines}}{{.Name}}: {{.Quantity}} x {{.Price}} = {{.Amount}}
+{{end}}
+{{.Labels.Total}}: {{.Total}}
+{{.Labels.PaymentType}}: {{.PaymentType}}
+{{if .Link}}{{.Labels.Link}}: {{.Link}}
+{{end}}`
+
+// receiptView is the data both receipt templates are executed against.
+type receiptView struct {
+	Locale        ReceiptLocale
+	Labels        receiptLabels
+	Subject       string
+	ReceiptID     string
+	OperationTime string
+	SellerName    string
+	SellerInn     string
+	BuyerName     string
+	BuyerInn      string
+	Lines         []receiptViewLine
+	Total         string
+	PaymentType   string
+	Cancelled     bool
+	CancelReason  string
+	Link          string
+	QRCode        htmltemplate.URL
+}
+
+type receiptViewLine struct {
+	Name     string
+	Quantity string
+	Price    string
+	Amount   string
+}
+
+// ReceiptMessage is a rendered receipt ready to be delivered to the buyer.
+type ReceiptMessage struct {
+	// ReceiptID identifies the rendered receipt.
+	ReceiptID string
+	// Email and Phone are the buyer contacts recorded on the receipt, if any.
+	Email string
+	Phone string
+	// Subject is a one line summary suitable for an email subject.
+	Subject string
+	// HTML and Text are the two renditions of the receipt.
+	HTML string
+	Text string
+	// QRCode is the PNG image of the QR code of the receipt link, embedded in
+	// HTML, when the renderer has a QRCodeEncoder and a link was given.
+	QRCode []byte
+}
+
+// ReceiptSender delivers rendered receipts. Implement it on top of SMTP, an SMS
+// gateway or any other channel; the library itself never sends anything.
+type ReceiptSender interface {
+	// SendReceipt delivers message to the buyer.
+	SendReceipt(ctx context.Context, message *ReceiptMessage) error
+}
+
+// ReceiptSenderFunc adapts a plain function to ReceiptSender.
+type ReceiptSenderFunc func(ctx context.Context, message *ReceiptMessage) error
+
+// SendReceipt implements ReceiptSender.
+func (f ReceiptSenderFunc) SendReceipt(ctx context.Context, message *ReceiptMessage) error {
+	return f(ctx, message)
+}
+
+// QRCodeEncoder encodes content as the PNG image of a QR code. Plug any QR
+// library in; the library itself does not ship an encoder.
+type QRCodeEncoder func(content string) ([]byte, error)
+
+// ReceiptRenderer renders a Receipt as an HTML and a plain text message. It is
+// safe for concurrent use.
+type ReceiptRenderer struct {
+	locale     ReceiptLocale
+	sellerName string
+	qrCode     QRCodeEncoder
+	html       *htmltemplate.Template
+	text       *texttemplate.Template
+}
+
+// RendererOption customises a ReceiptRenderer.
+type RendererOption func(*ReceiptRenderer)
+
+// WithReceiptLocale sets the language of the rendered receipt, which defaults
+// to ReceiptLocaleRU. Unknown locales are ignored.
+func WithReceiptLocale(locale ReceiptLocale) RendererOption {
+	return func(r *ReceiptRenderer) {
+		if locale.Valid() {
+			r.locale = locale
+		}
+	}
+}
+
+// WithReceiptSellerName sets the seller name printed on the receipt. The
+// receipt payload carries only the seller INN.
+func WithReceiptSellerName(name string) RendererOption {
+	return func(r *ReceiptRenderer) {
+		r.sellerName = name
+	}
+}
+
+// WithReceiptQRCode makes the renderer embed the QR code of the receipt link,
+// drawn by encode, in the HTML receipt.
+func WithReceiptQRCode(encode QRCodeEncoder) RendererOption {
+	return func(r *ReceiptRenderer) {
+		r.qrCode = encode
+	}
+}
+
+// NewReceiptRenderer returns a renderer using the built-in templates.
+func NewReceiptRenderer(opts ...RendererOption) *ReceiptRenderer {
+	r := &ReceiptRenderer{
+		locale: ReceiptLocaleRU,
+		html:   htmltemplate.Must(htmltemplate.New("receipt.html").Parse(receiptHTMLTemplate)),
+		text:   texttemplate.Must(texttemplate.New("receipt.txt").Parse(receiptTextTemplate)),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Render renders receipt. link is the address the buyer can verify the
+// receipt at, usually Receipt.PublicURL; pass an empty string to leave it and
+// the QR code out.
+func (r *ReceiptRenderer) Render(receipt *Receipt, link string) (*ReceiptMessage, error) {
+	if receipt == nil {
+		return nil, invalidArgument("moynalog: receipt cannot be nil")
+	}
+
+	view := r.view(receipt, link)
+
+	var qrCode []byte
+	if link != "" && r.qrCode != nil {
+		var err error
+		if qrCode, err = r.qrCode(link); err != nil {
+			return nil, errors.Wrap(err, "moynalog: cannot encode receipt QR code")
+		}
+		//nolint:gosec // G203: a base64 data URI of an image we encoded ourselves.
+		view.QRCode = htmltemplate.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode))
+	}
+
+	var html, text bytes.Buffer
+	if err := r.html.Execute(&html, view); err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot render receipt HTML")
+	}
+	if err := r.text.Execute(&text, view); err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot render receipt text")
+	}
+
+	return &ReceiptMessage{
+		ReceiptID: receipt.ReceiptID,
+		Email:     receipt.Email,
+		Phone:     receipt.Phone,
+		Subject:   view.Subject,
+		HTML:      html.String(),
+		Text:      text.String(),
+		QRCode:    qrCode,
+	}, nil
+}
+
+func (r *ReceiptRenderer) view(receipt *Receipt, link string) *receiptView {
+	labels := receiptLabelsByLocale[r.locale]
+
+	view := &receiptView{
+		Locale:        r.locale,
+		Labels:        labels,
+		Subject:       labels.Subject + receipt.ReceiptID,
+		ReceiptID:     receipt.ReceiptID,
+		OperationTime: receipt.OperationTime.Format(receiptDateLayout),
+		SellerName:    r.sellerName,
+		SellerInn:     receipt.Inn,
+		BuyerName:     receipt.ClientDisplayName,
+		BuyerInn:      receipt.ClientInn,
+		Total:         r.formatAmount(receipt.TotalAmount),
+		Cancelled:     receipt.Cancelled(),
+		Link:          link,
+	}
+	if view.BuyerName == "" {
+		view.BuyerName = labels.Anonymous
+	}
+
+	switch receipt.PaymentType {
+	case PaymentTypeCash:
+		view.PaymentType = labels.Cash
+	case PaymentTypeAccount:
+		view.PaymentType = labels.Account
+	default:
+		view.PaymentType = string(receipt.PaymentType)
+	}
+
+	if receipt.CancellationInfo != nil {
+		view.CancelReason = labels.CancelReason[receipt.CancellationInfo.Comment]
+		if view.CancelReason == "" {
+			view.CancelReason = string(receipt.CancellationInfo.Comment)
+		}
+	}
+
+	for _, item := range receipt.Services {
+		if item == nil {
+			continue
+		}
+		view.Lines = append(view.Lines, receiptViewLine{
+			Name:     item.Name,
+			Quantity: item.Quantity.String(),
+			Price:    r.formatAmount(item.Amount),
+			Amount:   r.formatAmount(item.Amount.Mul(item.Quantity)),
+		})
+	}
+
+	return view
+}
+
+// formatAmount prints a ruble amount with kopecks, using the decimal separator
+// of the locale.
+func (r *ReceiptRenderer) formatAmount(amount decimal.Decimal) string {
+	formatted := amount.StringFixed(2)
+	if r.locale == ReceiptLocaleRU {
+		return strings.Replace(formatted, ".", ",", 1) + " ₽"
+	}
+
+	return formatted + " RUB"
+}
+
+// Send fetches the receipt identified by receiptUUID, renders it with renderer
+// and hands the result to sender. The rendered receipt links to its public
+// address on lknpd.nalog.ru, see ReceiptPublicURL.
+func (s *ReceiptService) Send(ctx context.Context, receiptUUID string, renderer *ReceiptRenderer, sender ReceiptSender) (*Response, error) {
+	if renderer == nil || sender == nil {
+		return nil, errors.New("moynalog: receipt renderer and sender cannot be nil")
+	}
+
+	receipt, resp, err := s.JSON(ctx, receiptUUID)
+	if err != nil {
+		return resp, err
+	}
+
+	inn := receipt.Inn
+	if inn == "" {
+		if inn, err = s.inn(ctx); err != nil {
+			return resp, err
+		}
+	}
+	link := ReceiptPublicURL(inn, receiptUUID)
+
+	message, err := renderer.Render(receipt, link)
+	if err != nil {
+		return resp, err
+	}
+
+	if err := sender.SendReceipt(ctx, message); err != nil {
+		return resp, errors.Wrap(err, "moynalog: cannot send receipt")
+	}
+
+	return resp, nil
+}
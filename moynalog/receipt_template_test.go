@@ -0,0 +1,182 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+func testReceipt() *Receipt {
+	return &Receipt{
+		ReceiptID: "20dkx5w2wt",
+		Services: []*ServiceItem{
+			{Name: "Консультация <b>", Quantity: decimal.NewFromInt(2), Amount: decimal.NewFromFloat(1500.5)},
+		},
+		OperationTime:     NewTime(time.Date(2024, 9, 1, 12, 30, 0, 0, time.UTC)),
+		PaymentType:       PaymentTypeAccount,
+		TotalAmount:       decimal.NewFromInt(3001),
+		Inn:               "770000000000",
+		ClientInn:         "7707083893",
+		ClientDisplayName: "ООО Ромашка",
+		Email:             "buyer@example.com",
+	}
+}
+
+func TestReceiptRendererRender(t *testing.T) {
+	t.Parallel()
+
+	renderer := NewReceiptRenderer(WithReceiptSellerName("Пупкин В.В."))
+	message, err := renderer.Render(testReceipt(), "https://lknpd.nalog.ru/api/v1/receipt/770000000000/20dkx5w2wt/print")
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	if message.Subject != "Чек №20dkx5w2wt" {
+		t.Errorf("Subject = %q, want %q", message.Subject, "Чек №20dkx5w2wt")
+	}
+	if message.Email != "buyer@example.com" {
+		t.Errorf("Email = %q, want %q", message.Email, "buyer@example.com")
+	}
+
+	for _, want := range []string{"Пупкин В.В.", "ИНН 770000000000", "ООО Ромашка", "3001,00 ₽", "Безналичный расчёт", "01.09.2024 12:30", "/20dkx5w2wt/print"} {
+		if !strings.Contains(message.HTML, want) {
+			t.Errorf("HTML does not contain %q", want)
+		}
+		if !strings.Contains(message.Text, want) {
+			t.Errorf("Text does not contain %q", want)
+		}
+	}
+
+	// Service names come from the API and must be escaped in HTML only.
+	if strings.Contains(message.HTML, "<b>") {
+		t.Error("HTML must escape service names")
+	}
+	if !strings.Contains(message.Text, "Консультация <b>: 2 x 1500,50 ₽ = 3001,00 ₽") {
+		t.Errorf("Text line is missing or malformed:\n%s", message.Text)
+	}
+	if strings.Contains(message.HTML, "аннулирован") {
+		t.Error("an active receipt must not carry the cancellation banner")
+	}
+}
+
+func TestReceiptRendererCancelledEnglish(t *testing.T) {
+	t.Parallel()
+
+	receipt := testReceipt()
+	receipt.ClientDisplayName = ""
+	receipt.ClientInn = ""
+	receipt.CancellationInfo = &CancellationInfo{Comment: CancelCommentRefund}
+
+	message, err := NewReceiptRenderer(WithReceiptLocale(ReceiptLocaleEN)).Render(receipt, "")
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	for _, want := range []string{"This receipt has been cancelled", "Reason: Refund", "Individual", "3001.00 RUB"} {
+		if !strings.Contains(message.HTML, want) {
+			t.Errorf("HTML does not contain %q", want)
+		}
+		if !strings.Contains(message.Text, want) {
+			t.Errorf("Text does not contain %q", want)
+		}
+	}
+	if strings.Contains(message.Text, "Verify receipt") {
+		t.Error("an empty link must be left out")
+	}
+}
+
+func TestReceiptRendererNil(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewReceiptRenderer().Render(nil, ""); err == nil {
+		t.Error("want an error for a nil receipt")
+	}
+}
+
+func TestReceiptSend(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/receipt/770000000000/20dkx5w2wt/json", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{"receiptId":"20dkx5w2wt","totalAmount":10,"email":"buyer@example.com"}`)
+	})
+
+	var sent *ReceiptMessage
+	sender := ReceiptSenderFunc(func(_ context.Context, message *ReceiptMessage) error {
+		sent = message
+
+		return nil
+	})
+
+	if _, err := client.Receipt.Send(context.Background(), "20dkx5w2wt", NewReceiptRenderer(), sender); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if sent == nil {
+		t.Fatal("sender was not called")
+	}
+	if sent.Email != "buyer@example.com" {
+		t.Errorf("Email = %q, want %q", sent.Email, "buyer@example.com")
+	}
+	if want := "https://lknpd.nalog.ru/api/v1/receipt/770000000000/20dkx5w2wt/print"; !strings.Contains(sent.Text, want) {
+		t.Errorf("Text does not link to the public receipt %s:\n%s", want, sent.Text)
+	}
+}
+
+func TestReceiptRendererQRCode(t *testing.T) {
+	t.Parallel()
+
+	var encoded string
+	renderer := NewReceiptRenderer(WithReceiptQRCode(func(content string) ([]byte, error) {
+		encoded = content
+
+		return []byte("png"), nil
+	}))
+
+	receipt := testReceipt()
+	message, err := renderer.Render(receipt, receipt.PublicURL())
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if encoded != "https://lknpd.nalog.ru/api/v1/receipt/770000000000/20dkx5w2wt/print" {
+		t.Errorf("QR code content = %q, want the public receipt URL", encoded)
+	}
+	if string(message.QRCode) != "png" {
+		t.Errorf("QRCode = %q, want the encoded image", message.QRCode)
+	}
+	if !strings.Contains(message.HTML, `<img src="data:image/png;base64,cG5n"`) {
+		t.Errorf("HTML does not embed the QR code:\n%s", message.HTML)
+	}
+
+	if message, _ := renderer.Render(receipt, ""); message.QRCode != nil || strings.Contains(message.HTML, "<img") {
+		t.Error("an empty link must leave the QR code out")
+	}
+
+	failing := NewReceiptRenderer(WithReceiptQRCode(func(string) ([]byte, error) {
+		return nil, errors.New("too long")
+	}))
+	if _, err := failing.Render(receipt, receipt.PublicURL()); err == nil {
+		t.Error("want the encoder error")
+	}
+}
+
+func TestReceiptSendSenderError(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/receipt/770000000000/uuid/json", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{"receiptId":"uuid"}`)
+	})
+
+	errSMTP := errors.New("smtp is down")
+	sender := ReceiptSenderFunc(func(context.Context, *ReceiptMessage) error { return errSMTP })
+
+	_, err := client.Receipt.Send(context.Background(), "uuid", NewReceiptRenderer(), sender)
+	if !errors.Is(err, errSMTP) {
+		t.Errorf("err = %v, want it to wrap the sender error", err)
+	}
+}
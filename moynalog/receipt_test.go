@@ -142,5 +142,5 @@ func TestReceiptRequiresProfileINN(t *testing.T) {
 	})
 
 	_, _, err := client.Receipt.JSON(context.Background(), "uuid")
-	assertLocalError(t, err)
+	assertNotSent(t, err)
 }
@@ -0,0 +1,164 @@
+package moynalog
+
+import (
+	"context"
+
+	"github.com/shopspring/decimal"
+)
+
+// amountPlaces is the precision, in decimal places, of receipt amounts.
+const amountPlaces = 2
+
+// IncomeRefund is the outcome of a refund.
+type IncomeRefund struct {
+	// CancelledReceiptUUID is the original receipt, cancelled with
+	// CancelCommentRefund.
+	CancelledReceiptUUID string
+	// RemainderReceiptUUID is the receipt registered for the amount that was
+	// not refunded. Empty for a full refund.
+	RemainderReceiptUUID string
+}
+
+// Refund refunds refundedAmount of a registered receipt. The API cannot
+// cancel a receipt partially, so a partial refund cancels the receipt and
+// registers the remainder as a new one, with the same client, payment type
+// and operation time and with every line scaled down proportionally.
+//
+// The remainder is registered before the original is cancelled, and taken
+// back should the cancellation fail (see Reissue). The link between the two
+// receipts is recorded with the client's ReceiptLinkRecorder.
+//
+// The returned Response is the one of the last request made.
+func (s *IncomeService) Refund(ctx context.Context, receiptUUID string, refundedAmount decimal.Decimal) (*IncomeRefund, *Response, error) {
+	if receiptUUID == "" {
+		return nil, nil, invalidArgument("moynalog: receipt UUID cannot be empty")
+	}
+	if refundedAmount.LessThanOrEqual(decimal.Zero) {
+		return nil, nil, invalidArgument("moynalog: refunded amount must be greater than 0")
+	}
+	if !refundedAmount.Equal(refundedAmount.Round(amountPlaces)) {
+		return nil, nil, invalidArgument("moynalog: refunded amount %s has more than %d decimal places", refundedAmount, amountPlaces)
+	}
+
+	receipt, resp, err := s.client.Receipt.JSON(ctx, receiptUUID)
+	if err != nil {
+		return nil, resp, err
+	}
+	if receipt.Cancelled() {
+		return nil, resp, invalidArgument("moynalog: receipt %s is already cancelled", receiptUUID)
+	}
+
+	total := receiptTotal(receipt)
+	if refundedAmount.GreaterThan(total) {
+		return nil, resp, invalidArgument("moynalog: refunded amount %s exceeds the receipt total %s", refundedAmount, total)
+	}
+
+	var remainder *IncomeCreateRequest
+	if amount := total.Sub(refundedAmount); amount.IsPositive() {
+		remainder = receipt.IncomeCreateRequest()
+		remainder.Services = scaleServices(receipt.Services, total, amount)
+	}
+
+	remainderUUID, resp, err := s.replace(ctx, receiptUUID, remainder, CancelCommentRefund)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	refund := &IncomeRefund{CancelledReceiptUUID: receiptUUID, RemainderReceiptUUID: remainderUUID}
+	if remainderUUID != "" {
+		if _, err := s.recordLink(ctx, receiptUUID, remainderUUID, CancelCommentRefund); err != nil {
+			return refund, resp, err
+		}
+	}
+
+	return refund, resp, nil
+}
+
+// receiptTotal returns the total of receipt, summing its lines when the API
+// left the total out.
+func receiptTotal(receipt *Receipt) decimal.Decimal {
+	if receipt.TotalAmount.IsPositive() {
+		return receipt.TotalAmount
+	}
+
+	total := decimal.Zero
+	for _, item := range receipt.Services {
+		if item != nil {
+			total = total.Add(item.Amount.Mul(item.Quantity))
+		}
+	}
+
+	return total
+}
+
+// scaleServices scales the lines of a receipt totalling total so they add up
+// to remainder. Unit prices are rounded to kopecks, and a line whose total
+// still has fractions of a kopeck, with a fractional quantity, is billed as a
+// single unit of its rounded total. The rounding difference is absorbed from
+// the last line backwards; lines rounding down to nothing, or left with
+// nothing once the difference is absorbed, are dropped.
+func scaleServices(items []*ServiceItem, total, remainder decimal.Decimal) []IncomeServiceItem {
+	factor := remainder.Div(total)
+
+	scaled := make([]IncomeServiceItem, 0, len(items))
+	sum := decimal.Zero
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+
+		line := IncomeServiceItem{Name: item.Name, Amount: item.Amount.Mul(factor).Round(amountPlaces), Quantity: item.Quantity}
+		if !line.Quantity.IsPositive() {
+			line.Quantity = decimal.NewFromInt(1)
+		}
+		if lineTotal := line.TotalAmount(); !lineTotal.Equal(lineTotal.Round(amountPlaces)) {
+			line.Amount, line.Quantity = lineTotal.Round(amountPlaces), decimal.NewFromInt(1)
+		}
+		if !line.Amount.IsPositive() {
+			continue
+		}
+
+		scaled = append(scaled, line)
+		sum = sum.Add(line.TotalAmount())
+	}
+
+	if len(scaled) == 0 {
+		name := "Оплата"
+		for _, item := range items {
+			if item != nil {
+				name = item.Name
+
+				break
+			}
+		}
+
+		return []IncomeServiceItem{{Name: name, Amount: remainder, Quantity: decimal.NewFromInt(1)}}
+	}
+
+	// Rounding up can overshoot by more than the last line is worth, so a
+	// line the difference would zero is dropped and the rest carried over to
+	// the one before. The first line always survives, remainder being positive.
+	diff := remainder.Sub(sum)
+	for !diff.IsZero() {
+		last := &scaled[len(scaled)-1]
+		lineTotal := last.TotalAmount().Add(diff)
+		if !lineTotal.IsPositive() {
+			scaled = scaled[:len(scaled)-1]
+			diff = lineTotal
+
+			continue
+		}
+
+		// Keep the quantity when the corrected total still divides into whole
+		// kopecks, otherwise bill the line as a single unit.
+		unit := lineTotal.DivRound(last.Quantity, amountPlaces)
+		if unit.Mul(last.Quantity).Equal(lineTotal) {
+			last.Amount = unit
+		} else {
+			last.Amount, last.Quantity = lineTotal, decimal.NewFromInt(1)
+		}
+		diff = decimal.Zero
+	}
+
+	return scaled
+}
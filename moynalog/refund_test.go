@@ -0,0 +1,293 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+const refundReceiptJSON = `{
+	"receiptId": "orig",
+	"services": [
+		{"name": "Консультация", "quantity": 1, "serviceNumber": 0, "amount": 1000},
+		{"name": "Доставка", "quantity": 3, "serviceNumber": 1, "amount": 333.33}
+	],
+	"operationTime": "2024-09-01T12:00:00+03:00",
+	"paymentType": "ACCOUNT",
+	"incomeType": "FROM_LEGAL_ENTITY",
+	"totalAmount": 1999.99,
+	"cancellationInfo": null,
+	"clientInn": "7707083893",
+	"clientDisplayName": "ООО Ромашка"
+}`
+
+// refundServer serves refundReceiptJSON and records the calls made, failing
+// the cancellation of the receipts listed in failCancel.
+type refundServer struct {
+	mu      sync.Mutex
+	calls   []string
+	created map[string]any
+}
+
+func newRefundServer(t *testing.T, failCancel ...string) (*Client, *refundServer) {
+	t.Helper()
+
+	client, mux := setupAuthed(t)
+	srv := new(refundServer)
+
+	mux.HandleFunc("/v1/receipt/770000000000/orig/json", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, refundReceiptJSON)
+	})
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, r *http.Request) {
+		srv.record("create")
+		srv.mu.Lock()
+		srv.created = testBody(t, r)
+		srv.mu.Unlock()
+		writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"rest"}`)
+	})
+	mux.HandleFunc("/v1/cancel", func(w http.ResponseWriter, r *http.Request) {
+		body := testBody(t, r)
+		uuid, _ := body["receiptUuid"].(string)
+		srv.record("cancel " + uuid + " " + body["comment"].(string))
+
+		for _, failed := range failCancel {
+			if uuid == failed {
+				writeJSON(t, w, http.StatusInternalServerError, `{"message":"boom"}`)
+
+				return
+			}
+		}
+		writeJSON(t, w, http.StatusOK, `{"incomeInfo":{"approvedReceiptUuid":"`+uuid+`"}}`)
+	})
+
+	return client, srv
+}
+
+func (s *refundServer) record(call string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, call)
+}
+
+func TestIncomeRefundPartial(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t)
+	recorder := new(MemoryReceiptLinkRecorder)
+	client.linkRecorder = recorder
+
+	refund, _, err := client.Income.Refund(context.Background(), "orig", decimal.NewFromInt(500))
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if refund.CancelledReceiptUUID != "orig" || refund.RemainderReceiptUUID != "rest" {
+		t.Errorf("Refund = %+v, want orig cancelled and rest registered", refund)
+	}
+
+	want := []string{"create", "cancel orig " + string(CancelCommentRefund)}
+	if strings.Join(srv.calls, "|") != strings.Join(want, "|") {
+		t.Errorf("calls = %q, want %q", srv.calls, want)
+	}
+
+	body := srv.created
+	if body["totalAmount"] != "1499.99" {
+		t.Errorf("totalAmount = %v, want 1499.99", body["totalAmount"])
+	}
+	if body["paymentType"] != string(PaymentTypeAccount) || body["operationTime"] != "2024-09-01T12:00:00+03:00" {
+		t.Errorf("paymentType = %v, operationTime = %v, want those of the original", body["paymentType"], body["operationTime"])
+	}
+	buyer, _ := body["client"].(map[string]any)
+	if buyer["inn"] != "7707083893" || buyer["incomeType"] != string(IncomeTypeLegalEntity) {
+		t.Errorf("client = %v, want the original client", buyer)
+	}
+
+	if links := recorder.Links(); len(links) != 1 || links[0].Reason != CancelCommentRefund {
+		t.Errorf("recorded links = %+v, want the remainder linked as a refund", links)
+	}
+}
+
+func TestScaleServices(t *testing.T) {
+	t.Parallel()
+
+	items := []*ServiceItem{
+		{Name: "Консультация", Quantity: decimal.NewFromInt(1), Amount: decimal.NewFromInt(1000)},
+		{Name: "Доставка", Quantity: decimal.NewFromInt(3), Amount: decimal.RequireFromString("333.33")},
+	}
+
+	tests := []struct {
+		name      string
+		remainder string
+		want      []IncomeServiceItem
+	}{
+		{
+			name:      "exact split",
+			remainder: "1000.02",
+			want: []IncomeServiceItem{
+				{Name: "Консультация", Amount: decimal.RequireFromString("500.01"), Quantity: decimal.NewFromInt(1)},
+				{Name: "Доставка", Amount: decimal.RequireFromString("166.67"), Quantity: decimal.NewFromInt(3)},
+			},
+		},
+		{
+			// 750.00 + 3 × 250.00 overshoots by a kopeck, which the last line
+			// cannot absorb per unit.
+			name:      "kopeck rounding",
+			remainder: "1499.99",
+			want: []IncomeServiceItem{
+				{Name: "Консультация", Amount: decimal.NewFromInt(750), Quantity: decimal.NewFromInt(1)},
+				{Name: "Доставка", Amount: decimal.RequireFromString("749.99"), Quantity: decimal.NewFromInt(1)},
+			},
+		},
+		{
+			name:      "lines rounding to nothing",
+			remainder: "0.01",
+			want: []IncomeServiceItem{
+				{Name: "Консультация", Amount: decimal.RequireFromString("0.01"), Quantity: decimal.NewFromInt(1)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			remainder := decimal.RequireFromString(tt.remainder)
+			got := scaleServices(items, decimal.RequireFromString("1999.99"), remainder)
+
+			total := decimal.Zero
+			for _, line := range got {
+				total = total.Add(line.TotalAmount())
+			}
+			if !total.Equal(remainder) {
+				t.Errorf("lines total %s, want %s", total, remainder)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i].Name != tt.want[i].Name || !got[i].Quantity.Equal(tt.want[i].Quantity) ||
+					!got[i].Amount.Equal(tt.want[i].Amount) {
+					t.Errorf("line %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// Two 1.00 lines refunded down to a kopeck each round up to 0.01; the
+// overshoot would zero the last line, which must be dropped instead.
+func TestScaleServicesDropsZeroedLines(t *testing.T) {
+	t.Parallel()
+
+	items := []*ServiceItem{
+		{Name: "Первая", Quantity: decimal.NewFromInt(1), Amount: decimal.NewFromInt(1)},
+		{Name: "Вторая", Quantity: decimal.NewFromInt(1), Amount: decimal.NewFromInt(1)},
+	}
+
+	got := scaleServices(items, decimal.NewFromInt(2), decimal.RequireFromString("0.01"))
+	if len(got) != 1 || got[0].Name != "Первая" || !got[0].TotalAmount().Equal(decimal.RequireFromString("0.01")) {
+		t.Errorf("scaled = %+v, want the first line alone at 0.01", got)
+	}
+	for _, line := range got {
+		if !line.Amount.IsPositive() {
+			t.Errorf("line %+v is not positive", line)
+		}
+	}
+}
+
+// 8.01 × 1.5 is 12.015: a line with a fractional quantity must not carry
+// fractions of a kopeck into the sum or the request.
+func TestScaleServicesFractionalQuantity(t *testing.T) {
+	t.Parallel()
+
+	items := []*ServiceItem{
+		{Name: "Развес", Quantity: decimal.RequireFromString("1.5"), Amount: decimal.RequireFromString("10.01")},
+		{Name: "Доставка", Quantity: decimal.NewFromInt(1), Amount: decimal.NewFromInt(10)},
+	}
+
+	remainder := decimal.RequireFromString("20.01")
+	got := scaleServices(items, decimal.RequireFromString("25.02"), remainder)
+
+	total := decimal.Zero
+	for _, line := range got {
+		lineTotal := line.TotalAmount()
+		if !line.Amount.Equal(line.Amount.Round(amountPlaces)) || !lineTotal.Equal(lineTotal.Round(amountPlaces)) {
+			t.Errorf("line %+v has fractions of a kopeck", line)
+		}
+		total = total.Add(lineTotal)
+	}
+	if !total.Equal(remainder) {
+		t.Errorf("lines total %s, want %s", total, remainder)
+	}
+	if len(got) != 2 || !got[0].Amount.Equal(decimal.RequireFromString("12.02")) || !got[0].Quantity.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("scaled = %+v, want the fractional line billed as one unit of 12.02", got)
+	}
+}
+
+func TestIncomeRefundFull(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t)
+
+	refund, _, err := client.Income.Refund(context.Background(), "orig", decimal.RequireFromString("1999.99"))
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if refund.RemainderReceiptUUID != "" {
+		t.Errorf("RemainderReceiptUUID = %q, want none for a full refund", refund.RemainderReceiptUUID)
+	}
+	if len(srv.calls) != 1 || srv.calls[0] != "cancel orig "+string(CancelCommentRefund) {
+		t.Errorf("calls = %q, want the original cancelled only", srv.calls)
+	}
+}
+
+// A failed cancellation of the original must take the remainder back.
+func TestIncomeRefundCompensates(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t, "orig")
+
+	if _, _, err := client.Income.Refund(context.Background(), "orig", decimal.NewFromInt(500)); err == nil {
+		t.Fatal("want an error when the original cannot be cancelled")
+	}
+
+	want := []string{"create", "cancel orig " + string(CancelCommentRefund), "cancel rest " + string(CancelCommentMistake)}
+	if strings.Join(srv.calls, "|") != strings.Join(want, "|") {
+		t.Errorf("calls = %q, want %q", srv.calls, want)
+	}
+}
+
+func TestIncomeRefundCompensationFails(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newRefundServer(t, "orig", "rest")
+
+	_, _, err := client.Income.Refund(context.Background(), "orig", decimal.NewFromInt(500))
+	if err == nil || !strings.Contains(err.Error(), "rest is left registered") {
+		t.Errorf("err = %v, want it to name the stray remainder receipt", err)
+	}
+}
+
+func TestIncomeRefundValidation(t *testing.T) {
+	t.Parallel()
+
+	client := setupNoRequest(t)
+	for _, amount := range []string{"0", "-1", "10.005"} {
+		_, _, err := client.Income.Refund(context.Background(), "orig", decimal.RequireFromString(amount))
+		assertLocalError(t, err)
+	}
+	_, _, err := client.Income.Refund(context.Background(), "", decimal.NewFromInt(1))
+	assertLocalError(t, err)
+
+	client, srv := newRefundServer(t)
+	_, _, err = client.Income.Refund(context.Background(), "orig", decimal.NewFromInt(2000))
+	assertLocalError(t, err)
+	if len(srv.calls) != 0 {
+		t.Errorf("calls = %q, want none for an amount over the total", srv.calls)
+	}
+}
@@ -0,0 +1,174 @@
+package moynalog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReceiptLink records that a receipt was cancelled and replaced by another.
+type ReceiptLink struct {
+	// OriginalReceiptUUID is the cancelled receipt.
+	OriginalReceiptUUID string `json:"originalReceiptUuid"`
+	// ReissuedReceiptUUID is the receipt registered in its place.
+	ReissuedReceiptUUID string `json:"reissuedReceiptUuid"`
+	// Reason is the comment the original was cancelled with:
+	// CancelCommentMistake for a correction, CancelCommentRefund for the
+	// remainder of a partial refund.
+	Reason CancelComment `json:"reason"`
+	// LinkedAt is when the replacement completed.
+	LinkedAt time.Time `json:"linkedAt"`
+}
+
+// ReceiptLinkRecorder keeps the links between cancelled receipts and their
+// replacements, which the API does not. Implementations must be safe for
+// concurrent use.
+type ReceiptLinkRecorder interface {
+	RecordReceiptLink(ctx context.Context, link *ReceiptLink) error
+}
+
+// MemoryReceiptLinkRecorder keeps receipt links in memory. The zero value is
+// ready to use.
+type MemoryReceiptLinkRecorder struct {
+	mu    sync.Mutex
+	links []ReceiptLink
+}
+
+// RecordReceiptLink implements ReceiptLinkRecorder.
+func (r *MemoryReceiptLinkRecorder) RecordReceiptLink(_ context.Context, link *ReceiptLink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.links = append(r.links, *link)
+
+	return nil
+}
+
+// Links returns the recorded links, oldest first.
+func (r *MemoryReceiptLinkRecorder) Links() []ReceiptLink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	links := make([]ReceiptLink, len(r.links))
+	copy(links, r.links)
+
+	return links
+}
+
+// Successor returns the receipt that finally replaced receiptUUID, following
+// the chain of links. It returns receiptUUID itself when it was never replaced.
+func (r *MemoryReceiptLinkRecorder) Successor(receiptUUID string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for seen := 0; seen <= len(r.links); seen++ {
+		next := ""
+		for _, link := range r.links {
+			if link.OriginalReceiptUUID == receiptUUID {
+				next = link.ReissuedReceiptUUID
+			}
+		}
+		if next == "" {
+			break
+		}
+		receiptUUID = next
+	}
+
+	return receiptUUID
+}
+
+// Reissue corrects a registered receipt: it rebuilds the request that would
+// register it again, lets mutate fix it (a typo in a line, the wrong client),
+// registers the result and cancels the original with CancelCommentMistake.
+// The new receipt keeps the original OperationTime whatever mutate does, so
+// it lands in the same tax period.
+//
+// The new receipt is registered before the original is cancelled: a receipt
+// can be cancelled again if the second step fails, a cancellation cannot be
+// undone. Should the cancellation fail, the new receipt is cancelled with
+// CancelCommentMistake and the error is returned. On success the link is
+// recorded with the client's ReceiptLinkRecorder, if any.
+//
+// The returned Response is the one of the last request made.
+func (s *IncomeService) Reissue(ctx context.Context, receiptUUID string, mutate func(*IncomeCreateRequest)) (*ReceiptLink, *Response, error) {
+	if receiptUUID == "" {
+		return nil, nil, invalidArgument("moynalog: receipt UUID cannot be empty")
+	}
+	if mutate == nil {
+		return nil, nil, invalidArgument("moynalog: reissue mutate func cannot be nil")
+	}
+
+	receipt, resp, err := s.client.Receipt.JSON(ctx, receiptUUID)
+	if err != nil {
+		return nil, resp, err
+	}
+	if receipt.Cancelled() {
+		return nil, resp, invalidArgument("moynalog: receipt %s is already cancelled", receiptUUID)
+	}
+
+	income := receipt.IncomeCreateRequest()
+	mutate(income)
+	income.OperationTime = receipt.OperationTime.Time
+	if err := validateIncomeCreate(income); err != nil {
+		return nil, resp, err
+	}
+
+	reissuedUUID, resp, err := s.replace(ctx, receiptUUID, income, CancelCommentMistake)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	link, err := s.recordLink(ctx, receiptUUID, reissuedUUID, CancelCommentMistake)
+
+	return link, resp, err
+}
+
+// replace registers income, when given, then cancels receiptUUID with comment,
+// cancelling the new receipt again should that fail. It returns the UUID of
+// the new receipt.
+func (s *IncomeService) replace(ctx context.Context, receiptUUID string, income *IncomeCreateRequest, comment CancelComment) (string, *Response, error) {
+	newUUID := ""
+	if income != nil {
+		created, resp, err := s.Create(ctx, income)
+		if err != nil {
+			return "", resp, errors.Wrap(err, "moynalog: cannot register the replacement receipt")
+		}
+		newUUID = created.ApprovedReceiptUUID
+	}
+
+	_, resp, err := s.Cancel(ctx, &IncomeCancelRequest{ReceiptUUID: receiptUUID, Comment: comment})
+	if err == nil {
+		return newUUID, resp, nil
+	}
+
+	err = errors.Wrapf(err, "moynalog: cannot cancel receipt %s", receiptUUID)
+	if newUUID == "" {
+		return "", resp, err
+	}
+	if _, _, compErr := s.Cancel(ctx, &IncomeCancelRequest{ReceiptUUID: newUUID, Comment: CancelCommentMistake}); compErr != nil {
+		return "", resp, errors.Wrapf(err, "moynalog: replacement receipt %s is left registered (%v)", newUUID, compErr)
+	}
+
+	return "", resp, err
+}
+
+// recordLink records that newUUID replaced receiptUUID with the client's
+// ReceiptLinkRecorder, if any. The link is returned even when recording fails.
+func (s *IncomeService) recordLink(ctx context.Context, receiptUUID, newUUID string, reason CancelComment) (*ReceiptLink, error) {
+	link := &ReceiptLink{
+		OriginalReceiptUUID: receiptUUID,
+		ReissuedReceiptUUID: newUUID,
+		Reason:              reason,
+		LinkedAt:            time.Now(),
+	}
+	if s.client.linkRecorder == nil {
+		return link, nil
+	}
+	if err := s.client.linkRecorder.RecordReceiptLink(ctx, link); err != nil {
+		return link, errors.Wrap(err, "moynalog: cannot record receipt link")
+	}
+
+	return link, nil
+}
@@ -0,0 +1,126 @@
+package moynalog
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestIncomeReissue(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t)
+	recorder := new(MemoryReceiptLinkRecorder)
+	client.linkRecorder = recorder
+
+	link, _, err := client.Income.Reissue(context.Background(), "orig", func(income *IncomeCreateRequest) {
+		income.Services[1].Name = "Доставка курьером"
+		income.Client.DisplayName = "ООО «Ромашка»"
+		income.OperationTime = income.OperationTime.AddDate(0, 1, 0)
+	})
+	if err != nil {
+		t.Fatalf("Reissue: %v", err)
+	}
+	if link.OriginalReceiptUUID != "orig" || link.ReissuedReceiptUUID != "rest" || link.Reason != CancelCommentMistake {
+		t.Errorf("link = %+v, want orig replaced by rest for a mistake", link)
+	}
+
+	want := []string{"create", "cancel orig " + string(CancelCommentMistake)}
+	if strings.Join(srv.calls, "|") != strings.Join(want, "|") {
+		t.Errorf("calls = %q, want %q", srv.calls, want)
+	}
+
+	body := srv.created
+	if body["operationTime"] != "2024-09-01T12:00:00+03:00" {
+		t.Errorf("operationTime = %v, want the original one", body["operationTime"])
+	}
+	if body["totalAmount"] != "1999.99" {
+		t.Errorf("totalAmount = %v, want the original 1999.99", body["totalAmount"])
+	}
+	services, _ := body["services"].([]any)
+	if line, _ := services[1].(map[string]any); line["name"] != "Доставка курьером" {
+		t.Errorf("services = %v, want the corrected line name", services)
+	}
+	if buyer, _ := body["client"].(map[string]any); buyer["displayName"] != "ООО «Ромашка»" || buyer["inn"] != "7707083893" {
+		t.Errorf("client = %v, want the corrected name and the original INN", buyer)
+	}
+
+	if links := recorder.Links(); len(links) != 1 || links[0] != *link {
+		t.Errorf("recorded links = %+v, want %+v", links, link)
+	}
+	if got := recorder.Successor("orig"); got != "rest" {
+		t.Errorf("Successor(orig) = %q, want rest", got)
+	}
+}
+
+func TestIncomeReissueCompensates(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t, "orig")
+	recorder := new(MemoryReceiptLinkRecorder)
+	client.linkRecorder = recorder
+
+	_, _, err := client.Income.Reissue(context.Background(), "orig", func(income *IncomeCreateRequest) {
+		income.Services[0].Name = "Аудит"
+	})
+	if err == nil {
+		t.Fatal("want an error when the original cannot be cancelled")
+	}
+
+	want := []string{"create", "cancel orig " + string(CancelCommentMistake), "cancel rest " + string(CancelCommentMistake)}
+	if strings.Join(srv.calls, "|") != strings.Join(want, "|") {
+		t.Errorf("calls = %q, want %q", srv.calls, want)
+	}
+	if links := recorder.Links(); len(links) != 0 {
+		t.Errorf("recorded links = %+v, want none after a failure", links)
+	}
+}
+
+// A mutation leaving the request invalid must not reach the API.
+func TestIncomeReissueValidation(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newRefundServer(t)
+
+	_, _, err := client.Income.Reissue(context.Background(), "orig", func(income *IncomeCreateRequest) {
+		income.Services = nil
+	})
+	assertLocalError(t, err)
+	if len(srv.calls) != 0 {
+		t.Errorf("calls = %q, want none", srv.calls)
+	}
+
+	_, _, err = client.Income.Reissue(context.Background(), "orig", nil)
+	assertLocalError(t, err)
+}
+
+func TestMemoryReceiptLinkRecorderSuccessor(t *testing.T) {
+	t.Parallel()
+
+	recorder := new(MemoryReceiptLinkRecorder)
+	for _, link := range []ReceiptLink{
+		{OriginalReceiptUUID: "a", ReissuedReceiptUUID: "b"},
+		{OriginalReceiptUUID: "b", ReissuedReceiptUUID: "c"},
+	} {
+		if err := recorder.RecordReceiptLink(context.Background(), &link); err != nil {
+			t.Fatalf("RecordReceiptLink: %v", err)
+		}
+	}
+
+	for uuid, want := range map[string]string{"a": "c", "b": "c", "c": "c", "x": "x"} {
+		if got := recorder.Successor(uuid); got != want {
+			t.Errorf("Successor(%q) = %q, want %q", uuid, got, want)
+		}
+	}
+}
+
+// The recorder must survive deriving an authenticated client.
+func TestWithReceiptLinkRecorder(t *testing.T) {
+	t.Parallel()
+
+	recorder := new(MemoryReceiptLinkRecorder)
+	client := NewClient(WithReceiptLinkRecorder(recorder)).WithToken(&AccessToken{Token: "access"})
+	if client.linkRecorder != recorder {
+		t.Error("WithToken dropped the receipt link recorder")
+	}
+}
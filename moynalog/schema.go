@@ -0,0 +1,379 @@
+package moynalog
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaIssueKind is the kind of a SchemaIssue.
+type SchemaIssueKind string
+
+// Supported schema issue kinds.
+const (
+	// SchemaUnknownField — the response has a field the struct does not model.
+	SchemaUnknownField SchemaIssueKind = "unknown_field"
+	// SchemaTypeMismatch — a value does not fit the type of its field.
+	SchemaTypeMismatch SchemaIssueKind = "type_mismatch"
+	// SchemaUntypedField — a value landed in a field typed any, such as
+	// User.RegisterAvailable, whose shape is not known yet.
+	SchemaUntypedField SchemaIssueKind = "untyped_field"
+)
+
+// SchemaIssue is a difference between an API response and the struct it is
+// decoded into.
+type SchemaIssue struct {
+	// Endpoint is the request the response answered, such as "GET /user".
+	// It is empty for issues found by CheckSchema.
+	Endpoint string
+	Kind     SchemaIssueKind
+	// Path locates the value in the response, such as "content[].services[].name".
+	Path string
+	// GoType is the type of the field, empty for unknown fields, and JSONType
+	// the kind of the value: null, boolean, number, string, array or object.
+	GoType   string
+	JSONType string
+}
+
+// String describes the issue in one line.
+func (i *SchemaIssue) String() string {
+	var b strings.Builder
+	if i.Endpoint != "" {
+		b.WriteString(i.Endpoint + ": ")
+	}
+	switch i.Kind {
+	case SchemaUnknownField:
+		fmt.Fprintf(&b, "unknown field %s (%s)", i.Path, i.JSONType)
+	case SchemaTypeMismatch:
+		fmt.Fprintf(&b, "%s is %s, does not fit %s", i.Path, i.JSONType, i.GoType)
+	default:
+		fmt.Fprintf(&b, "%s of type %s is %s", i.Path, i.GoType, i.JSONType)
+	}
+
+	return b.String()
+}
+
+// SchemaDriftFunc receives the schema issues of a single response.
+type SchemaDriftFunc func(ctx context.Context, issues []*SchemaIssue)
+
+// WithStrictDecoding makes the client compare every JSON response with the
+// struct it decodes into. The issues found are set on Response.SchemaIssues
+// and passed to onDrift, which may be nil. Decoding itself stays as lenient
+// as without the option, so responses are read just the same.
+//
+// The upstream API is undocumented and changes without notice; enable the
+// option in development or canary deployments to learn about it early.
+func WithStrictDecoding(onDrift SchemaDriftFunc) Option {
+	return func(c *Client) {
+		c.strictDecoding = true
+		c.onSchemaDrift = onDrift
+	}
+}
+
+// decodeStrict decodes body into v like Do does and records the schema
+// issues of the response.
+func (c *Client) decodeStrict(ctx context.Context, req *http.Request, resp *Response, body []byte, v any) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	decodeErr := json.NewDecoder(bytes.NewReader(body)).Decode(v)
+
+	issues, err := CheckSchema(body, v)
+	if err != nil {
+		return errors.Wrap(err, "moynalog: cannot decode response body")
+	}
+	if len(issues) > 0 {
+		endpoint := req.Method + " /" + strings.TrimPrefix(req.URL.Path, c.BaseURL.Path)
+		for _, issue := range issues {
+			issue.Endpoint = endpoint
+		}
+		resp.SchemaIssues = issues
+		if c.onSchemaDrift != nil {
+			c.onSchemaDrift(ctx, issues)
+		}
+	}
+
+	if decodeErr != nil {
+		return errors.Wrap(decodeErr, "moynalog: cannot decode response body")
+	}
+
+	return nil
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// CheckSchema compares the JSON document data with the type of v, usually a
+// pointer to the struct the document is decoded into, and returns the fields
+// the type does not model, the values that do not fit their fields and the
+// values landing in fields typed any. Every issue is reported once per path,
+// however many array items share it. Types with their own UnmarshalJSON are
+// only checked to accept their value.
+//
+// Run it in tests against recorded responses to catch API changes.
+func CheckSchema(data []byte, v any) ([]*SchemaIssue, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, errors.Wrap(err, "moynalog: cannot parse JSON document")
+	}
+
+	checker := &schemaChecker{seen: make(map[string]bool)}
+	checker.check("", document, reflect.TypeOf(v))
+
+	return checker.issues, nil
+}
+
+// SchemaTB is the part of testing.TB AssertFixtureSchema uses, so that the
+// package does not import testing.
+type SchemaTB interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Logf(format string, args ...any)
+}
+
+// AssertFixtureSchema fails t when the JSON document in the file at path, a
+// recorded response, has fields v does not model or values that do not fit
+// it. Values landing in fields typed any are only logged: their shape is not
+// known yet, which the field type already says.
+func AssertFixtureSchema(t SchemaTB, path string, v any) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("moynalog: cannot read fixture: %v", err)
+
+		return
+	}
+	issues, err := CheckSchema(data, v)
+	if err != nil {
+		t.Errorf("%s: %v", path, err)
+
+		return
+	}
+	for _, issue := range issues {
+		if issue.Kind == SchemaUntypedField {
+			t.Logf("%s: %s", path, issue)
+
+			continue
+		}
+		t.Errorf("%s: %s", path, issue)
+	}
+}
+
+type schemaChecker struct {
+	issues []*SchemaIssue
+	seen   map[string]bool
+}
+
+func (c *schemaChecker) add(kind SchemaIssueKind, path string, t reflect.Type, value any) {
+	key := string(kind) + " " + path
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+
+	issue := &SchemaIssue{Kind: kind, Path: path, JSONType: jsonType(value)}
+	if t != nil {
+		issue.GoType = t.String()
+	}
+	c.issues = append(c.issues, issue)
+}
+
+func (c *schemaChecker) check(path string, value any, t reflect.Type) {
+	if t == nil || value == nil {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		raw, err := json.Marshal(value)
+		unmarshaler, _ := reflect.New(t).Interface().(json.Unmarshaler)
+		if err != nil || unmarshaler.UnmarshalJSON(raw) != nil {
+			c.add(SchemaTypeMismatch, path, t, value)
+		}
+
+		return
+	}
+	if s, ok := value.(string); ok && reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		unmarshaler, _ := reflect.New(t).Interface().(encoding.TextUnmarshaler)
+		if unmarshaler.UnmarshalText([]byte(s)) != nil {
+			c.add(SchemaTypeMismatch, path, t, value)
+		}
+
+		return
+	}
+	if t.Kind() == reflect.Interface {
+		if t.NumMethod() == 0 {
+			c.add(SchemaUntypedField, path, t, value)
+		}
+
+		return
+	}
+
+	if !c.fits(path, value, t) {
+		c.add(SchemaTypeMismatch, path, t, value)
+	}
+}
+
+// fits reports whether value fits type t, checking what it contains on the way.
+func (c *schemaChecker) fits(path string, value any, t reflect.Type) bool {
+	fits := false
+	switch value := value.(type) {
+	case bool:
+		fits = t.Kind() == reflect.Bool
+	case json.Number:
+		fits = numberFits(value, t)
+	case string:
+		fits = t.Kind() == reflect.String || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+	case []any:
+		if fits = t.Kind() == reflect.Slice || t.Kind() == reflect.Array; fits {
+			for _, item := range value {
+				c.check(path+"[]", item, t.Elem())
+			}
+		}
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Struct:
+			fits = true
+			c.checkStruct(path, value, t)
+		case reflect.Map:
+			fits = true
+			for _, key := range slices.Sorted(maps.Keys(value)) {
+				c.check(joinSchemaPath(path, "*"), value[key], t.Elem())
+			}
+		default:
+		}
+	}
+
+	return fits
+}
+
+func (c *schemaChecker) checkStruct(path string, object map[string]any, t reflect.Type) {
+	fields := make(map[string]reflect.Type)
+	collectJSONFields(t, fields)
+
+	// Sorted, so the issues come out in a stable order.
+	for _, name := range slices.Sorted(maps.Keys(object)) {
+		value := object[name]
+		fieldType, ok := fields[name]
+		if !ok {
+			for fieldName, candidate := range fields {
+				if strings.EqualFold(fieldName, name) {
+					fieldType, ok = candidate, true
+
+					break
+				}
+			}
+		}
+		if !ok {
+			c.add(SchemaUnknownField, joinSchemaPath(path, name), nil, value)
+
+			continue
+		}
+		c.check(joinSchemaPath(path, name), value, fieldType)
+	}
+}
+
+// collectJSONFields maps the JSON names of the fields of struct type t onto
+// their types, flattening embedded structs the way encoding/json does: the
+// fields of t win over those of the structs it embeds.
+func collectJSONFields(t reflect.Type, fields map[string]reflect.Type) {
+	var embedded []reflect.Type
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			inner := field.Type
+			if inner.Kind() == reflect.Pointer {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				embedded = append(embedded, inner)
+
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+
+	for _, inner := range embedded {
+		innerFields := make(map[string]reflect.Type)
+		collectJSONFields(inner, innerFields)
+		for name, fieldType := range innerFields {
+			if _, shadowed := fields[name]; !shadowed {
+				fields[name] = fieldType
+			}
+		}
+	}
+}
+
+func numberFits(number json.Number, t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, err := strconv.ParseInt(number.String(), 10, t.Bits())
+
+		return err == nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		_, err := strconv.ParseUint(number.String(), 10, t.Bits())
+
+		return err == nil
+	case reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func joinSchemaPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
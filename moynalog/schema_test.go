@@ -0,0 +1,184 @@
+package moynalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRecordedFixturesMatchSchema(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join("testdata", "schema")
+	AssertFixtureSchema(t, filepath.Join(dir, "user.json"), new(User))
+	AssertFixtureSchema(t, filepath.Join(dir, "incomes.json"), new(IncomeList))
+	AssertFixtureSchema(t, filepath.Join(dir, "taxes.json"), new(Tax))
+}
+
+// schemaTB records what AssertFixtureSchema reports.
+type schemaTB struct {
+	errors, logs []string
+}
+
+func (*schemaTB) Helper() {}
+
+func (s *schemaTB) Errorf(format string, args ...any) {
+	s.errors = append(s.errors, fmt.Sprintf(format, args...))
+}
+
+func (s *schemaTB) Logf(format string, args ...any) {
+	s.logs = append(s.logs, fmt.Sprintf(format, args...))
+}
+
+func TestAssertFixtureSchema(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "user.json")
+	if err := os.WriteFile(path, []byte(`{"inn":"770000000000","newFlag":1,"registerAvailable":true}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tb := new(schemaTB)
+	AssertFixtureSchema(tb, path, new(User))
+	if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "unknown field newFlag") {
+		t.Errorf("errors = %q, want the unknown field", tb.errors)
+	}
+	if len(tb.logs) != 1 || !strings.Contains(tb.logs[0], "registerAvailable") {
+		t.Errorf("logs = %q, want the untyped field logged", tb.logs)
+	}
+
+	missing := new(schemaTB)
+	AssertFixtureSchema(missing, filepath.Join(dir, "missing.json"), new(User))
+	if len(missing.errors) != 1 {
+		t.Errorf("errors = %q, want a missing fixture to fail", missing.errors)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	t.Parallel()
+
+	type Inner struct {
+		Count int `json:"count"`
+	}
+	type Embedded struct {
+		Shared string `json:"shared"`
+		Own    string `json:"own"`
+	}
+	type Doc struct {
+		Embedded
+		Shared  int             `json:"shared"`
+		Items   []Inner         `json:"items"`
+		ByKey   map[string]bool `json:"byKey"`
+		Untyped any             `json:"untyped"`
+		Period  TaxPeriod       `json:"period"`
+		When    Time            `json:"when"`
+		Skipped string          `json:"-"`
+		Loose   string
+	}
+
+	data := `{
+		"own": "embedded", "shared": 1, "LOOSE": "case-insensitive",
+		"items": [{"count": 1, "extra": true}, {"count": "2", "extra": false}, {"count": 1.5}],
+		"byKey": {"a": true, "b": "yes"},
+		"untyped": {"shape": "unknown"},
+		"period": 202409,
+		"when": "not a time",
+		"Skipped": "x",
+		"added": null
+	}`
+	issues, err := CheckSchema([]byte(data), new(Doc))
+	if err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	// Items share their paths, so the second count mismatch is not repeated.
+	want := []string{
+		"unknown field Skipped (string)",
+		"unknown field added (null)",
+		"byKey.* is string, does not fit bool",
+		"unknown field items[].extra (boolean)",
+		"items[].count is string, does not fit int",
+		"untyped of type interface {} is object",
+		"when is string, does not fit moynalog.Time",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("issues =\n%q\nwant\n%q", got, want)
+	}
+
+	if _, err := CheckSchema([]byte(`{`), new(Doc)); err == nil {
+		t.Error("CheckSchema of broken JSON = nil error, want one")
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc("/v1/user", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{"inn":"500100732259","registerAvailable":true,"newFlag":1}`)
+	})
+
+	var (
+		mu      sync.Mutex
+		drifted []string
+	)
+	client := NewClient(
+		WithEndpoint(server.URL),
+		WithDeviceID("testdeviceid"),
+		WithStrictDecoding(func(_ context.Context, issues []*SchemaIssue) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, issue := range issues {
+				drifted = append(drifted, issue.String())
+			}
+		}),
+	).WithToken(&AccessToken{Token: "access-token"})
+
+	user, resp, err := client.Users.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if user.Inn != "500100732259" {
+		t.Errorf("Inn = %q, strict decoding must still decode", user.Inn)
+	}
+
+	want := []string{"GET /user: unknown field newFlag (number)", "GET /user: registerAvailable of type interface {} is boolean"}
+	if fmt.Sprint(resp.SchemaIssues) != fmt.Sprint(want) {
+		t.Errorf("SchemaIssues = %v, want %v", resp.SchemaIssues, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(drifted) != fmt.Sprint(want) {
+		t.Errorf("drift callback got %q, want %q", drifted, want)
+	}
+}
+
+func TestLenientDecodingRecordsNoIssues(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/user", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{"inn":"500100732259","newFlag":1}`)
+	})
+
+	_, resp, err := client.Users.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if resp.SchemaIssues != nil {
+		t.Errorf("SchemaIssues = %v, want none without strict decoding", resp.SchemaIssues)
+	}
+}
@@ -23,7 +23,12 @@ type Tax struct {
 	TaxPeriodID        int             `json:"taxPeriodId"`
 	LastPaymentAmount  decimal.Decimal `json:"lastPaymentAmount"`
 	LastPaymentDate    Time            `json:"lastPaymentDate"`
-	Regions            []any           `json:"regions"`
+	Regions            []*TaxRegion    `json:"regions"`
+}
+
+// TaxPeriod returns TaxPeriodID as a TaxPeriod.
+func (t *Tax) TaxPeriod() TaxPeriod {
+	return TaxPeriod(t.TaxPeriodID)
 }
 
 // TaxHistoryRecord is a single tax accrual.
@@ -44,6 +49,11 @@ type TaxHistoryRecord struct {
 	ReceiptCount    int             `json:"receiptCount"`
 }
 
+// TaxPeriod returns TaxPeriodID as a TaxPeriod.
+func (r *TaxHistoryRecord) TaxPeriod() TaxPeriod {
+	return TaxPeriod(r.TaxPeriodID)
+}
+
 // TaxPayment is a single tax payment.
 type TaxPayment struct {
 	SourceType       string          `json:"sourceType"`
@@ -60,6 +70,11 @@ type TaxPayment struct {
 	KrsbAcceptedDate Time            `json:"krsbAcceptedDate"`
 }
 
+// TaxPeriod returns TaxPeriodID as a TaxPeriod.
+func (p *TaxPayment) TaxPeriod() TaxPeriod {
+	return TaxPeriod(p.TaxPeriodID)
+}
+
 // Get returns the current tax position.
 //
 // GET /taxes
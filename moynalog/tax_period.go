@@ -0,0 +1,130 @@
+package moynalog
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// taxPeriodYearFactor shifts the year past the month in a TaxPeriod.
+	taxPeriodYearFactor = 100
+	// taxDueDay is the day of the following month the tax of a period is due.
+	taxDueDay = 28
+)
+
+// TaxPeriod is a calendar month in the YYYYMM form the API uses for
+// TaxPeriodID, such as 202409 for September 2024. Tax periods are Moscow
+// months: a receipt registered at 23:30 UTC on September 30 belongs to
+// October.
+type TaxPeriod int
+
+// NewTaxPeriod returns the tax period of month of year.
+func NewTaxPeriod(year int, month time.Month) TaxPeriod {
+	return TaxPeriod(year*taxPeriodYearFactor + int(month))
+}
+
+// TaxPeriodOf returns the tax period t falls in.
+func TaxPeriodOf(t time.Time) TaxPeriod {
+	t = t.In(moscow)
+
+	return NewTaxPeriod(t.Year(), t.Month())
+}
+
+// ParseTaxPeriod parses a tax period written as YYYYMM.
+func ParseTaxPeriod(s string) (TaxPeriod, error) {
+	if len(s) != len("200601") || !isDigits(s) {
+		return 0, invalidArgument("moynalog: tax period %q must be written as YYYYMM", s)
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "moynalog: tax period %q is invalid", s)
+	}
+	period := TaxPeriod(value)
+	if !period.Valid() {
+		return 0, invalidArgument("moynalog: tax period %q has no month %d", s, int(period.Month()))
+	}
+
+	return period, nil
+}
+
+// Year returns the year of the period.
+func (p TaxPeriod) Year() int {
+	return int(p) / taxPeriodYearFactor
+}
+
+// Month returns the month of the period.
+func (p TaxPeriod) Month() time.Month {
+	return time.Month(int(p) % taxPeriodYearFactor)
+}
+
+// Valid reports whether p names a month.
+func (p TaxPeriod) Valid() bool {
+	return p.Year() > 0 && p.Month() >= time.January && p.Month() <= time.December
+}
+
+// String returns the period as YYYYMM.
+func (p TaxPeriod) String() string {
+	return strconv.Itoa(int(p))
+}
+
+// Start returns the first instant of the period, midnight of its first day
+// in Moscow.
+func (p TaxPeriod) Start() time.Time {
+	return time.Date(p.Year(), p.Month(), 1, 0, 0, 0, 0, moscow)
+}
+
+// End returns the first instant past the period, the Start of the next one.
+func (p TaxPeriod) End() time.Time {
+	return p.Next().Start()
+}
+
+// Contains reports whether t falls in the period.
+func (p TaxPeriod) Contains(t time.Time) bool {
+	return TaxPeriodOf(t) == p
+}
+
+// Next returns the following period.
+func (p TaxPeriod) Next() TaxPeriod {
+	return p.add(1)
+}
+
+// Prev returns the preceding period.
+func (p TaxPeriod) Prev() TaxPeriod {
+	return p.add(-1)
+}
+
+func (p TaxPeriod) add(months int) TaxPeriod {
+	start := time.Date(p.Year(), p.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+
+	return NewTaxPeriod(start.Year(), start.Month())
+}
+
+// DueDate returns the day the tax of the period has to be paid by: the 28th
+// of the following month, moved to the next Monday when it falls on a
+// weekend. Public holidays are not taken into account.
+func (p TaxPeriod) DueDate() time.Time {
+	next := p.Next()
+	due := time.Date(next.Year(), next.Month(), taxDueDay, 0, 0, 0, 0, moscow)
+
+	switch due.Weekday() {
+	case time.Saturday:
+		return due.AddDate(0, 0, 2)
+	case time.Sunday:
+		return due.AddDate(0, 0, 1)
+	default:
+		return due
+	}
+}
+
+// TaxPeriodsBetween returns the periods from first to last, both included, in
+// order. It returns nil when last precedes first.
+func TaxPeriodsBetween(first, last TaxPeriod) []TaxPeriod {
+	var periods []TaxPeriod
+	for period := first; period <= last; period = period.Next() {
+		periods = append(periods, period)
+	}
+
+	return periods
+}
@@ -0,0 +1,122 @@
+package moynalog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTaxPeriod(t *testing.T) {
+	t.Parallel()
+
+	period := NewTaxPeriod(2024, time.September)
+	if period != 202409 || period.String() != "202409" || period.Year() != 2024 || period.Month() != time.September {
+		t.Errorf("NewTaxPeriod = %s (%d, %s)", period, period.Year(), period.Month())
+	}
+	if period.Next() != 202410 || period.Prev() != 202408 || NewTaxPeriod(2024, time.December).Next() != 202501 ||
+		NewTaxPeriod(2024, time.January).Prev() != 202312 {
+		t.Error("Next and Prev must roll over years")
+	}
+
+	if start := period.Start(); !start.Equal(time.Date(2024, time.August, 31, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("Start = %s, want Moscow midnight", start)
+	}
+	if end := period.End(); !end.Equal(time.Date(2024, time.September, 30, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("End = %s, want the start of October in Moscow", end)
+	}
+
+	// Just before midnight UTC is already the next day in Moscow.
+	if got := TaxPeriodOf(time.Date(2024, time.September, 30, 22, 30, 0, 0, time.UTC)); got != 202410 {
+		t.Errorf("TaxPeriodOf = %s, want 202410", got)
+	}
+	if !period.Contains(time.Date(2024, time.September, 30, 20, 59, 0, 0, time.UTC)) || period.Contains(period.End()) {
+		t.Error("Contains must follow the Moscow month")
+	}
+}
+
+func TestParseTaxPeriod(t *testing.T) {
+	t.Parallel()
+
+	if period, err := ParseTaxPeriod("202409"); err != nil || period != 202409 {
+		t.Errorf("ParseTaxPeriod = %s, %v", period, err)
+	}
+	for _, s := range []string{"", "2024-09", "20249", "202413", "202400", "+20249"} {
+		if _, err := ParseTaxPeriod(s); err == nil {
+			t.Errorf("ParseTaxPeriod(%q) = nil error, want one", s)
+		}
+	}
+}
+
+func TestTaxPeriodDueDate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		period TaxPeriod
+		want   time.Time
+	}{
+		{202409, time.Date(2024, time.October, 28, 0, 0, 0, 0, moscow)},   // Monday.
+		{202408, time.Date(2024, time.September, 30, 0, 0, 0, 0, moscow)}, // Saturday the 28th.
+		{202406, time.Date(2024, time.July, 29, 0, 0, 0, 0, moscow)},      // Sunday the 28th.
+		{202412, time.Date(2025, time.January, 28, 0, 0, 0, 0, moscow)},
+	}
+	for _, tt := range tests {
+		if got := tt.period.DueDate(); !got.Equal(tt.want) {
+			t.Errorf("DueDate of %s = %s, want %s", tt.period, got, tt.want)
+		}
+	}
+}
+
+func TestTaxPeriodsBetween(t *testing.T) {
+	t.Parallel()
+
+	got := TaxPeriodsBetween(202411, 202502)
+	want := []TaxPeriod{202411, 202412, 202501, 202502}
+	if len(got) != len(want) {
+		t.Fatalf("TaxPeriodsBetween = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("TaxPeriodsBetween[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if got := TaxPeriodsBetween(202402, 202401); got != nil {
+		t.Errorf("TaxPeriodsBetween reversed = %v, want nil", got)
+	}
+}
+
+func TestTaxPeriodJSON(t *testing.T) {
+	t.Parallel()
+
+	var tax Tax
+	if err := json.Unmarshal([]byte(`{"taxPeriodId":202409}`), &tax); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if tax.TaxPeriodID != 202409 || tax.TaxPeriod() != NewTaxPeriod(2024, time.September) {
+		t.Errorf("TaxPeriodID = %d (%s), want 202409", tax.TaxPeriodID, tax.TaxPeriod())
+	}
+}
+
+func TestIncomeListTaxPeriod(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/incomes", func(w http.ResponseWriter, r *http.Request) {
+		testQuery(t, r, map[string]string{
+			"from": "2024-09-01T00:00:00.000+03:00",
+			"to":   "2024-09-30T23:59:59.999+03:00",
+		})
+		writeJSON(t, w, http.StatusOK, `{"content":[]}`)
+	})
+
+	ctx := context.Background()
+	if _, _, err := client.Income.List(ctx, &IncomeListOptions{TaxPeriod: 202409}); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	_, _, err := client.Income.List(ctx, &IncomeListOptions{TaxPeriod: 202413})
+	assertLocalError(t, err)
+	_, _, err = client.Income.List(ctx, &IncomeListOptions{TaxPeriod: 202409, From: NewTime(time.Now())})
+	assertLocalError(t, err)
+}
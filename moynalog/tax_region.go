@@ -0,0 +1,139 @@
+package moynalog
+
+import (
+	"context"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// TaxRegion is the tax position of the taxpayer in one region, an item of
+// Tax.Regions.
+type TaxRegion struct {
+	Oktmo           string          `json:"oktmo"`
+	RegionName      string          `json:"regionName"`
+	TotalForPayment decimal.Decimal `json:"totalForPayment"`
+	Tax             decimal.Decimal `json:"tax"`
+	Debt            decimal.Decimal `json:"debt"`
+	Overpayment     decimal.Decimal `json:"overpayment"`
+	Penalty         decimal.Decimal `json:"penalty"`
+}
+
+// RegionTaxes collects the accruals and the settled payments of the taxpayer
+// in one region. Taxpayers who moved have them in several regions.
+type RegionTaxes struct {
+	Oktmo      string
+	RegionName string
+	History    []*TaxHistoryRecord
+	Payments   []*TaxPayment
+}
+
+// RegionBalance sums up the taxes of one region.
+type RegionBalance struct {
+	Oktmo      string
+	RegionName string
+	// Charged is the tax accrued and Paid the payments settled.
+	Charged decimal.Decimal
+	Paid    decimal.Decimal
+	// Outstanding is Charged less Paid, negative when more was paid than
+	// charged.
+	Outstanding decimal.Decimal
+}
+
+// Balance sums up the accruals and payments of the region.
+func (r *RegionTaxes) Balance() *RegionBalance {
+	balance := &RegionBalance{Oktmo: r.Oktmo, RegionName: r.RegionName}
+	for _, record := range r.History {
+		if record != nil {
+			balance.Charged = balance.Charged.Add(record.TaxAmount)
+		}
+	}
+	for _, payment := range r.Payments {
+		if payment != nil {
+			balance.Paid = balance.Paid.Add(payment.Amount)
+		}
+	}
+	balance.Outstanding = balance.Charged.Sub(balance.Paid)
+
+	return balance
+}
+
+// ByRegion returns the accruals and settled payments of every region the
+// taxpayer has taxes in, ordered by OKTMO. The regions are those of the tax
+// position and of the unfiltered history and payments; each of them is then
+// fetched on its own, as History and Payments do not always report every
+// region unless asked for it.
+//
+// GET /taxes, POST /taxes/history, POST /taxes/payments
+func (s *TaxService) ByRegion(ctx context.Context) ([]*RegionTaxes, error) {
+	tax, _, err := s.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history, _, err := s.History(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	payments, _, err := s.Payments(ctx, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	see := func(oktmo, name string) {
+		if oktmo == "" {
+			return
+		}
+		if names[oktmo] == "" {
+			names[oktmo] = name
+		}
+	}
+	for _, region := range tax.Regions {
+		if region != nil {
+			see(region.Oktmo, region.RegionName)
+		}
+	}
+	for _, record := range history {
+		if record != nil {
+			see(record.Oktmo, record.RegionName)
+		}
+	}
+	for _, payment := range payments {
+		if payment != nil {
+			see(payment.Oktmo, payment.RegionName)
+		}
+	}
+
+	oktmos := make([]string, 0, len(names))
+	for oktmo := range names {
+		oktmos = append(oktmos, oktmo)
+	}
+	sort.Strings(oktmos)
+
+	regions := make([]*RegionTaxes, 0, len(oktmos))
+	for _, oktmo := range oktmos {
+		region := &RegionTaxes{Oktmo: oktmo, RegionName: names[oktmo]}
+		if region.History, _, err = s.History(ctx, oktmo); err != nil {
+			return nil, err
+		}
+		if region.Payments, _, err = s.Payments(ctx, oktmo, true); err != nil {
+			return nil, err
+		}
+		regions = append(regions, region)
+	}
+
+	return regions, nil
+}
+
+// RegionBalances returns the balance of every region of regions, in the same
+// order.
+func RegionBalances(regions []*RegionTaxes) []*RegionBalance {
+	balances := make([]*RegionBalance, 0, len(regions))
+	for _, region := range regions {
+		if region != nil {
+			balances = append(balances, region.Balance())
+		}
+	}
+
+	return balances
+}
@@ -0,0 +1,97 @@
+package moynalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestTaxRegionsJSON(t *testing.T) {
+	t.Parallel()
+
+	var tax Tax
+	err := json.Unmarshal([]byte(`{"regions":[{"oktmo":"45000000","regionName":"Москва","totalForPayment":120.5,"debt":10}]}`), &tax)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(tax.Regions) != 1 {
+		t.Fatalf("Regions = %v, want one", tax.Regions)
+	}
+	region := tax.Regions[0]
+	if region.Oktmo != "45000000" || region.RegionName != "Москва" ||
+		!region.TotalForPayment.Equal(decimal.RequireFromString("120.5")) || !region.Debt.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("region = %+v", region)
+	}
+}
+
+func TestTaxByRegion(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/taxes", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusOK, `{"regions":[{"oktmo":"45000000","regionName":"Москва"}]}`)
+	})
+	// Unfiltered, the API reports the current region only.
+	history := map[any]string{
+		nil:        `{"taxAmount":100,"oktmo":"45000000","regionName":"Москва"}`,
+		"45000000": `{"taxAmount":100,"oktmo":"45000000"},{"taxAmount":50,"oktmo":"45000000"}`,
+		"27000000": `{"taxAmount":80,"oktmo":"27000000","regionName":"Калининградская область"}`,
+	}
+	payments := map[any]string{
+		nil:        `{"amount":80,"oktmo":"27000000","regionName":"Калининградская область"}`,
+		"45000000": `{"amount":100,"oktmo":"45000000"}`,
+		"27000000": `{"amount":80,"oktmo":"27000000"},{"amount":20,"oktmo":"27000000"}`,
+	}
+	serve := func(records map[any]string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body := testBody(t, r)
+			if oktmo := body["oktmo"]; oktmo != nil && body["onlyPaid"] == false {
+				t.Error("payments of a region must be settled ones")
+			}
+			writeJSON(t, w, http.StatusOK, `{"records":[`+records[body["oktmo"]]+`]}`)
+		}
+	}
+	mux.HandleFunc("/v1/taxes/history", serve(history))
+	mux.HandleFunc("/v1/taxes/payments", serve(payments))
+
+	regions, err := client.Tax.ByRegion(context.Background())
+	if err != nil {
+		t.Fatalf("ByRegion: %v", err)
+	}
+	if len(regions) != 2 {
+		t.Fatalf("regions = %d, want 2", len(regions))
+	}
+	if regions[0].Oktmo != "27000000" || regions[0].RegionName != "Калининградская область" ||
+		len(regions[0].History) != 1 || len(regions[0].Payments) != 2 {
+		t.Errorf("regions[0] = %+v", regions[0])
+	}
+	if regions[1].Oktmo != "45000000" || regions[1].RegionName != "Москва" || len(regions[1].History) != 2 {
+		t.Errorf("regions[1] = %+v", regions[1])
+	}
+
+	var got []string
+	for _, balance := range RegionBalances(regions) {
+		got = append(got, fmt.Sprintf("%s %s/%s/%s", balance.Oktmo, balance.Charged, balance.Paid, balance.Outstanding))
+	}
+	want := []string{"27000000 80/100/-20", "45000000 150/100/50"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("balances = %q, want %q", got, want)
+	}
+}
+
+func TestTaxByRegionError(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	mux.HandleFunc("/v1/taxes", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, http.StatusInternalServerError, `{"message":"unavailable"}`)
+	})
+
+	if _, err := client.Tax.ByRegion(context.Background()); err == nil {
+		t.Error("ByRegion = nil error, want the API error")
+	}
+}
@@ -0,0 +1,385 @@
+package moynalog
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// defaultTaxReminderInterval is how often a TaxReminderScheduler checks the
+// tax position.
+const defaultTaxReminderInterval = 6 * time.Hour
+
+// defaultTaxReminderDays are the days before the due date a
+// TaxReminderScheduler reminds of the payment, in ascending order.
+var defaultTaxReminderDays = []int{1, 3, 7}
+
+// TaxReminderType is the kind of a TaxReminder.
+type TaxReminderType string
+
+// Supported tax reminder types.
+const (
+	// TaxPaymentDue — tax is to be paid within the next few days.
+	TaxPaymentDue TaxReminderType = "tax.payment_due"
+	// TaxDebtAppeared — overdue tax has turned into debt. Repeated once per
+	// tax period while the debt stays unpaid.
+	TaxDebtAppeared TaxReminderType = "tax.debt"
+	// TaxPenaltyAppeared — penalties were charged. Penalties accrue daily, so
+	// this too is repeated only once per tax period.
+	TaxPenaltyAppeared TaxReminderType = "tax.penalty"
+)
+
+// TaxReminder is a single notification of a TaxReminderScheduler.
+type TaxReminder struct {
+	Type TaxReminderType
+	// Amount is the sum to pay, the debt or the penalty, depending on Type.
+	Amount decimal.Decimal
+	// Period is the tax period the reminder is about. DueDate is its payment
+	// deadline, only set for TaxPaymentDue.
+	Period  TaxPeriod
+	DueDate time.Time
+	// DaysLeft is the number of days until DueDate, 0 on the day itself.
+	DaysLeft int
+	// Tax and Debts are the positions the reminder was derived from.
+	Tax   *Tax
+	Debts *Debts
+}
+
+// Notifier delivers tax reminders, by email, chat message or otherwise.
+type Notifier interface {
+	Notify(ctx context.Context, reminder *TaxReminder) error
+}
+
+// NotifierFunc adapts a function to Notifier.
+type NotifierFunc func(ctx context.Context, reminder *TaxReminder) error
+
+// Notify implements Notifier.
+func (f NotifierFunc) Notify(ctx context.Context, reminder *TaxReminder) error {
+	return f(ctx, reminder)
+}
+
+// TaxReminderState is what a TaxReminderScheduler has already notified of.
+type TaxReminderState struct {
+	// Sent maps the key of every reminder still in force onto when it was
+	// delivered. Keys of reminders no longer in force are dropped, so a debt
+	// paid off and incurred again is notified again.
+	Sent map[string]time.Time `json:"sent"`
+}
+
+// TaxReminderStore persists the state of a TaxReminderScheduler.
+// Implementations must be safe for concurrent use.
+type TaxReminderStore interface {
+	// LoadTaxReminderState returns the stored state, or nil when there is none.
+	LoadTaxReminderState(ctx context.Context) (*TaxReminderState, error)
+	// SaveTaxReminderState replaces the stored state.
+	SaveTaxReminderState(ctx context.Context, state *TaxReminderState) error
+}
+
+// MemoryTaxReminderStore keeps the state in memory only, so a restart sends
+// the reminders in force once more. The zero value is ready to use.
+type MemoryTaxReminderStore struct {
+	mu    sync.Mutex
+	state *TaxReminderState
+}
+
+// LoadTaxReminderState implements TaxReminderStore.
+func (s *MemoryTaxReminderStore) LoadTaxReminderState(context.Context) (*TaxReminderState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.clone(), nil
+}
+
+// SaveTaxReminderState implements TaxReminderStore.
+func (s *MemoryTaxReminderStore) SaveTaxReminderState(_ context.Context, state *TaxReminderState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state.clone()
+
+	return nil
+}
+
+// FileTaxReminderStore keeps the state in a JSON file, rewritten atomically on
+// every save.
+type FileTaxReminderStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileTaxReminderStore returns a store backed by the file at path. The
+// file is created on the first save.
+func NewFileTaxReminderStore(path string) *FileTaxReminderStore {
+	return &FileTaxReminderStore{path: path}
+}
+
+// LoadTaxReminderState implements TaxReminderStore.
+func (s *FileTaxReminderStore) LoadTaxReminderState(context.Context) (*TaxReminderState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state *TaxReminderState
+	if err := readJSONFile(s.path, &state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// SaveTaxReminderState implements TaxReminderStore.
+func (s *FileTaxReminderStore) SaveTaxReminderState(_ context.Context, state *TaxReminderState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeJSONFile(s.path, state)
+}
+
+func (s *TaxReminderState) clone() *TaxReminderState {
+	if s == nil {
+		return nil
+	}
+
+	clone := &TaxReminderState{Sent: make(map[string]time.Time, len(s.Sent))}
+	for key, sentAt := range s.Sent {
+		clone.Sent[key] = sentAt
+	}
+
+	return clone
+}
+
+// TaxReminderScheduler periodically reads the tax position and the debts of
+// the taxpayer and notifies of payments coming due, debts and penalties.
+//
+// Every reminder is delivered once while it stays in force, across restarts
+// when the store is persistent. A reminder whose notification failed is
+// retried by the next check.
+type TaxReminderScheduler struct {
+	client     *Client
+	notifier   Notifier
+	store      TaxReminderStore
+	interval   time.Duration
+	daysBefore []int
+	onError    func(ctx context.Context, err error)
+	now        func() time.Time
+
+	// mu serialises checks, which read and write the state.
+	mu sync.Mutex
+}
+
+// TaxReminderOption customises a TaxReminderScheduler.
+type TaxReminderOption func(*TaxReminderScheduler)
+
+// WithTaxReminderStore sets where the scheduler remembers the reminders it
+// sent. Defaults to a MemoryTaxReminderStore.
+func WithTaxReminderStore(store TaxReminderStore) TaxReminderOption {
+	return func(s *TaxReminderScheduler) {
+		if store != nil {
+			s.store = store
+		}
+	}
+}
+
+// WithTaxReminderInterval sets how often Run checks. Defaults to six hours.
+func WithTaxReminderInterval(interval time.Duration) TaxReminderOption {
+	return func(s *TaxReminderScheduler) {
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+// WithTaxReminderDays sets how many days before the due date the payment is
+// reminded of. Defaults to 7, 3 and 1 days. A check that finds several of them
+// passed, after downtime for instance, sends only the one closest to the due
+// date.
+func WithTaxReminderDays(days ...int) TaxReminderOption {
+	return func(s *TaxReminderScheduler) {
+		valid := make([]int, 0, len(days))
+		for _, day := range days {
+			if day >= 0 {
+				valid = append(valid, day)
+			}
+		}
+		if len(valid) > 0 {
+			sort.Ints(valid)
+			s.daysBefore = valid
+		}
+	}
+}
+
+// WithTaxReminderErrorHandler reports every check of Run that failed, for
+// logging. Run carries on after a failed check either way.
+func WithTaxReminderErrorHandler(onError func(ctx context.Context, err error)) TaxReminderOption {
+	return func(s *TaxReminderScheduler) {
+		s.onError = onError
+	}
+}
+
+// NewTaxReminderScheduler returns a scheduler checking the taxes of the
+// taxpayer client is authenticated as and notifying notifier.
+func NewTaxReminderScheduler(client *Client, notifier Notifier, opts ...TaxReminderOption) *TaxReminderScheduler {
+	s := &TaxReminderScheduler{
+		client:     client,
+		notifier:   notifier,
+		store:      new(MemoryTaxReminderStore),
+		interval:   defaultTaxReminderInterval,
+		daysBefore: defaultTaxReminderDays,
+		now:        time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Check reads the tax position once and notifies of the reminders in force
+// that were not notified of yet.
+func (s *TaxReminderScheduler) Check(ctx context.Context) error {
+	if s.notifier == nil {
+		return invalidArgument("moynalog: tax reminder notifier cannot be nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tax, _, err := s.client.Tax.Get(ctx)
+	if err != nil {
+		return err
+	}
+	debts, _, err := s.client.Taxpayer.Debts(ctx)
+	if err != nil {
+		return err
+	}
+
+	state, err := s.store.LoadTaxReminderState(ctx)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &TaxReminderState{}
+	}
+
+	now := s.now()
+	reminders, keys := s.reminders(tax, debts, now)
+
+	// Forget what is no longer in force, then deliver what is new.
+	next := &TaxReminderState{Sent: make(map[string]time.Time, len(keys))}
+	for _, key := range keys {
+		if sentAt, sent := state.Sent[key]; sent {
+			next.Sent[key] = sentAt
+		}
+	}
+	for i, reminder := range reminders {
+		if _, sent := next.Sent[keys[i]]; sent {
+			continue
+		}
+		if err := s.notifier.Notify(ctx, reminder); err != nil {
+			if saveErr := s.store.SaveTaxReminderState(ctx, next); saveErr != nil {
+				return errors.Wrap(err, saveErr.Error())
+			}
+
+			return err
+		}
+		next.Sent[keys[i]] = now
+	}
+
+	return s.store.SaveTaxReminderState(ctx, next)
+}
+
+// reminders returns the reminders in force together with their keys.
+func (s *TaxReminderScheduler) reminders(tax *Tax, debts *Debts, now time.Time) ([]*TaxReminder, []string) {
+	var (
+		reminders []*TaxReminder
+		keys      []string
+	)
+
+	period := tax.TaxPeriod()
+	if !period.Valid() {
+		period = TaxPeriodOf(now).Prev()
+	}
+
+	if tax.TotalForPayment.IsPositive() {
+		due := period.DueDate()
+		daysLeft := daysBetween(now, due)
+
+		// The reminder of the smallest threshold reached stands for all the
+		// larger ones.
+		for _, days := range s.daysBefore {
+			if daysLeft >= 0 && daysLeft <= days {
+				reminders = append(reminders, &TaxReminder{
+					Type: TaxPaymentDue, Amount: tax.TotalForPayment,
+					Period: period, DueDate: due, DaysLeft: daysLeft,
+					Tax: tax, Debts: debts,
+				})
+				keys = append(keys, string(TaxPaymentDue)+":"+period.String()+":"+strconv.Itoa(days))
+
+				break
+			}
+		}
+	}
+
+	debt := tax.Debt
+	if debts.HasDebts && debts.TotalUnpaid.GreaterThan(debt) {
+		debt = debts.TotalUnpaid
+	}
+	// Debts and penalties are keyed on the period, not the amount: penalties
+	// grow every day and would otherwise be reminded of daily.
+	if debt.IsPositive() {
+		reminders = append(reminders, &TaxReminder{Type: TaxDebtAppeared, Amount: debt, Period: period, Tax: tax, Debts: debts})
+		keys = append(keys, string(TaxDebtAppeared)+":"+period.String())
+	}
+
+	if tax.Penalty.IsPositive() {
+		reminders = append(reminders, &TaxReminder{Type: TaxPenaltyAppeared, Amount: tax.Penalty, Period: period, Tax: tax, Debts: debts})
+		keys = append(keys, string(TaxPenaltyAppeared)+":"+period.String())
+	}
+
+	return reminders, keys
+}
+
+// daysBetween returns the number of Moscow calendar days from the day of now
+// to the day of due.
+func daysBetween(now, due time.Time) int {
+	now, due = now.In(moscow), due.In(moscow)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(to.Sub(from) / (24 * time.Hour))
+}
+
+// Run checks immediately and then every interval until ctx is done, and
+// returns ctx.Err(). A failed check, the API or the notifier being down for
+// instance, is reported to the WithTaxReminderErrorHandler handler and retried
+// on the next tick. Only a nil notifier stops Run straight away.
+func (s *TaxReminderScheduler) Run(ctx context.Context) error {
+	if s.notifier == nil {
+		return invalidArgument("moynalog: tax reminder notifier cannot be nil")
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Check(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if s.onError != nil {
+				s.onError(ctx, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
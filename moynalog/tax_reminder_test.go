@@ -0,0 +1,280 @@
+package moynalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// taxServer serves /taxes and /taxpayer/debts from the position set last.
+type taxServer struct {
+	mu      sync.Mutex
+	period  TaxPeriod
+	payment string
+	debt    string
+	penalty string
+}
+
+func (s *taxServer) set(payment, debt, penalty string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.payment, s.debt, s.penalty = payment, debt, penalty
+}
+
+func newTaxServer(t *testing.T) (*Client, *taxServer) {
+	t.Helper()
+
+	client, mux := setupAuthed(t)
+	srv := &taxServer{period: 202409, payment: "0", debt: "0", penalty: "0"}
+	mux.HandleFunc("/v1/taxes", func(w http.ResponseWriter, _ *http.Request) {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		writeJSON(t, w, http.StatusOK, fmt.Sprintf(`{"totalForPayment":%s,"debt":%s,"penalty":%s,"taxPeriodId":%d}`,
+			srv.payment, srv.debt, srv.penalty, srv.period))
+	})
+	mux.HandleFunc("/v1/taxpayer/debts", func(w http.ResponseWriter, _ *http.Request) {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		writeJSON(t, w, http.StatusOK, fmt.Sprintf(`{"hasDebts":%t,"totalUnpaid":%s}`, srv.debt != "0", srv.debt))
+	})
+
+	return client, srv
+}
+
+// reminderLog collects the reminders delivered to it.
+type reminderLog struct {
+	mu        sync.Mutex
+	reminders []string
+	fail      bool
+}
+
+func (l *reminderLog) Notify(_ context.Context, reminder *TaxReminder) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.fail {
+		return errors.New("notifier unavailable")
+	}
+	l.reminders = append(l.reminders, fmt.Sprintf("%s %s %d", reminder.Type, reminder.Amount, reminder.DaysLeft))
+
+	return nil
+}
+
+func (l *reminderLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	taken := l.reminders
+	l.reminders = nil
+
+	return taken
+}
+
+func at(day int) func() time.Time {
+	return func() time.Time { return time.Date(2024, time.October, day, 10, 0, 0, 0, moscow) }
+}
+
+func checkReminders(t *testing.T, scheduler *TaxReminderScheduler, log *reminderLog, want ...string) {
+	t.Helper()
+
+	if err := scheduler.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	got := log.take()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("reminders = %q, want %q", got, want)
+	}
+}
+
+func TestTaxReminderPaymentDue(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newTaxServer(t)
+	srv.set("1200.5", "0", "0")
+	log := new(reminderLog)
+	scheduler := NewTaxReminderScheduler(client, log)
+
+	// The tax of 202409 is due on Monday, October 28.
+	scheduler.now = at(14)
+	checkReminders(t, scheduler, log)
+	scheduler.now = at(21)
+	checkReminders(t, scheduler, log, "tax.payment_due 1200.5 7")
+	checkReminders(t, scheduler, log)
+	scheduler.now = at(23)
+	checkReminders(t, scheduler, log)
+	scheduler.now = at(25)
+	checkReminders(t, scheduler, log, "tax.payment_due 1200.5 3")
+	scheduler.now = at(27)
+	checkReminders(t, scheduler, log, "tax.payment_due 1200.5 1")
+	scheduler.now = at(28)
+	checkReminders(t, scheduler, log)
+
+	srv.set("0", "0", "0")
+	checkReminders(t, scheduler, log)
+}
+
+// After downtime only the reminder closest to the due date is sent.
+func TestTaxReminderPaymentDueAfterDowntime(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newTaxServer(t)
+	srv.set("100", "0", "0")
+	log := new(reminderLog)
+	scheduler := NewTaxReminderScheduler(client, log, WithTaxReminderDays(10, 2, -1))
+
+	scheduler.now = at(27)
+	checkReminders(t, scheduler, log, "tax.payment_due 100 1")
+}
+
+// Tax periods and due dates are Moscow ones whatever the client's location:
+// past midnight in Vladivostok it is still the day before the due date.
+func TestTaxReminderClientLocation(t *testing.T) {
+	t.Parallel()
+
+	vladivostok, err := time.LoadLocation("Asia/Vladivostok")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	client, srv := newTaxServer(t)
+	client.location = vladivostok
+	srv.set("100", "0", "0")
+	log := new(reminderLog)
+	scheduler := NewTaxReminderScheduler(client, log, WithTaxReminderDays(1, 0))
+
+	scheduler.now = func() time.Time { return time.Date(2024, time.October, 27, 15, 0, 0, 0, time.UTC) }
+	checkReminders(t, scheduler, log, "tax.payment_due 100 1")
+}
+
+func TestTaxReminderDebtAndPenalty(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newTaxServer(t)
+	log := new(reminderLog)
+	scheduler := NewTaxReminderScheduler(client, log)
+	scheduler.now = at(1)
+
+	checkReminders(t, scheduler, log)
+	srv.set("0", "500", "12.34")
+	checkReminders(t, scheduler, log, "tax.debt 500 0", "tax.penalty 12.34 0")
+	checkReminders(t, scheduler, log)
+
+	// Growing debt and accruing penalties are not news within the period.
+	srv.set("0", "700", "12.5")
+	checkReminders(t, scheduler, log)
+
+	// A debt paid off and incurred again is notified again.
+	srv.set("0", "0", "0")
+	checkReminders(t, scheduler, log)
+	srv.set("0", "700", "0")
+	checkReminders(t, scheduler, log, "tax.debt 700 0")
+
+	// So is a debt still unpaid in the next period.
+	srv.mu.Lock()
+	srv.period = 202410
+	srv.mu.Unlock()
+	checkReminders(t, scheduler, log, "tax.debt 700 0")
+	checkReminders(t, scheduler, log)
+}
+
+func TestTaxReminderRetriesFailedNotifications(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newTaxServer(t)
+	srv.set("0", "500", "0")
+	log := new(reminderLog)
+	scheduler := NewTaxReminderScheduler(client, log)
+	scheduler.now = at(1)
+
+	checkReminders(t, scheduler, log, "tax.debt 500 0")
+
+	srv.set("0", "500", "10")
+	log.fail = true
+	if err := scheduler.Check(context.Background()); err == nil {
+		t.Fatal("want the notifier error")
+	}
+	log.fail = false
+	checkReminders(t, scheduler, log, "tax.penalty 10 0")
+}
+
+// The state must keep a restarted scheduler from repeating itself.
+func TestTaxReminderFileStore(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newTaxServer(t)
+	srv.set("0", "500", "0")
+	log := new(reminderLog)
+	store := NewFileTaxReminderStore(filepath.Join(t.TempDir(), "reminders.json"))
+
+	first := NewTaxReminderScheduler(client, log, WithTaxReminderStore(store))
+	first.now = at(1)
+	checkReminders(t, first, log, "tax.debt 500 0")
+
+	restarted := NewTaxReminderScheduler(client, log, WithTaxReminderStore(store))
+	restarted.now = at(2)
+	checkReminders(t, restarted, log)
+}
+
+func TestTaxReminderNilNotifier(t *testing.T) {
+	t.Parallel()
+
+	scheduler := NewTaxReminderScheduler(setupNoRequest(t), nil)
+	assertLocalError(t, scheduler.Check(context.Background()))
+	assertLocalError(t, scheduler.Run(context.Background()))
+}
+
+// A failed check must be reported and retried, not stop Run.
+func TestTaxReminderRunSurvivesFailures(t *testing.T) {
+	t.Parallel()
+
+	client, srv := newTaxServer(t)
+	srv.set("0", "500", "0")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		attempts  int
+		failures  []error
+		delivered []TaxReminderType
+	)
+	notifier := NotifierFunc(func(_ context.Context, reminder *TaxReminder) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			return errors.New("notifier unavailable")
+		}
+		delivered = append(delivered, reminder.Type)
+		cancel()
+
+		return nil
+	})
+	scheduler := NewTaxReminderScheduler(
+		client, notifier,
+		WithTaxReminderInterval(time.Millisecond),
+		WithTaxReminderErrorHandler(func(_ context.Context, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			failures = append(failures, err)
+		}),
+	)
+	scheduler.now = at(1)
+
+	if err := scheduler.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v, want it to stop only when ctx is done", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failures) != 1 || len(delivered) != 1 || delivered[0] != TaxDebtAppeared {
+		t.Errorf("failures = %v, delivered = %v, want one failure then the debt reminder", failures, delivered)
+	}
+}
@@ -5,10 +5,33 @@
 	"strconv"
 	"strings"
 	"time"
+	_ "time/tzdata" // Europe/Moscow must load on hosts without a zoneinfo database.
 
 	"github.com/pkg/errors"
 )
 
+// moscowLocationName is the time zone the API and the tax authority reason in.
+const moscowLocationName = "Europe/Moscow"
+
+// moscow is loaded once; the embedded tzdata makes a failure practically
+// impossible, but the fixed offset Moscow has kept since 2014 stands in.
+var moscow = loadMoscow()
+
+func loadMoscow() *time.Location {
+	loc, err := time.LoadLocation(moscowLocationName)
+	if err != nil {
+		return time.FixedZone("MSK", 3*60*60)
+	}
+
+	return loc
+}
+
+// MoscowLocation returns the Europe/Moscow time zone, the default of
+// WithLocation.
+func MoscowLocation() *time.Location {
+	return moscow
+}
+
 // timeLayouts lists every timestamp shape the API has been observed to emit.
 // Responses mix full RFC 3339 timestamps with bare dates ("2022-11-12").
 var timeLayouts = []string{
@@ -23,6 +46,11 @@
 // Time wraps time.Time to decode the several timestamp formats the API mixes,
 // and to encode requests in the format it expects (RFC 3339, second precision).
 // A JSON null decodes to the zero Time and a zero Time encodes back to null.
+//
+// Timestamps without a zone, bare dates included, are Moscow wall-clock times:
+// that is what the API emits, whatever the client's WithLocation. Time encodes
+// in the location it carries; the request builders move it to the client's
+// location first.
 type Time struct {
 	time.Time
 }
@@ -42,7 +70,7 @@ func (t *Time) UnmarshalJSON(data []byte) error {
 	}
 
 	for _, layout := range timeLayouts {
-		parsed, err := time.Parse(layout, raw)
+		parsed, err := time.ParseInLocation(layout, raw, moscow)
 		if err == nil {
 			t.Time = parsed
 
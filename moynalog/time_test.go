@@ -26,14 +26,14 @@ func TestTimeUnmarshalJSON(t *testing.T) {
 			want: time.Date(2022, time.March, 30, 22, 46, 6, 0, time.FixedZone("", 2*60*60)),
 		},
 		{
-			name: "bare date",
+			name: "bare date, in Moscow",
 			raw:  `"2022-11-12"`,
-			want: time.Date(2022, time.November, 12, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2022, time.November, 12, 0, 0, 0, 0, MoscowLocation()),
 		},
 		{
-			name: "timestamp without a zone",
+			name: "timestamp without a zone, in Moscow",
 			raw:  `"2021-01-27T22:38:30.057957"`,
-			want: time.Date(2021, time.January, 27, 22, 38, 30, 57957000, time.UTC),
+			want: time.Date(2021, time.January, 27, 22, 38, 30, 57957000, MoscowLocation()),
 		},
 	}
 
@@ -0,0 +1,43 @@
+package moynalog
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/shoman4eg/go-moy-nalog/validate"
+)
+
+// validateINN checks inn with validate.INN, naming the INN what in the error.
+func validateINN(inn, what string) error {
+	return argumentOf(validate.INN(inn), what)
+}
+
+// normalizePhone normalizes phone with validate.NormalizePhone.
+func normalizePhone(phone string) (string, error) {
+	normalized, err := validate.NormalizePhone(phone)
+
+	return normalized, argumentOf(err, "phone")
+}
+
+// argumentOf turns an error of the validate package into one matching
+// ErrInvalidArgument, naming the value checked what.
+func argumentOf(err error, what string) error {
+	var invalid *validate.Error
+	if errors.As(err, &invalid) {
+		return invalidArgument("moynalog: %s %s", what, invalid.Reason)
+	}
+
+	return err
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
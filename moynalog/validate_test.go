@@ -0,0 +1,68 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// Create and Invoice.Create reject bad counterparties before any request.
+func TestCounterpartyValidationEnforced(t *testing.T) {
+	t.Parallel()
+
+	client := setupNoRequest(t)
+	for _, buyer := range []*IncomeClient{
+		{IncomeType: IncomeTypeLegalEntity, Inn: "7707083894", DisplayName: "ООО"},
+		{Inn: "500100732258"},
+		{ContactPhone: "12345"},
+	} {
+		_, _, err := client.Income.Create(context.Background(), &IncomeCreateRequest{
+			Services: []IncomeServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(1), Quantity: decimal.NewFromInt(1)}},
+			Client:   buyer,
+		})
+		assertLocalError(t, err)
+
+		_, _, err = client.Invoice.Create(context.Background(), &InvoiceCreateRequest{
+			Services: []InvoiceServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(1), Quantity: decimal.NewFromInt(1)}},
+			Client:   buyer,
+		})
+		assertLocalError(t, err)
+	}
+}
+
+// The phone goes out in E.164 without touching the caller's client.
+func TestCreateSendsNormalizedPhone(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	for _, path := range []string{"/v1/income", "/v1/invoice"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			buyer, _ := testBody(t, r)["client"].(map[string]any)
+			if buyer["contactPhone"] != "+79001234567" {
+				t.Errorf("%s: contactPhone = %v, want +79001234567", r.URL.Path, buyer["contactPhone"])
+			}
+			writeJSON(t, w, http.StatusOK, `{"approvedReceiptUuid":"r1","invoiceId":1}`)
+		})
+	}
+
+	buyer := &IncomeClient{ContactPhone: "8 (900) 123-45-67"}
+	_, _, err := client.Income.Create(context.Background(), &IncomeCreateRequest{
+		Services: []IncomeServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(1), Quantity: decimal.NewFromInt(1)}},
+		Client:   buyer,
+	})
+	if err != nil {
+		t.Fatalf("Income.Create: %v", err)
+	}
+	_, _, err = client.Invoice.Create(context.Background(), &InvoiceCreateRequest{
+		Services: []InvoiceServiceItem{{Name: "Услуга", Amount: decimal.NewFromInt(1), Quantity: decimal.NewFromInt(1)}},
+		Client:   buyer,
+	})
+	if err != nil {
+		t.Fatalf("Invoice.Create: %v", err)
+	}
+	if buyer.ContactPhone != "8 (900) 123-45-67" {
+		t.Errorf("ContactPhone = %q, the caller's client must not be modified", buyer.ContactPhone)
+	}
+}
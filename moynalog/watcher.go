@@ -0,0 +1,393 @@
+package moynalog
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultWatcherInterval is how often a Watcher polls the listing.
+	defaultWatcherInterval = time.Minute
+	// defaultWatcherLookback is how far back by operation time a Watcher looks
+	// for new receipts and cancellations.
+	defaultWatcherLookback = 31 * 24 * time.Hour
+	// maxWatcherBackoff caps the delay Run doubles after every failed poll.
+	maxWatcherBackoff = 15 * time.Minute
+)
+
+// ReceiptEventType is the kind of change a Watcher reports.
+type ReceiptEventType string
+
+// Supported receipt event types.
+const (
+	ReceiptRegistered ReceiptEventType = "receipt.registered"
+	ReceiptCancelled  ReceiptEventType = "receipt.cancelled"
+)
+
+// ReceiptEvent is a single change of a receipt.
+type ReceiptEvent struct {
+	Type ReceiptEventType
+	// Receipt is the receipt as listed when the change was noticed.
+	Receipt *IncomeListItem
+	// OccurredAt is when the API registered the change.
+	OccurredAt time.Time
+}
+
+// WatchedReceipt is the last state a Watcher saw a receipt in.
+type WatchedReceipt struct {
+	OperationTime time.Time `json:"operationTime"`
+	Cancelled     bool      `json:"cancelled"`
+}
+
+// WatcherCheckpoint is the state a Watcher resumes from. It only grows with the
+// receipts inside the lookback window, so it stays small.
+type WatcherCheckpoint struct {
+	// Receipts maps the receipt UUID onto the state it was last seen in.
+	Receipts map[string]WatchedReceipt `json:"receipts"`
+	// PolledAt is when the checkpoint was taken; zero before the first poll.
+	PolledAt time.Time `json:"polledAt"`
+}
+
+// CheckpointStore persists the checkpoint of a Watcher. Implementations must be
+// safe for concurrent use.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the stored checkpoint, or nil when there is none.
+	LoadCheckpoint(ctx context.Context) (*WatcherCheckpoint, error)
+	// SaveCheckpoint replaces the stored checkpoint.
+	SaveCheckpoint(ctx context.Context, checkpoint *WatcherCheckpoint) error
+}
+
+// MemoryCheckpointStore keeps the checkpoint in memory only, so a restart
+// starts over from a fresh baseline. The zero value is ready to use.
+type MemoryCheckpointStore struct {
+	mu         sync.Mutex
+	checkpoint *WatcherCheckpoint
+}
+
+// LoadCheckpoint implements CheckpointStore.
+func (s *MemoryCheckpointStore) LoadCheckpoint(context.Context) (*WatcherCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkpoint.clone(), nil
+}
+
+// SaveCheckpoint implements CheckpointStore.
+func (s *MemoryCheckpointStore) SaveCheckpoint(_ context.Context, checkpoint *WatcherCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoint = checkpoint.clone()
+
+	return nil
+}
+
+// FileCheckpointStore keeps the checkpoint in a JSON file, rewritten
+// atomically on every save.
+type FileCheckpointStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileCheckpointStore returns a store backed by the file at path. The file
+// is created on the first save.
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// LoadCheckpoint implements CheckpointStore.
+func (s *FileCheckpointStore) LoadCheckpoint(context.Context) (*WatcherCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var checkpoint *WatcherCheckpoint
+	if err := readJSONFile(s.path, &checkpoint); err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+// SaveCheckpoint implements CheckpointStore.
+func (s *FileCheckpointStore) SaveCheckpoint(_ context.Context, checkpoint *WatcherCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeJSONFile(s.path, checkpoint)
+}
+
+func (c *WatcherCheckpoint) clone() *WatcherCheckpoint {
+	if c == nil {
+		return nil
+	}
+
+	clone := &WatcherCheckpoint{
+		Receipts: make(map[string]WatchedReceipt, len(c.Receipts)),
+		PolledAt: c.PolledAt,
+	}
+	for uuid, state := range c.Receipts {
+		clone.Receipts[uuid] = state
+	}
+
+	return clone
+}
+
+// Watcher polls the receipt listing and reports receipts registered or
+// cancelled since the previous poll, wherever they were created: through this
+// library, the mobile app or the web portal.
+//
+// Events are delivered at least once: the checkpoint only moves past an event
+// once its handler succeeded.
+type Watcher struct {
+	income       *IncomeService
+	store        CheckpointStore
+	interval     time.Duration
+	lookback     time.Duration
+	emitExisting bool
+	onError      func(ctx context.Context, err error)
+	now          func() time.Time
+
+	// mu serialises polls, which read and write the checkpoint.
+	mu sync.Mutex
+}
+
+// WatcherOption customises a Watcher.
+type WatcherOption func(*Watcher)
+
+// WithWatcherCheckpointStore sets where the watcher persists its progress.
+// Defaults to a MemoryCheckpointStore.
+func WithWatcherCheckpointStore(store CheckpointStore) WatcherOption {
+	return func(w *Watcher) {
+		if store != nil {
+			w.store = store
+		}
+	}
+}
+
+// WithWatcherInterval sets how often Run polls. Defaults to one minute.
+func WithWatcherInterval(interval time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		if interval > 0 {
+			w.interval = interval
+		}
+	}
+}
+
+// WithWatcherLookback sets how far back by operation time each poll looks.
+// Receipts registered with an older operation time, and cancellations of such
+// receipts, are not reported. Defaults to 31 days.
+func WithWatcherLookback(lookback time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		if lookback > 0 {
+			w.lookback = lookback
+		}
+	}
+}
+
+// WithWatcherEmitExisting makes the very first poll report every receipt in
+// the lookback window. By default it silently records them as the baseline.
+func WithWatcherEmitExisting(emitExisting bool) WatcherOption {
+	return func(w *Watcher) {
+		w.emitExisting = emitExisting
+	}
+}
+
+// WithWatcherErrorHandler reports every poll of Run that failed, for logging.
+// Run carries on after a failed poll either way.
+func WithWatcherErrorHandler(onError func(ctx context.Context, err error)) WatcherOption {
+	return func(w *Watcher) {
+		w.onError = onError
+	}
+}
+
+// NewWatcher returns a watcher of the receipts visible to client.
+func NewWatcher(client *Client, opts ...WatcherOption) *Watcher {
+	w := &Watcher{
+		income:   client.Income,
+		store:    new(MemoryCheckpointStore),
+		interval: defaultWatcherInterval,
+		lookback: defaultWatcherLookback,
+		now:      time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// ReceiptEventHandler handles a single receipt event. Returning an error stops
+// the poll; the event is delivered again by the next one.
+type ReceiptEventHandler func(ctx context.Context, event ReceiptEvent) error
+
+// Poll lists the receipts once, hands every change since the checkpoint to
+// handler in the order the API registered them, and advances the checkpoint.
+func (w *Watcher) Poll(ctx context.Context, handler ReceiptEventHandler) error {
+	if handler == nil {
+		return invalidArgument("moynalog: receipt event handler cannot be nil")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	checkpoint, err := w.store.LoadCheckpoint(ctx)
+	if err != nil {
+		return err
+	}
+	baseline := checkpoint == nil
+	if baseline {
+		checkpoint = &WatcherCheckpoint{Receipts: map[string]WatchedReceipt{}}
+	}
+	if checkpoint.Receipts == nil {
+		checkpoint.Receipts = map[string]WatchedReceipt{}
+	}
+
+	now := w.now()
+	windowStart := now.Add(-w.lookback)
+
+	var listed []*IncomeListItem
+	opts := IncomeListOptions{
+		From:   NewTime(windowStart),
+		Limit:  maxListLimit,
+		SortBy: SortByOperationTimeDesc,
+	}
+	err = w.income.walk(ctx, opts, func(item *IncomeListItem) bool {
+		listed = append(listed, item)
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	events := diffReceipts(checkpoint.Receipts, listed)
+	if baseline && !w.emitExisting {
+		events = nil
+	}
+
+	next := checkpoint.clone()
+	for _, event := range events {
+		if err := handler(ctx, event); err != nil {
+			// Remember what was delivered so far, and nothing past it.
+			if saveErr := w.store.SaveCheckpoint(ctx, next); saveErr != nil {
+				return errors.Wrap(err, saveErr.Error())
+			}
+
+			return err
+		}
+		next.Receipts[event.Receipt.ApprovedReceiptUUID] = watchedState(event.Receipt, event.Type)
+	}
+
+	// Everything listed is now accounted for; forget what left the window.
+	for _, item := range listed {
+		next.Receipts[item.ApprovedReceiptUUID] = watchedState(item, "")
+	}
+	for uuid, state := range next.Receipts {
+		if state.OperationTime.Before(windowStart) {
+			delete(next.Receipts, uuid)
+		}
+	}
+	next.PolledAt = now
+
+	return w.store.SaveCheckpoint(ctx, next)
+}
+
+// diffReceipts returns the changes between the known states and the listed
+// receipts, oldest first.
+func diffReceipts(known map[string]WatchedReceipt, listed []*IncomeListItem) []ReceiptEvent {
+	var events []ReceiptEvent
+	for _, item := range listed {
+		state, seen := known[item.ApprovedReceiptUUID]
+		if !seen {
+			events = append(events, ReceiptEvent{
+				Type:       ReceiptRegistered,
+				Receipt:    item,
+				OccurredAt: item.RegisterTime.Time,
+			})
+		}
+		if item.Cancelled() && (!seen || !state.Cancelled) {
+			events = append(events, ReceiptEvent{
+				Type:       ReceiptCancelled,
+				Receipt:    item,
+				OccurredAt: item.CancellationInfo.RegisterTime.Time,
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].OccurredAt.Before(events[j].OccurredAt)
+	})
+
+	return events
+}
+
+// watchedState is the state item is in once an event of type eventType has
+// been delivered. A registration delivered ahead of a pending cancellation
+// leaves the receipt active, so the cancellation is delivered again on retry.
+func watchedState(item *IncomeListItem, eventType ReceiptEventType) WatchedReceipt {
+	return WatchedReceipt{
+		OperationTime: item.OperationTime.Time,
+		Cancelled:     item.Cancelled() && eventType != ReceiptRegistered,
+	}
+}
+
+// Run polls immediately and then every interval until ctx is done, and returns
+// ctx.Err(). A failed poll, a maintenance window of the API or a handler error
+// for instance, is reported to the WithWatcherErrorHandler handler and
+// retried, the delay doubling with every failure in a row up to 15 minutes.
+// Only a nil handler stops Run straight away.
+func (w *Watcher) Run(ctx context.Context, handler ReceiptEventHandler) error {
+	if handler == nil {
+		return invalidArgument("moynalog: receipt event handler cannot be nil")
+	}
+
+	delay := w.interval
+	for {
+		if err := w.Poll(ctx, handler); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if w.onError != nil {
+				w.onError(ctx, err)
+			}
+			delay = max(min(delay*2, maxWatcherBackoff), w.interval)
+		} else {
+			delay = w.interval
+		}
+
+		if err := waitBackoff(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Events runs the watcher in the background and delivers its events on the
+// returned channel. Failed polls go to the WithWatcherErrorHandler handler, as
+// with Run; the error that stopped it, ctx.Err(), is sent on the error channel
+// before both channels are closed. An event counts as
+// delivered once it has been received from the channel.
+func (w *Watcher) Events(ctx context.Context) (<-chan ReceiptEvent, <-chan error) {
+	events := make(chan ReceiptEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		errs <- w.Run(ctx, func(ctx context.Context, event ReceiptEvent) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	return events, errs
+}
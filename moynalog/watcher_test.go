@@ -0,0 +1,262 @@
+package moynalog
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// watcherServer serves whatever listing the returned setter was last given.
+func watcherServer(t *testing.T, mux *http.ServeMux) func(content string) {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		listing = `[]`
+	)
+	mux.HandleFunc("/v1/incomes", func(w http.ResponseWriter, r *http.Request) {
+		testQuery(t, r, map[string]string{"sortBy": string(SortByOperationTimeDesc)})
+		if r.URL.Query().Get("from") == "" {
+			t.Error("the watcher must bound the listing with from")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		writeJSON(t, w, http.StatusOK, `{"hasMore":false,"content":`+listing+`}`)
+	})
+
+	return func(content string) {
+		mu.Lock()
+		defer mu.Unlock()
+		listing = content
+	}
+}
+
+// recentReceipt lists a receipt operated an hour ago, optionally cancelled.
+func recentReceipt(uuid string, registered time.Time, cancelled bool) string {
+	operation := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	item := `{"approvedReceiptUuid":"` + uuid + `","operationTime":"` + operation +
+		`","registerTime":"` + registered.Format(time.RFC3339) + `"`
+	if cancelled {
+		item += `,"cancellationInfo":{"registerTime":"` + registered.Add(time.Minute).Format(time.RFC3339) +
+			`","comment":"Чек сформирован ошибочно"}`
+	}
+
+	return item + `}`
+}
+
+func collectEvents(events *[]ReceiptEvent) ReceiptEventHandler {
+	return func(_ context.Context, event ReceiptEvent) error {
+		*events = append(*events, event)
+
+		return nil
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	setListing := watcherServer(t, mux)
+	ctx := context.Background()
+	base := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+
+	watcher := NewWatcher(client)
+	setListing(`[` + recentReceipt("old", base, false) + `]`)
+
+	var events []ReceiptEvent
+	if err := watcher.Poll(ctx, collectEvents(&events)); err != nil {
+		t.Fatalf("first Poll: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("first Poll emitted %d events, want the baseline to be silent", len(events))
+	}
+
+	setListing(`[` + recentReceipt("new", base.Add(2*time.Minute), false) + `,` + recentReceipt("old", base, true) + `]`)
+	if err := watcher.Poll(ctx, collectEvents(&events)); err != nil {
+		t.Fatalf("second Poll: %v", err)
+	}
+
+	want := []struct {
+		eventType ReceiptEventType
+		uuid      string
+	}{
+		{ReceiptCancelled, "old"},
+		{ReceiptRegistered, "new"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("second Poll emitted %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		if events[i].Type != w.eventType || events[i].Receipt.ApprovedReceiptUUID != w.uuid {
+			t.Errorf("events[%d] = %s %s, want %s %s", i, events[i].Type, events[i].Receipt.ApprovedReceiptUUID, w.eventType, w.uuid)
+		}
+	}
+
+	events = nil
+	if err := watcher.Poll(ctx, collectEvents(&events)); err != nil {
+		t.Fatalf("third Poll: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("an unchanged listing emitted %d events, want none", len(events))
+	}
+}
+
+func TestWatcherEmitExisting(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	setListing := watcherServer(t, mux)
+	setListing(`[` + recentReceipt("r1", time.Now().Add(-time.Hour), true) + `]`)
+
+	var events []ReceiptEvent
+	err := NewWatcher(client, WithWatcherEmitExisting(true)).Poll(context.Background(), collectEvents(&events))
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != ReceiptRegistered || events[1].Type != ReceiptCancelled {
+		t.Errorf("events = %+v, want a registration followed by a cancellation", events)
+	}
+}
+
+// A failing handler must not lose the event: the next poll delivers it again.
+func TestWatcherRedeliversAfterHandlerError(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	setListing := watcherServer(t, mux)
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	watcher := NewWatcher(client, WithWatcherCheckpointStore(NewFileCheckpointStore(path)))
+	if err := watcher.Poll(ctx, collectEvents(new([]ReceiptEvent))); err != nil {
+		t.Fatalf("baseline Poll: %v", err)
+	}
+
+	setListing(`[` + recentReceipt("r1", time.Now().Add(-time.Minute), true) + `]`)
+
+	errBroken := errors.New("handler is broken")
+	var delivered []ReceiptEvent
+	err := watcher.Poll(ctx, func(_ context.Context, event ReceiptEvent) error {
+		if event.Type == ReceiptCancelled {
+			return errBroken
+		}
+		delivered = append(delivered, event)
+
+		return nil
+	})
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("Poll error = %v, want the handler error", err)
+	}
+
+	// A watcher restarted from the same checkpoint only redelivers what failed.
+	restarted := NewWatcher(client, WithWatcherCheckpointStore(NewFileCheckpointStore(path)))
+	if err := restarted.Poll(ctx, collectEvents(&delivered)); err != nil {
+		t.Fatalf("Poll after restart: %v", err)
+	}
+	if len(delivered) != 2 || delivered[0].Type != ReceiptRegistered || delivered[1].Type != ReceiptCancelled {
+		t.Errorf("delivered = %+v, want the registration once and then the cancellation", delivered)
+	}
+}
+
+func TestWatcherEvents(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	setListing := watcherServer(t, mux)
+	setListing(`[` + recentReceipt("r1", time.Now().Add(-time.Minute), false) + `]`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := NewWatcher(client, WithWatcherEmitExisting(true), WithWatcherInterval(10*time.Millisecond))
+	events, errs := watcher.Events(ctx)
+
+	select {
+	case event := <-events:
+		if event.Type != ReceiptRegistered || event.Receipt.ApprovedReceiptUUID != "r1" {
+			t.Errorf("event = %s %s, want %s r1", event.Type, event.Receipt.ApprovedReceiptUUID, ReceiptRegistered)
+		}
+	case err := <-errs:
+		t.Fatalf("watcher stopped: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered")
+	}
+
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("stop error = %v, want context.Canceled", err)
+	}
+	if _, open := <-events; open {
+		t.Error("the events channel must be closed once the watcher stops")
+	}
+}
+
+// A failed poll, a 5xx during maintenance say, must be reported and retried
+// rather than stop the watcher.
+func TestWatcherRunSurvivesFailures(t *testing.T) {
+	t.Parallel()
+
+	client, mux := setupAuthed(t)
+	var (
+		mu       sync.Mutex
+		polls    int
+		failures []error
+	)
+	mux.HandleFunc("/v1/incomes", func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		polls++
+		failing := polls <= 2
+		mu.Unlock()
+
+		if failing {
+			writeJSON(t, w, http.StatusServiceUnavailable, `{"message":"maintenance"}`)
+
+			return
+		}
+		writeJSON(t, w, http.StatusOK, `{"hasMore":false,"content":[`+recentReceipt("r1", time.Now().Add(-time.Minute), false)+`]}`)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := NewWatcher(
+		client,
+		WithWatcherEmitExisting(true),
+		WithWatcherInterval(time.Millisecond),
+		WithWatcherErrorHandler(func(_ context.Context, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			failures = append(failures, err)
+		}),
+	)
+
+	var events []ReceiptEvent
+	err := watcher.Run(ctx, func(_ context.Context, event ReceiptEvent) error {
+		events = append(events, event)
+		cancel()
+
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v, want it to stop only when ctx is done", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failures) != 2 || len(events) != 1 || events[0].Receipt.ApprovedReceiptUUID != "r1" {
+		t.Errorf("failures = %v, events = %+v, want two failures then r1", failures, events)
+	}
+}
+
+func TestWatcherRunNilHandler(t *testing.T) {
+	t.Parallel()
+
+	assertLocalError(t, NewWatcher(setupNoRequest(t)).Run(context.Background(), nil))
+}
@@ -0,0 +1,513 @@
+package moynalog
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Headers set on every webhook delivery.
+const (
+	// WebhookSignatureHeader carries "sha256=" followed by the hex encoded
+	// HMAC-SHA256 of the request body, keyed with the endpoint secret.
+	WebhookSignatureHeader = "X-Moynalog-Signature"
+	// WebhookEventHeader carries the event type.
+	WebhookEventHeader = "X-Moynalog-Event"
+	// WebhookDeliveryHeader carries the event ID, which stays the same across
+	// retries so receivers can deduplicate.
+	WebhookDeliveryHeader = "X-Moynalog-Delivery"
+
+	webhookSignaturePrefix = "sha256="
+
+	defaultWebhookAttempts = 5
+	defaultWebhookBackoff  = time.Second
+	maxWebhookBackoff      = time.Minute
+	defaultWebhookTimeout  = 10 * time.Second
+	webhookEventIDBytes    = 16
+)
+
+// WebhookEvent is the JSON payload posted to webhook endpoints.
+type WebhookEvent struct {
+	// ID identifies the event. It is derived from the receipt and the event
+	// type, so retries and repeated dispatches of the same change reuse it.
+	ID          string           `json:"id"`
+	Type        ReceiptEventType `json:"type"`
+	OccurredAt  time.Time        `json:"occurredAt"`
+	ReceiptUUID string           `json:"receiptUuid"`
+	// Receipt is the listed receipt, when the event came from a Watcher.
+	Receipt *IncomeListItem `json:"receipt,omitempty"`
+	// CancellationInfo is set on cancellation events.
+	CancellationInfo *CancellationInfo `json:"cancellationInfo,omitempty"`
+}
+
+// NewWebhookEvent returns an event of eventType about receiptUUID. Its ID
+// depends on both only, so a Watcher delivering the same change twice sends
+// the same X-Moynalog-Delivery and receivers can deduplicate.
+func NewWebhookEvent(eventType ReceiptEventType, receiptUUID string) (*WebhookEvent, error) {
+	if receiptUUID == "" {
+		return nil, errors.New("moynalog: webhook event needs a receipt UUID")
+	}
+
+	sum := sha256.Sum256([]byte(string(eventType) + ":" + receiptUUID))
+
+	return &WebhookEvent{
+		ID:          hex.EncodeToString(sum[:webhookEventIDBytes]),
+		Type:        eventType,
+		OccurredAt:  time.Now(),
+		ReceiptUUID: receiptUUID,
+	}, nil
+}
+
+// WebhookEndpoint is a receiver of webhook deliveries.
+type WebhookEndpoint struct {
+	// URL receives the POST requests.
+	URL string
+	// Secret keys the HMAC signature. Required.
+	Secret string
+	// Events limits the deliveries to these types. Empty means every type.
+	Events []ReceiptEventType
+}
+
+// Validate checks that the endpoint has an absolute HTTP(S) URL and a secret.
+func (e *WebhookEndpoint) Validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("moynalog: webhook endpoint URL %q must be an absolute HTTP(S) URL", e.URL)
+	}
+	if e.Secret == "" {
+		return errors.Errorf("moynalog: webhook endpoint %s has no secret", e.URL)
+	}
+
+	return nil
+}
+
+func (e *WebhookEndpoint) subscribed(eventType ReceiptEventType) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range e.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery records a single delivery attempt.
+type WebhookDelivery struct {
+	EventID    string
+	EventType  ReceiptEventType
+	URL        string
+	Attempt    int
+	StatusCode int
+	// Err describes why the attempt failed; empty on success.
+	Err      string
+	Duration time.Duration
+	At       time.Time
+}
+
+// WebhookDeadLetter is an event an endpoint never accepted.
+type WebhookDeadLetter struct {
+	Event     *WebhookEvent
+	URL       string
+	Attempts  int
+	LastError string
+	FailedAt  time.Time
+}
+
+// WebhookDeliveryLog records delivery attempts. Implementations must be safe
+// for concurrent use.
+type WebhookDeliveryLog interface {
+	// RecordDelivery records a single attempt.
+	RecordDelivery(ctx context.Context, delivery *WebhookDelivery)
+}
+
+// WebhookDeadLetterQueue keeps the events that exhausted their attempts.
+// Implementations must be safe for concurrent use.
+type WebhookDeadLetterQueue interface {
+	// PushDeadLetter stores a failed delivery.
+	PushDeadLetter(ctx context.Context, letter *WebhookDeadLetter) error
+}
+
+// MemoryWebhookDeliveryLog keeps every delivery attempt in memory. The zero
+// value is ready to use.
+type MemoryWebhookDeliveryLog struct {
+	mu         sync.Mutex
+	deliveries []*WebhookDelivery
+}
+
+// RecordDelivery implements WebhookDeliveryLog.
+func (l *MemoryWebhookDeliveryLog) RecordDelivery(_ context.Context, delivery *WebhookDelivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.deliveries = append(l.deliveries, delivery)
+}
+
+// Deliveries returns the recorded attempts, oldest first.
+func (l *MemoryWebhookDeliveryLog) Deliveries() []*WebhookDelivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]*WebhookDelivery(nil), l.deliveries...)
+}
+
+// MemoryWebhookDeadLetterQueue keeps dead letters in memory. The zero value is
+// ready to use.
+type MemoryWebhookDeadLetterQueue struct {
+	mu      sync.Mutex
+	letters []*WebhookDeadLetter
+}
+
+// PushDeadLetter implements WebhookDeadLetterQueue.
+func (q *MemoryWebhookDeadLetterQueue) PushDeadLetter(_ context.Context, letter *WebhookDeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.letters = append(q.letters, letter)
+
+	return nil
+}
+
+// Drain removes and returns every dead letter, oldest first.
+func (q *MemoryWebhookDeadLetterQueue) Drain() []*WebhookDeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letters := q.letters
+	q.letters = nil
+
+	return letters
+}
+
+// WebhookDispatcher posts signed receipt lifecycle events to the configured
+// endpoints, retrying failures with exponential backoff and dead-lettering
+// what never got through. It is safe for concurrent use.
+type WebhookDispatcher struct {
+	endpoints   []WebhookEndpoint
+	client      *http.Client
+	attempts    int
+	backoff     time.Duration
+	deadLetters WebhookDeadLetterQueue
+	log         WebhookDeliveryLog
+}
+
+// WebhookOption customises a WebhookDispatcher.
+type WebhookOption func(*WebhookDispatcher)
+
+// WithWebhookHTTPClient makes the dispatcher post through httpClient. The
+// default client times out after ten seconds.
+func WithWebhookHTTPClient(httpClient *http.Client) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		if httpClient != nil {
+			d.client = httpClient
+		}
+	}
+}
+
+// WithWebhookAttempts sets how many times a delivery is attempted before it is
+// dead-lettered. Defaults to 5.
+func WithWebhookAttempts(attempts int) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		if attempts > 0 {
+			d.attempts = attempts
+		}
+	}
+}
+
+// WithWebhookBackoff sets the delay before the first retry, which doubles with
+// every further one up to a minute. Defaults to one second.
+func WithWebhookBackoff(backoff time.Duration) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		if backoff > 0 {
+			d.backoff = backoff
+		}
+	}
+}
+
+// WithWebhookDeadLetterQueue sets where undeliverable events go. Defaults to a
+// MemoryWebhookDeadLetterQueue.
+func WithWebhookDeadLetterQueue(queue WebhookDeadLetterQueue) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		if queue != nil {
+			d.deadLetters = queue
+		}
+	}
+}
+
+// WithWebhookDeliveryLog records every delivery attempt in log. Nothing is
+// recorded by default.
+func WithWebhookDeliveryLog(log WebhookDeliveryLog) WebhookOption {
+	return func(d *WebhookDispatcher) {
+		d.log = log
+	}
+}
+
+// NewWebhookDispatcher returns a dispatcher posting to endpoints. It fails when
+// an endpoint does not validate, so nothing is ever signed with an empty key.
+func NewWebhookDispatcher(endpoints []WebhookEndpoint, opts ...WebhookOption) (*WebhookDispatcher, error) {
+	for i := range endpoints {
+		if err := endpoints[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &WebhookDispatcher{
+		endpoints:   append([]WebhookEndpoint(nil), endpoints...),
+		client:      &http.Client{Timeout: defaultWebhookTimeout},
+		attempts:    defaultWebhookAttempts,
+		backoff:     defaultWebhookBackoff,
+		deadLetters: new(MemoryWebhookDeadLetterQueue),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d, nil
+}
+
+// Dispatch posts event to every endpoint subscribed to its type. An endpoint
+// that keeps failing gets the event dead-lettered instead, so Dispatch only
+// fails when the event cannot be encoded or dead-lettered, or when ctx is done.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context, event *WebhookEvent) error {
+	if event == nil {
+		return errors.New("moynalog: webhook event cannot be nil")
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "moynalog: cannot encode webhook event")
+	}
+
+	for i := range d.endpoints {
+		endpoint := &d.endpoints[i]
+		if !endpoint.subscribed(event.Type) {
+			continue
+		}
+		if err := d.deliver(ctx, endpoint, event, body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DispatchCreated announces a receipt registered through IncomeService.Create.
+func (d *WebhookDispatcher) DispatchCreated(ctx context.Context, created *IncomeCreated) error {
+	if created == nil {
+		return errors.New("moynalog: created income cannot be nil")
+	}
+
+	event, err := NewWebhookEvent(ReceiptRegistered, created.ApprovedReceiptUUID)
+	if err != nil {
+		return err
+	}
+
+	return d.Dispatch(ctx, event)
+}
+
+// DispatchCancelled announces a receipt cancelled through IncomeService.Cancel.
+func (d *WebhookDispatcher) DispatchCancelled(ctx context.Context, cancelled *IncomeCancelled) error {
+	if cancelled == nil {
+		return errors.New("moynalog: cancelled income cannot be nil")
+	}
+
+	event, err := NewWebhookEvent(ReceiptCancelled, cancelled.ApprovedReceiptUUID)
+	if err != nil {
+		return err
+	}
+	event.CancellationInfo = cancelled.CancellationInfo
+	if info := cancelled.CancellationInfo; info != nil && !info.RegisterTime.IsZero() {
+		event.OccurredAt = info.RegisterTime.Time
+	}
+
+	return d.Dispatch(ctx, event)
+}
+
+// HandleReceiptEvent dispatches a Watcher event. Pass it to Watcher.Run to
+// forward every change the watcher notices.
+func (d *WebhookDispatcher) HandleReceiptEvent(ctx context.Context, receiptEvent ReceiptEvent) error {
+	if receiptEvent.Receipt == nil {
+		return errors.New("moynalog: receipt event has no receipt")
+	}
+
+	event, err := NewWebhookEvent(receiptEvent.Type, receiptEvent.Receipt.ApprovedReceiptUUID)
+	if err != nil {
+		return err
+	}
+	event.Receipt = receiptEvent.Receipt
+	event.CancellationInfo = receiptEvent.Receipt.CancellationInfo
+	if !receiptEvent.OccurredAt.IsZero() {
+		event.OccurredAt = receiptEvent.OccurredAt
+	}
+
+	return d.Dispatch(ctx, event)
+}
+
+// Redeliver makes a fresh series of attempts to deliver a dead letter to the
+// endpoint it failed on. The endpoint must still be configured.
+func (d *WebhookDispatcher) Redeliver(ctx context.Context, letter *WebhookDeadLetter) error {
+	if letter == nil || letter.Event == nil {
+		return errors.New("moynalog: dead letter cannot be empty")
+	}
+
+	for i := range d.endpoints {
+		if d.endpoints[i].URL != letter.URL {
+			continue
+		}
+
+		body, err := json.Marshal(letter.Event)
+		if err != nil {
+			return errors.Wrap(err, "moynalog: cannot encode webhook event")
+		}
+
+		return d.deliver(ctx, &d.endpoints[i], letter.Event, body)
+	}
+
+	return errors.Errorf("moynalog: webhook endpoint %q is not configured", letter.URL)
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, endpoint *WebhookEndpoint, event *WebhookEvent, body []byte) error {
+	var lastErr error
+	attempt := 0
+	for attempt < d.attempts {
+		attempt++
+		if attempt > 1 {
+			if err := waitBackoff(ctx, d.backoffFor(attempt)); err != nil {
+				return err
+			}
+		}
+
+		retriable, err := d.post(ctx, endpoint, event, body, attempt)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retriable {
+			break
+		}
+	}
+
+	letter := &WebhookDeadLetter{
+		Event:     event,
+		URL:       endpoint.URL,
+		Attempts:  attempt,
+		LastError: lastErr.Error(),
+		FailedAt:  time.Now(),
+	}
+	if err := d.deadLetters.PushDeadLetter(ctx, letter); err != nil {
+		return errors.Wrap(err, "moynalog: cannot dead-letter webhook event")
+	}
+
+	return nil
+}
+
+// post makes a single attempt and reports whether a failure is worth retrying.
+func (d *WebhookDispatcher) post(ctx context.Context, endpoint *WebhookEndpoint, event *WebhookEvent, body []byte, attempt int) (bool, error) {
+	delivery := &WebhookDelivery{
+		EventID:   event.ID,
+		EventType: event.Type,
+		URL:       endpoint.URL,
+		Attempt:   attempt,
+		At:        time.Now(),
+	}
+	defer func() {
+		delivery.Duration = time.Since(delivery.At)
+		if d.log != nil {
+			d.log.RecordDelivery(ctx, delivery)
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Err = err.Error()
+
+		return false, errors.Wrap(err, "moynalog: cannot create webhook request")
+	}
+	req.Header.Set("Content-Type", mediaTypeJSON)
+	req.Header.Set(WebhookEventHeader, string(event.Type))
+	req.Header.Set(WebhookDeliveryHeader, event.ID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(endpoint.Secret, body))
+
+	//nolint:gosec // G704: posting to the configured endpoints is the purpose
+	// of the dispatcher.
+	resp, err := d.client.Do(req)
+	if err != nil {
+		delivery.Err = err.Error()
+
+		return true, errors.Wrap(err, "moynalog: webhook delivery failed")
+	}
+	//nolint:gosec // G104: the body is drained only to reuse the connection.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	//nolint:gosec // G104: a close failure is not actionable here.
+	_ = resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+
+	delivery.Err = resp.Status
+	retriable := resp.StatusCode >= http.StatusInternalServerError ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout
+
+	return retriable, errors.Errorf("moynalog: webhook endpoint answered %s", resp.Status)
+}
+
+func (d *WebhookDispatcher) backoffFor(attempt int) time.Duration {
+	backoff := d.backoff
+	for i := 2; i < attempt && backoff < maxWebhookBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxWebhookBackoff)
+}
+
+// waitBackoff blocks for delay or until ctx is done.
+func waitBackoff(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// SignWebhook returns the WebhookSignatureHeader value for body.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature reports whether signature is the valid
+// WebhookSignatureHeader value for body. Receivers should call it before
+// trusting a delivery.
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, webhookSignaturePrefix) {
+		return false
+	}
+
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
@@ -0,0 +1,267 @@
+package moynalog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is a test endpoint answering with statuses in turn and
+// checking every request it gets.
+func webhookReceiver(t *testing.T, secret string, statuses ...int) (*httptest.Server, *atomic.Int32, chan *WebhookEvent) {
+	t.Helper()
+
+	var calls atomic.Int32
+	received := make(chan *WebhookEvent, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read webhook body: %v", err)
+		}
+		if !VerifyWebhookSignature(secret, body, r.Header.Get(WebhookSignatureHeader)) {
+			t.Errorf("signature %q does not verify", r.Header.Get(WebhookSignatureHeader))
+		}
+
+		event := new(WebhookEvent)
+		if err := json.Unmarshal(body, event); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+		if r.Header.Get(WebhookDeliveryHeader) != event.ID || r.Header.Get(WebhookEventHeader) != string(event.Type) {
+			t.Errorf("headers do not describe event %+v", event)
+		}
+		received <- event
+
+		status := http.StatusNoContent
+		if call <= len(statuses) {
+			status = statuses[call-1]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls, received
+}
+
+func newTestDispatcher(t *testing.T, endpoints []WebhookEndpoint, opts ...WebhookOption) *WebhookDispatcher {
+	t.Helper()
+
+	dispatcher, err := NewWebhookDispatcher(endpoints, opts...)
+	if err != nil {
+		t.Fatalf("NewWebhookDispatcher: %v", err)
+	}
+
+	return dispatcher
+}
+
+func TestWebhookDispatcherDispatchCreated(t *testing.T) {
+	t.Parallel()
+
+	server, calls, received := webhookReceiver(t, "s3cret")
+	log := new(MemoryWebhookDeliveryLog)
+	dispatcher := newTestDispatcher(
+		t,
+		[]WebhookEndpoint{{URL: server.URL, Secret: "s3cret"}},
+		WithWebhookDeliveryLog(log),
+	)
+
+	if err := dispatcher.DispatchCreated(context.Background(), &IncomeCreated{ApprovedReceiptUUID: "r1"}); err != nil {
+		t.Fatalf("DispatchCreated: %v", err)
+	}
+
+	if calls.Load() != 1 {
+		t.Fatalf("endpoint called %d times, want 1", calls.Load())
+	}
+	event := <-received
+	if event.Type != ReceiptRegistered || event.ReceiptUUID != "r1" || event.ID == "" {
+		t.Errorf("event = %+v, want a registration of r1 with an ID", event)
+	}
+
+	deliveries := log.Deliveries()
+	if len(deliveries) != 1 || deliveries[0].StatusCode != http.StatusNoContent || deliveries[0].Err != "" {
+		t.Errorf("deliveries = %+v, want one successful attempt", deliveries)
+	}
+}
+
+func TestWebhookDispatcherRetriesAndDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	flaky, flakyCalls, flakyEvents := webhookReceiver(t, "a", http.StatusBadGateway, http.StatusTooManyRequests)
+	down, downCalls, _ := webhookReceiver(t, "b",
+		http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	rejecting, rejectingCalls, _ := webhookReceiver(t, "c", http.StatusBadRequest)
+
+	queue := new(MemoryWebhookDeadLetterQueue)
+	log := new(MemoryWebhookDeliveryLog)
+	dispatcher := newTestDispatcher(
+		t,
+		[]WebhookEndpoint{
+			{URL: flaky.URL, Secret: "a"},
+			{URL: down.URL, Secret: "b"},
+			{URL: rejecting.URL, Secret: "c"},
+		},
+		WithWebhookAttempts(3),
+		WithWebhookBackoff(time.Millisecond),
+		WithWebhookDeadLetterQueue(queue),
+		WithWebhookDeliveryLog(log),
+	)
+
+	cancelled := &IncomeCancelled{
+		ApprovedReceiptUUID: "r1",
+		CancellationInfo:    &CancellationInfo{Comment: CancelCommentRefund},
+	}
+	if err := dispatcher.DispatchCancelled(context.Background(), cancelled); err != nil {
+		t.Fatalf("DispatchCancelled: %v", err)
+	}
+
+	if flakyCalls.Load() != 3 || downCalls.Load() != 3 {
+		t.Errorf("calls = %d and %d, want 3 attempts each", flakyCalls.Load(), downCalls.Load())
+	}
+	if rejectingCalls.Load() != 1 {
+		t.Errorf("a 4xx answer was retried %d times, want no retries", rejectingCalls.Load()-1)
+	}
+
+	// Retries resend the very same event.
+	first, second := <-flakyEvents, <-flakyEvents
+	if first.ID != second.ID {
+		t.Errorf("retry changed the event ID from %q to %q", first.ID, second.ID)
+	}
+	if first.CancellationInfo == nil || first.CancellationInfo.Comment != CancelCommentRefund {
+		t.Errorf("CancellationInfo = %+v, want the refund comment", first.CancellationInfo)
+	}
+
+	letters := queue.Drain()
+	if len(letters) != 2 || letters[0].URL != down.URL || letters[1].URL != rejecting.URL {
+		t.Fatalf("dead letters = %+v, want the down and the rejecting endpoint", letters)
+	}
+	if letters[0].Attempts != 3 || letters[0].LastError == "" {
+		t.Errorf("dead letter = %+v, want 3 attempts and the last error", letters[0])
+	}
+	if got := len(log.Deliveries()); got != 7 {
+		t.Errorf("logged %d attempts, want 7", got)
+	}
+
+	// The endpoint recovered: a redelivery goes through.
+	if err := dispatcher.Redeliver(context.Background(), letters[0]); err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if downCalls.Load() != 4 {
+		t.Errorf("Redeliver made %d attempts, want 1", downCalls.Load()-3)
+	}
+	if len(queue.Drain()) != 0 {
+		t.Error("a successful redelivery must not dead-letter again")
+	}
+}
+
+func TestWebhookDispatcherSubscriptions(t *testing.T) {
+	t.Parallel()
+
+	server, calls, received := webhookReceiver(t, "s")
+	dispatcher := newTestDispatcher(t, []WebhookEndpoint{
+		{URL: server.URL, Secret: "s", Events: []ReceiptEventType{ReceiptCancelled}},
+	})
+
+	receipt := &IncomeListItem{ApprovedReceiptUUID: "r1"}
+	ctx := context.Background()
+	if err := dispatcher.HandleReceiptEvent(ctx, ReceiptEvent{Type: ReceiptRegistered, Receipt: receipt}); err != nil {
+		t.Fatalf("HandleReceiptEvent: %v", err)
+	}
+	if calls.Load() != 0 {
+		t.Fatal("an unsubscribed event type must not be delivered")
+	}
+
+	occurred := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	err := dispatcher.HandleReceiptEvent(ctx, ReceiptEvent{Type: ReceiptCancelled, Receipt: receipt, OccurredAt: occurred})
+	if err != nil {
+		t.Fatalf("HandleReceiptEvent: %v", err)
+	}
+	event := <-received
+	if event.Receipt == nil || event.Receipt.ApprovedReceiptUUID != "r1" || !event.OccurredAt.Equal(occurred) {
+		t.Errorf("event = %+v, want the watched receipt and its time", event)
+	}
+}
+
+func TestWebhookDispatcherContextCancelled(t *testing.T) {
+	t.Parallel()
+
+	server, _, _ := webhookReceiver(t, "s", http.StatusServiceUnavailable)
+	queue := new(MemoryWebhookDeadLetterQueue)
+	dispatcher := newTestDispatcher(
+		t,
+		[]WebhookEndpoint{{URL: server.URL, Secret: "s"}},
+		WithWebhookBackoff(time.Hour),
+		WithWebhookDeadLetterQueue(queue),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := dispatcher.DispatchCreated(ctx, &IncomeCreated{ApprovedReceiptUUID: "r1"}); err == nil {
+		t.Error("want the context error while waiting to retry")
+	}
+	if len(queue.Drain()) != 0 {
+		t.Error("an interrupted delivery must not be dead-lettered")
+	}
+}
+
+func TestNewWebhookDispatcherValidatesEndpoints(t *testing.T) {
+	t.Parallel()
+
+	for _, endpoint := range []WebhookEndpoint{
+		{URL: "https://crm.example.com/hooks"},
+		{URL: "/hooks", Secret: "s"},
+		{URL: "ftp://crm.example.com/hooks", Secret: "s"},
+	} {
+		if _, err := NewWebhookDispatcher([]WebhookEndpoint{endpoint}); err == nil {
+			t.Errorf("endpoint %+v: want a validation error", endpoint)
+		}
+	}
+}
+
+func TestNewWebhookEventID(t *testing.T) {
+	t.Parallel()
+
+	first, err := NewWebhookEvent(ReceiptCancelled, "r1")
+	if err != nil {
+		t.Fatalf("NewWebhookEvent: %v", err)
+	}
+	again, _ := NewWebhookEvent(ReceiptCancelled, "r1")
+	registered, _ := NewWebhookEvent(ReceiptRegistered, "r1")
+	other, _ := NewWebhookEvent(ReceiptCancelled, "r2")
+
+	if first.ID != again.ID {
+		t.Errorf("IDs %q and %q differ for the same change", first.ID, again.ID)
+	}
+	if first.ID == registered.ID || first.ID == other.ID {
+		t.Error("different changes must get different IDs")
+	}
+	if _, err := NewWebhookEvent(ReceiptCancelled, ""); err == nil {
+		t.Error("want an error for an empty receipt UUID")
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"id":"1"}`)
+	signature := SignWebhook("secret", body)
+
+	if !VerifyWebhookSignature("secret", body, signature) {
+		t.Error("a valid signature must verify")
+	}
+	if VerifyWebhookSignature("other", body, signature) {
+		t.Error("a signature made with another secret must not verify")
+	}
+	if VerifyWebhookSignature("secret", []byte(`{"id":"2"}`), signature) {
+		t.Error("a signature of another body must not verify")
+	}
+	if VerifyWebhookSignature("secret", body, signature[len(webhookSignaturePrefix):]) {
+		t.Error("a signature without the scheme prefix must not verify")
+	}
+}
@@ -0,0 +1,120 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.yaml.in/yaml/v3"
+)
+
+// Cassette is a recorded sequence of HTTP interactions. It is stored as YAML
+// when its path ends in .yaml or .yml and as indented JSON otherwise, either
+// way so it reads well in code review.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// Interaction is a single request and the response it got.
+type Interaction struct {
+	Request  Request  `json:"request"  yaml:"request"`
+	Response Response `json:"response" yaml:"response"`
+}
+
+// Request is a recorded request. Body holds the body as text.
+type Request struct {
+	Method  string      `json:"method"            yaml:"method"`
+	URL     string      `json:"url"               yaml:"url"`
+	Headers http.Header `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"    yaml:"body,omitempty"`
+}
+
+// Response is a recorded response. Body holds the body as text.
+type Response struct {
+	StatusCode int         `json:"statusCode"        yaml:"statusCode"`
+	Headers    http.Header `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"    yaml:"body,omitempty"`
+}
+
+// isYAML reports whether the cassette at path is stored as YAML.
+func isYAML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// Load reads the cassette at path, as YAML or JSON depending on its extension.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, "recorder: cannot read cassette")
+	}
+
+	cassette := new(Cassette)
+	if isYAML(path) {
+		err = yaml.Unmarshal(data, cassette)
+	} else {
+		err = json.Unmarshal(data, cassette)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "recorder: cannot decode cassette %s", path)
+	}
+
+	return cassette, nil
+}
+
+// Save writes the cassette to path, as YAML or JSON depending on its
+// extension, through a temporary file, so a crash never leaves a truncated
+// cassette behind. Missing directories are created.
+func (c *Cassette) Save(path string) error {
+	data, err := c.encode(path)
+	if err != nil {
+		return errors.Wrap(err, "recorder: cannot encode cassette")
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return errors.Wrap(err, "recorder: cannot create cassette directory")
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "recorder: cannot create cassette")
+	}
+	//nolint:gosec // G104: removing a renamed temporary file fails harmlessly.
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return errors.Wrap(err, "recorder: cannot write cassette")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "recorder: cannot write cassette")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "recorder: cannot replace cassette")
+	}
+
+	return nil
+}
+
+// encode returns the cassette in the format of path, ending in a newline.
+func (c *Cassette) encode(path string) ([]byte, error) {
+	if isYAML(path) {
+		return yaml.Marshal(c)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,84 @@
+package recorder
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "nested", "cassette.json")
+	saved := &Cassette{Interactions: []*Interaction{{
+		Request: Request{Method: http.MethodPost, URL: "https://lknpd.nalog.ru/api/v1/income", Body: `{"a":1}`},
+		Response: Response{
+			StatusCode: http.StatusOK,
+			Headers:    http.Header{"Content-Type": {"application/json"}},
+			Body:       `{"approvedReceiptUuid":"200abc"}`,
+		},
+	}}}
+	if err := saved.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Interactions) != 1 {
+		t.Fatalf("Interactions = %d, want 1", len(loaded.Interactions))
+	}
+	got := loaded.Interactions[0]
+	if got.Request.Method != http.MethodPost || got.Request.URL != saved.Interactions[0].Request.URL ||
+		got.Request.Body != `{"a":1}` || got.Response.StatusCode != http.StatusOK || got.Response.Headers.Get("Content-Type") != "application/json" ||
+		got.Response.Body != saved.Interactions[0].Response.Body {
+		t.Errorf("loaded %+v, want %+v", got, saved.Interactions[0])
+	}
+}
+
+// A .yaml cassette is written as YAML, with multi-line bodies kept readable.
+func TestCassetteYAML(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+	body := "{\n  \"approvedReceiptUuid\": \"200abc\"\n}"
+	saved := &Cassette{Interactions: []*Interaction{{
+		Request:  Request{Method: http.MethodGet, URL: "https://lknpd.nalog.ru/api/v1/user"},
+		Response: Response{StatusCode: http.StatusOK, Headers: http.Header{"Content-Type": {"application/json"}}, Body: body},
+	}}}
+	if err := saved.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "interactions:\n") || !strings.Contains(string(data), "statusCode: 200") {
+		t.Errorf("cassette is not YAML:\n%s", data)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Interactions) != 1 || loaded.Interactions[0].Response.Body != body ||
+		loaded.Interactions[0].Response.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("loaded %+v, want %+v", loaded.Interactions, saved.Interactions)
+	}
+}
+
+func TestLoadBrokenCassette(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load of a broken cassette = nil error, want one")
+	}
+}
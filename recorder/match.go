@@ -0,0 +1,110 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// defaultIgnoredBodyFields change on every request the client builds.
+var defaultIgnoredBodyFields = []string{"requestTime"}
+
+// Matcher reports whether a live request, already redacted the way the
+// cassette is, matches a recorded one.
+type Matcher func(live, recorded *Request) bool
+
+// MatchMethod matches requests by method.
+func MatchMethod() Matcher {
+	return func(live, recorded *Request) bool {
+		return live.Method == recorded.Method
+	}
+}
+
+// MatchPath matches requests by URL path, ignoring the scheme, host and
+// query, so a cassette recorded against the portal replays against a test
+// server.
+func MatchPath() Matcher {
+	return func(live, recorded *Request) bool {
+		return urlPart(live.URL, (*url.URL).EscapedPath) == urlPart(recorded.URL, (*url.URL).EscapedPath)
+	}
+}
+
+// MatchQuery matches requests by URL query, regardless of parameter order.
+func MatchQuery() Matcher {
+	return func(live, recorded *Request) bool {
+		query := func(u *url.URL) string { return u.Query().Encode() }
+
+		return urlPart(live.URL, query) == urlPart(recorded.URL, query)
+	}
+}
+
+// MatchBody matches requests by body. JSON bodies are compared as documents,
+// regardless of key order and without the ignored fields, found at any
+// depth; other bodies are compared as they are.
+func MatchBody(ignored ...string) Matcher {
+	skip := make(map[string]bool, len(ignored))
+	for _, name := range ignored {
+		skip[name] = true
+	}
+
+	return func(live, recorded *Request) bool {
+		return normalizeBody(live.Body, skip) == normalizeBody(recorded.Body, skip)
+	}
+}
+
+// DefaultMatchers match requests by method, path and body, ignoring the
+// requestTime the client stamps on receipts.
+func DefaultMatchers() []Matcher {
+	return []Matcher{MatchMethod(), MatchPath(), MatchBody(defaultIgnoredBodyFields...)}
+}
+
+func urlPart(rawURL string, part func(*url.URL) string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	return part(u)
+}
+
+func normalizeBody(body string, skip map[string]bool) string {
+	if strings.TrimSpace(body) == "" {
+		return ""
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return body
+	}
+
+	// encoding/json writes object keys sorted, which makes the result
+	// canonical.
+	normalized, err := json.Marshal(dropFields(document, skip))
+	if err != nil {
+		return body
+	}
+
+	return string(normalized)
+}
+
+func dropFields(value any, skip map[string]bool) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for name, item := range value {
+			if skip[name] {
+				delete(value, name)
+
+				continue
+			}
+			value[name] = dropFields(item, skip)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = dropFields(item, skip)
+		}
+	}
+
+	return value
+}
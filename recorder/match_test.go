@@ -0,0 +1,49 @@
+package recorder
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	t.Parallel()
+
+	recorded := &Request{
+		Method: http.MethodPost,
+		URL:    "https://lknpd.nalog.ru/api/v1/income?a=1&b=2",
+		Body:   `{"requestTime":"2024-09-10T12:00:00+03:00","services":[{"name":"x","amount":1}]}`,
+	}
+
+	tests := []struct {
+		name    string
+		matcher Matcher
+		live    Request
+		want    bool
+	}{
+		{"method", MatchMethod(), Request{Method: http.MethodPost}, true},
+		{"other method", MatchMethod(), Request{Method: http.MethodGet}, false},
+		{"path on another host", MatchPath(), Request{URL: "http://127.0.0.1:8080/api/v1/income"}, true},
+		{"other path", MatchPath(), Request{URL: "https://lknpd.nalog.ru/api/v1/incomes"}, false},
+		{"query reordered", MatchQuery(), Request{URL: "http://127.0.0.1/api/v1/income?b=2&a=1"}, true},
+		{"other query", MatchQuery(), Request{URL: "http://127.0.0.1/api/v1/income?a=1"}, false},
+		{
+			"body ignoring requestTime", MatchBody("requestTime"),
+			Request{Body: `{"services":[{"amount":1,"name":"x"}],"requestTime":"2026-01-01T00:00:00+03:00"}`},
+			true,
+		},
+		{"body differs", MatchBody("requestTime"), Request{Body: `{"services":[{"amount":2,"name":"x"}]}`}, false},
+		{"body with requestTime", MatchBody(), Request{Body: `{"services":[{"amount":1,"name":"x"}]}`}, false},
+		{"text body", MatchBody(), Request{Body: "not json"}, false},
+	}
+	for _, tt := range tests {
+		live := tt.live
+		if got := tt.matcher(&live, recorded); got != tt.want {
+			t.Errorf("%s: match = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+
+	text := &Request{Body: "not json"}
+	if !MatchBody()(text, text) {
+		t.Error("identical text bodies must match")
+	}
+}
@@ -0,0 +1,279 @@
+// Package recorder records the HTTP interactions of a client with
+// lknpd.nalog.ru into cassettes and replays them, so tests exercise real
+// portal responses captured once and run offline in CI afterwards.
+//
+// Cassettes are YAML files when their name ends in .yaml or .yml and JSON
+// files otherwise. Tokens, passwords, INNs and phones, including those inside
+// longer strings, are redacted before anything is written, so recorded
+// cassettes are safe to commit.
+//
+//	rec, err := recorder.New("testdata/income_create.json", recorder.WithMode(recorder.ModeAuto))
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	t.Cleanup(func() { _ = rec.Stop() })
+//
+//	client := moynalog.NewClient(moynalog.WithHTTPClient(rec.Client()))
+package recorder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Mode is what a Recorder does with the requests it receives.
+type Mode int
+
+// Supported recorder modes.
+const (
+	// ModeReplay answers every request from the cassette and never reaches
+	// the network. A request the cassette has no answer for fails.
+	ModeReplay Mode = iota
+	// ModeRecord sends every request and records the interactions, replacing
+	// the cassette on Stop.
+	ModeRecord
+	// ModeAuto replays when the cassette exists and records otherwise.
+	ModeAuto
+)
+
+// ErrInteractionNotFound is returned in replay when the cassette has no
+// unused interaction matching the request.
+var ErrInteractionNotFound = errors.New("recorder: no recorded interaction matches the request")
+
+// Recorder is an http.RoundTripper recording to or replaying from a cassette.
+// It is safe for concurrent use, though concurrent requests are recorded, and
+// so must be replayed, in the order they complete.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	matchers  []Matcher
+	redactor  *redactor
+
+	mu       sync.Mutex
+	cassette *Cassette
+	// used marks the interactions already replayed, so identical requests
+	// are answered in the order they were recorded.
+	used []bool
+}
+
+// Option customises a Recorder.
+type Option func(*Recorder)
+
+// WithMode sets the mode, which defaults to ModeReplay.
+func WithMode(mode Mode) Option {
+	return func(r *Recorder) {
+		r.mode = mode
+	}
+}
+
+// WithTransport sets the transport requests are recorded through, which
+// defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(r *Recorder) {
+		if transport != nil {
+			r.transport = transport
+		}
+	}
+}
+
+// WithMatchers replaces how live requests are matched against recorded ones,
+// which defaults to DefaultMatchers. A request matches when every matcher
+// agrees.
+func WithMatchers(matchers ...Matcher) Option {
+	return func(r *Recorder) {
+		if len(matchers) > 0 {
+			r.matchers = matchers
+		}
+	}
+}
+
+// WithRedactedHeaders redacts the named headers on top of Authorization,
+// Cookie and Set-Cookie.
+func WithRedactedHeaders(names ...string) Option {
+	return func(r *Recorder) {
+		r.redactor.addHeaders(names...)
+	}
+}
+
+// WithRedactedFields redacts the named JSON fields, at any depth and
+// regardless of case, on top of the tokens, passwords, INNs and phones
+// redacted by default.
+func WithRedactedFields(names ...string) Option {
+	return func(r *Recorder) {
+		r.redactor.addFields(names...)
+	}
+}
+
+// New returns a recorder for the cassette at path. In ModeReplay, and in
+// ModeAuto when the file exists, the cassette is loaded right away.
+func New(path string, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      ModeReplay,
+		transport: http.DefaultTransport,
+		matchers:  DefaultMatchers(),
+		redactor:  newRedactor(),
+		cassette:  new(Cassette),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.mode == ModeAuto {
+		r.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		}
+	}
+
+	if r.mode == ModeReplay {
+		cassette, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = cassette
+		r.used = make([]bool, len(cassette.Interactions))
+	}
+
+	return r, nil
+}
+
+// Mode returns what the recorder does, ModeAuto resolved to ModeReplay or
+// ModeRecord.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an HTTP client sending its requests through the recorder.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Stop saves the recorded cassette. It does nothing in replay.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cassette.Save(r.path)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "recorder: cannot read request body")
+	}
+	recorded := Request{
+		Method:  req.Method,
+		URL:     r.redactor.url(req.URL.String()),
+		Headers: r.redactor.header(req.Header),
+		Body:    r.redactor.body(string(body)),
+	}
+
+	if r.mode == ModeRecord {
+		// RoundTrip must not modify req, so the body read above goes out
+		// with a copy.
+		out := req.Clone(req.Context())
+		if body != nil {
+			out.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		return r.record(out, recorded)
+	}
+
+	return r.replay(req, &recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded Request) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readBody(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "recorder: cannot read response body")
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Headers:    r.redactor.header(resp.Header),
+			Body:       r.redactor.body(string(body)),
+		},
+	})
+
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, live *Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !r.matches(live, &interaction.Request) {
+			continue
+		}
+		r.used[i] = true
+
+		recorded := interaction.Response
+		header := recorded.Headers.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		// Redaction may have changed the length of the body.
+		header.Del("Content-Length")
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+			StatusCode:    recorded.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, errors.Wrapf(ErrInteractionNotFound, "%s %s", live.Method, live.URL)
+}
+
+func (r *Recorder) matches(live, recorded *Request) bool {
+	for _, match := range r.matchers {
+		if !match(live, recorded) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readBody reads and closes body, which may be nil.
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil || body == http.NoBody {
+		return nil, nil
+	}
+	//nolint:gosec // G104: the body is read in full before it is closed.
+	defer func() { _ = body.Close() }()
+
+	return io.ReadAll(body)
+}
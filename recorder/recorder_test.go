@@ -0,0 +1,165 @@
+package recorder
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/shoman4eg/go-moy-nalog/moynalog"
+)
+
+// portal answers the authentication and receipt creation endpoints the way
+// lknpd.nalog.ru does, counting the requests that reach it.
+func portal(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var hits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/lkfl", func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"token":"access-secret","refreshToken":"refresh-secret",`+
+			`"profile":{"inn":"500100732259","phone":"79001234567","displayName":"Иванов"}}`)
+	})
+	mux.HandleFunc("/v1/income", func(w http.ResponseWriter, _ *http.Request) {
+		n := hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"approvedReceiptUuid":"receipt-`+strconv.Itoa(int(n))+`"}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server, &hits
+}
+
+// session authenticates and registers two identical receipts through client.
+func session(t *testing.T, client *moynalog.Client) []string {
+	t.Helper()
+
+	ctx := context.Background()
+	token, _, err := client.Auth.CreateAccessToken(ctx, "500100732259", "password-secret")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	authed := client.WithToken(token)
+
+	var receipts []string
+	for range 2 {
+		created, _, err := authed.Income.Create(ctx, &moynalog.IncomeCreateRequest{
+			Services:      []moynalog.IncomeServiceItem{{Name: "Консультация", Amount: decimal.NewFromInt(1500), Quantity: decimal.NewFromInt(1)}},
+			OperationTime: time.Date(2024, time.September, 10, 12, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		receipts = append(receipts, created.ApprovedReceiptUUID)
+	}
+
+	return receipts
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	server, hits := portal(t)
+	path := filepath.Join(t.TempDir(), "cassettes", "session.json")
+
+	rec, err := New(path, WithMode(ModeAuto))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if rec.Mode() != ModeRecord {
+		t.Fatalf("Mode = %d, want ModeRecord without a cassette", rec.Mode())
+	}
+	client := moynalog.NewClient(moynalog.WithEndpoint(server.URL), moynalog.WithDeviceID("device"),
+		moynalog.WithHTTPClient(rec.Client()))
+	recorded := session(t, client)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cassette: %v", err)
+	}
+	for _, secret := range []string{"access-secret", "refresh-secret", "password-secret", "500100732259", "79001234567"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette leaks %q:\n%s", secret, data)
+		}
+	}
+
+	// The replay runs later, so requestTime differs, and offline.
+	server.Close()
+	before := hits.Load()
+
+	replayer, err := New(path, WithMode(ModeAuto))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if replayer.Mode() != ModeReplay {
+		t.Fatalf("Mode = %d, want ModeReplay with a cassette", replayer.Mode())
+	}
+	client = moynalog.NewClient(moynalog.WithEndpoint("http://replay.invalid"), moynalog.WithDeviceID("device"),
+		moynalog.WithHTTPClient(replayer.Client()))
+	replayed := session(t, client)
+
+	if strings.Join(replayed, ",") != strings.Join(recorded, ",") || recorded[0] == recorded[1] {
+		t.Errorf("replayed %v, want %v in the recorded order", replayed, recorded)
+	}
+	if hits.Load() != before {
+		t.Error("replay reached the network")
+	}
+	if err := replayer.Stop(); err != nil {
+		t.Errorf("Stop in replay: %v", err)
+	}
+}
+
+func TestReplayUnmatchedRequest(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette := &Cassette{Interactions: []*Interaction{{
+		Request:  Request{Method: http.MethodGet, URL: "https://lknpd.nalog.ru/api/v1/user"},
+		Response: Response{StatusCode: http.StatusOK, Body: `{}`},
+	}}}
+	if err := cassette.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	rec, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	client := rec.Client()
+
+	resp, err := client.Get("http://127.0.0.1/api/v1/user")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// Every interaction answers once.
+	_, err = client.Get("http://127.0.0.1/api/v1/user") //nolint:bodyclose // No response on error.
+	if !errors.Is(err, ErrInteractionNotFound) {
+		t.Errorf("second Get = %v, want ErrInteractionNotFound", err)
+	}
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	t.Parallel()
+
+	if _, err := New(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("New in replay without a cassette = nil error, want one")
+	}
+}
@@ -0,0 +1,168 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces every secret and personal value in a cassette.
+const Redacted = "REDACTED"
+
+var (
+	// defaultRedactedHeaders carry credentials.
+	defaultRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+	// defaultRedactedFields are the JSON fields carrying tokens, passwords,
+	// INNs and phones in the lknpd.nalog.ru payloads.
+	defaultRedactedFields = []string{
+		"token", "refreshToken", "password", "secret", "username", "login",
+		"inn", "clientInn", "partnerInn", "phone", "snils", "email",
+	}
+	// personalValue matches INNs, 10 or 12 digits, and Russian phone numbers.
+	personalValue = regexp.MustCompile(`^(\d{10}|\d{12}|\+?7\d{10})$`)
+	// number matches the standalone numbers of a string, which personalValue
+	// then tells apart, so an INN is found in "ИП Иванов, ИНН 7707083893" but
+	// not inside a longer number or an identifier such as "a7707083893".
+	number = regexp.MustCompile(`\+?\b\d+\b`)
+)
+
+// redactPersonal replaces the INNs and phones found in s.
+func redactPersonal(s string) string {
+	return number.ReplaceAllStringFunc(s, func(n string) string {
+		if personalValue.MatchString(n) {
+			return Redacted
+		}
+
+		return n
+	})
+}
+
+// redactor blanks out the secrets and personal data of requests and
+// responses before they are stored or matched.
+type redactor struct {
+	headers map[string]bool
+	fields  map[string]bool
+}
+
+func newRedactor() *redactor {
+	r := &redactor{headers: make(map[string]bool), fields: make(map[string]bool)}
+	r.addHeaders(defaultRedactedHeaders...)
+	r.addFields(defaultRedactedFields...)
+
+	return r
+}
+
+func (r *redactor) addHeaders(names ...string) {
+	for _, name := range names {
+		r.headers[http.CanonicalHeaderKey(name)] = true
+	}
+}
+
+func (r *redactor) addFields(names ...string) {
+	for _, name := range names {
+		r.fields[strings.ToLower(name)] = true
+	}
+}
+
+func (r *redactor) header(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+
+	redacted := header.Clone()
+	for name := range redacted {
+		if r.headers[http.CanonicalHeaderKey(name)] {
+			redacted[name] = []string{Redacted}
+		}
+	}
+
+	return redacted
+}
+
+// url blanks out the personal path segments and query values of rawURL, such
+// as the INN in /receipt/{inn}/{uuid}/print.
+func (r *redactor) url(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = redactPersonal(segment)
+	}
+	u.Path, u.RawPath = strings.Join(segments, "/"), ""
+
+	query := u.Query()
+	for name, values := range query {
+		for i, value := range values {
+			if r.fields[strings.ToLower(name)] {
+				values[i] = Redacted
+			} else {
+				values[i] = redactPersonal(value)
+			}
+		}
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// body blanks out the redacted fields and personal values of a JSON body.
+// Anything else is kept as it is.
+func (r *redactor) body(body string) string {
+	if body == "" {
+		return body
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return body
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.value("", document)); err != nil {
+		return body
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (r *redactor) value(field string, value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for name, item := range value {
+			value[name] = r.value(name, item)
+		}
+
+		return value
+	case []any:
+		for i, item := range value {
+			value[i] = r.value(field, item)
+		}
+
+		return value
+	case nil:
+		return nil
+	case string:
+		if r.fields[strings.ToLower(field)] {
+			return Redacted
+		}
+
+		return redactPersonal(value)
+	default:
+		if r.fields[strings.ToLower(field)] {
+			return Redacted
+		}
+
+		return value
+	}
+}
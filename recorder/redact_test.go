@@ -0,0 +1,56 @@
+package recorder
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	t.Parallel()
+
+	r := newRedactor()
+	r.addFields("displayName")
+
+	got := r.body(`{"username":"500100732259","password":"secret","deviceInfo":{"sourceDeviceId":"device"},` +
+		`"profile":{"inn":"7707083893","Phone":"+79001234567","displayName":"Иванов & Ко","id":7},` +
+		`"services":[{"name":"9001234567","amount":1500.50}]}`)
+	want := `{"deviceInfo":{"sourceDeviceId":"device"},"password":"REDACTED",` +
+		`"profile":{"Phone":"REDACTED","displayName":"REDACTED","id":7,"inn":"REDACTED"},` +
+		`"services":[{"amount":1500.50,"name":"REDACTED"}],"username":"REDACTED"}`
+	if got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+
+	got = r.body(`{"description":["ИП Иванов, ИНН 7707083893, тел. +79001234567","Заказ 123456, код a7707083893"]}`)
+	want = `{"description":["ИП Иванов, ИНН REDACTED, тел. REDACTED","Заказ 123456, код a7707083893"]}`
+	if got != want {
+		t.Errorf("embedded values: body =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := r.body("plain text 500100732259"); got != "plain text 500100732259" {
+		t.Errorf("non-JSON body = %q, want it kept", got)
+	}
+}
+
+func TestRedactURLAndHeaders(t *testing.T) {
+	t.Parallel()
+
+	r := newRedactor()
+
+	got := r.url("https://lknpd.nalog.ru/api/v1/receipt/500100732259/200abc/print?inn=7707083893&limit=10&q=ИНН+7707083893")
+	want := "https://lknpd.nalog.ru/api/v1/receipt/REDACTED/200abc/print?inn=REDACTED&limit=10&q=%D0%98%D0%9D%D0%9D+REDACTED"
+	if got != want {
+		t.Errorf("url = %s, want %s", got, want)
+	}
+
+	r.addHeaders("x-device-id")
+	header := http.Header{"Authorization": {"Bearer token"}, "X-Device-Id": {"device"}, "Accept": {"application/json"}}
+	redacted := r.header(header)
+	if redacted.Get("Authorization") != Redacted || redacted.Get("X-Device-Id") != Redacted ||
+		redacted.Get("Accept") != "application/json" {
+		t.Errorf("header = %v", redacted)
+	}
+	if header.Get("Authorization") != "Bearer token" {
+		t.Error("header must not be redacted in place")
+	}
+}
@@ -0,0 +1,165 @@
+// Package validate checks the identifiers of Russian counterparties: the INN
+// by its control digits, the format of a KPP, and phone numbers, which it
+// normalizes to E.164. moynalog runs these checks on every counterparty
+// before a receipt or an invoice is sent; they are exported for validating
+// user input up front.
+//
+//	if err := validate.INN("7707083893"); err != nil {
+//		return err
+//	}
+//	phone, err := validate.NormalizePhone("8 (900) 123-45-67") // +79001234567
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	innLengthLegalEntity = 10
+	innLengthIndividual  = 12
+
+	kppLength = 9
+
+	// e164MinDigits and e164MaxDigits bound the digits of an E.164 number
+	// after the leading plus sign.
+	e164MinDigits = 8
+	e164MaxDigits = 15
+
+	// russianPhoneDigits is the length of a Russian number with its trunk
+	// prefix, as in 8 900 123-45-67.
+	russianPhoneDigits = 11
+	// russianLocalDigits is the length of a Russian number without it.
+	russianLocalDigits = 10
+)
+
+// Error is a value rejected by one of the checks.
+type Error struct {
+	// Field names the value checked: INN, KPP or phone.
+	Field string
+	// Reason says what is wrong with it.
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "validate: " + e.Field + " " + e.Reason
+}
+
+// invalid returns an *Error for field with the reason format produces.
+func invalid(field, format string, args ...any) error {
+	return errors.WithStack(&Error{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// innWeights are the control digit weights of the official INN algorithm:
+// one set for a 10-digit INN, two sets for the two control digits of a
+// 12-digit one.
+var (
+	innWeights10  = []int{2, 4, 10, 3, 5, 9, 4, 6, 8}
+	innWeights12a = []int{7, 2, 4, 10, 3, 5, 9, 4, 6, 8}
+	innWeights12b = []int{3, 7, 2, 4, 10, 3, 5, 9, 4, 6, 8}
+)
+
+// INN checks that inn is a 10-digit (organisation) or 12-digit (individual)
+// INN with valid control digits.
+func INN(inn string) error {
+	if !isDigits(inn) {
+		return invalid("INN", "must contain only digits")
+	}
+
+	switch len(inn) {
+	case innLengthLegalEntity:
+		if innControlDigit(inn, innWeights10) != inn[9] {
+			return invalid("INN", "%s has an invalid control digit", inn)
+		}
+	case innLengthIndividual:
+		if innControlDigit(inn, innWeights12a) != inn[10] || innControlDigit(inn, innWeights12b) != inn[11] {
+			return invalid("INN", "%s has invalid control digits", inn)
+		}
+	default:
+		return invalid("INN", "length must be %d or %d", innLengthLegalEntity, innLengthIndividual)
+	}
+
+	return nil
+}
+
+// innControlDigit weighs the leading digits of inn and returns the expected
+// control digit as an ASCII byte.
+func innControlDigit(inn string, weights []int) byte {
+	sum := 0
+	for i, weight := range weights {
+		sum += int(inn[i]-'0') * weight
+	}
+
+	return byte('0' + sum%11%10)
+}
+
+// KPP checks the format of a KPP: four digits of the tax office code, two
+// digits or capital Latin letters of the registration reason, then three
+// digits.
+func KPP(kpp string) error {
+	if len(kpp) != kppLength {
+		return invalid("KPP", "must be %d characters long", kppLength)
+	}
+	if !isDigits(kpp[:4]) || !isDigits(kpp[6:]) {
+		return invalid("KPP", "%s is malformed", kpp)
+	}
+	for _, r := range kpp[4:6] {
+		if (r < '0' || r > '9') && (r < 'A' || r > 'Z') {
+			return invalid("KPP", "%s is malformed", kpp)
+		}
+	}
+
+	return nil
+}
+
+// NormalizePhone returns phone in E.164 format. Spaces, dashes, dots and
+// parentheses are dropped, and Russian numbers written with the 8 trunk
+// prefix, without the plus sign or without the country code are completed
+// with +7.
+func NormalizePhone(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		default:
+			return r
+		}
+	}, phone)
+
+	international := strings.HasPrefix(digits, "+")
+	digits = strings.TrimPrefix(digits, "+")
+	if !isDigits(digits) {
+		return "", invalid("phone", "%q must contain only digits", phone)
+	}
+
+	switch {
+	case international:
+	case len(digits) == russianPhoneDigits && (digits[0] == '8' || digits[0] == '7'):
+		digits = "7" + digits[1:]
+	case len(digits) == russianLocalDigits:
+		digits = "7" + digits
+	default:
+		return "", invalid("phone", "%q is not in international format", phone)
+	}
+
+	if len(digits) < e164MinDigits || len(digits) > e164MaxDigits || digits[0] == '0' {
+		return "", invalid("phone", "%q is not a valid E.164 number", phone)
+	}
+
+	return "+" + digits, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,97 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestINN(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		inn   string
+		valid bool
+	}{
+		{"7707083893", true},
+		{"7727406020", true},
+		{"500100732259", true},
+		{"7707083894", false},
+		{"500100732258", false},
+		{"500100732249", false},
+		{"1111111111", false},
+		{"77070838", false},
+		{"77070838930", false},
+		{"770708389a", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if err := INN(tt.inn); (err == nil) != tt.valid {
+			t.Errorf("INN(%q) = %v, want valid %t", tt.inn, err, tt.valid)
+		}
+	}
+}
+
+func TestKPP(t *testing.T) {
+	t.Parallel()
+
+	for _, kpp := range []string{"770801001", "7708AB001"} {
+		if err := KPP(kpp); err != nil {
+			t.Errorf("KPP(%q) = %v, want nil", kpp, err)
+		}
+	}
+	for _, kpp := range []string{"", "77080100", "7708010011", "77O801001", "7708ab001", "770801O01"} {
+		if err := KPP(kpp); err == nil {
+			t.Errorf("KPP(%q) = nil, want an error", kpp)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"+79001234567", "+79001234567"},
+		{"89001234567", "+79001234567"},
+		{"79001234567", "+79001234567"},
+		{"9001234567", "+79001234567"},
+		{"8 (900) 123-45-67", "+79001234567"},
+		{"+7 900 123.45.67", "+79001234567"},
+		{"+375 29 123-45-67", "+375291234567"},
+		{"phone", ""},
+		{"12345", ""},
+		{"+0123456789", ""},
+		{"+1234567890123456", ""},
+		{"+7-900-123-45-67 доб. 1", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.phone)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("NormalizePhone(%q) = %q, want an error", tt.phone, got)
+			}
+
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want %q", tt.phone, got, err, tt.want)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	t.Parallel()
+
+	var invalid *Error
+	if err := INN("7707083894"); !errors.As(err, &invalid) {
+		t.Fatalf("INN = %v, want an *Error", err)
+	}
+	if invalid.Field != "INN" || invalid.Error() != "validate: INN 7707083894 has an invalid control digit" {
+		t.Errorf("error = %+v, %q", invalid, invalid.Error())
+	}
+}